@@ -0,0 +1,395 @@
+package easyllm
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const replayChunkSize = 8 // 由NormalChat结果回放为流式响应时每个分片的字数
+
+// CacheEntry 缓存的调用结果
+type CacheEntry struct {
+	Response *easyai.ChatResponse `json:"response"`
+	Chunks   []string             `json:"chunks,omitempty"` // 流式调用的原始分片, 回放时保持一致
+	Reply    interface{}          `json:"-"`                // 大模型的原始返回, 序列化时连同类型一起保存, 需为已注册的类型
+	ExpireAt time.Time            `json:"expire_at"`        // 零值表示不过期
+}
+
+var (
+	replyTypesMu sync.RWMutex
+	replyTypes   = map[string]reflect.Type{
+		reflect.TypeOf(&easyai.QWenResponse{}).String():    reflect.TypeOf(&easyai.QWenResponse{}),
+		reflect.TypeOf(&easyai.HunYuanResponse{}).String(): reflect.TypeOf(&easyai.HunYuanResponse{}),
+	}
+)
+
+// RegisterCacheReply 注册自定义的原始返回类型, 使用文件等需要序列化的存储时命中的结果仍能还原Reply
+// 通义千问与混元的返回类型已默认注册
+func RegisterCacheReply(sample interface{}) {
+	replyTypesMu.Lock()
+	defer replyTypesMu.Unlock()
+
+	replyTypes[reflect.TypeOf(sample).String()] = reflect.TypeOf(sample)
+}
+
+// cacheEntryJSON CacheEntry序列化的格式, Reply保存为原始JSON与类型名
+type cacheEntryJSON struct {
+	*plainCacheEntry
+	Reply     json.RawMessage `json:"reply,omitempty"`
+	ReplyType string          `json:"reply_type,omitempty"`
+}
+
+type plainCacheEntry CacheEntry
+
+func (self *CacheEntry) MarshalJSON() ([]byte, error) {
+	data := &cacheEntryJSON{plainCacheEntry: (*plainCacheEntry)(self)}
+	if self.Reply != nil {
+		replyTypesMu.RLock()
+		_, ok := replyTypes[reflect.TypeOf(self.Reply).String()]
+		replyTypesMu.RUnlock()
+		// 未注册的类型无法还原, 不保存
+		if ok {
+			reply, err := json.Marshal(self.Reply)
+			if err != nil {
+				return nil, err
+			}
+			data.Reply, data.ReplyType = reply, reflect.TypeOf(self.Reply).String()
+		}
+	}
+
+	return json.Marshal(data)
+}
+
+func (self *CacheEntry) UnmarshalJSON(content []byte) error {
+	data := &cacheEntryJSON{plainCacheEntry: (*plainCacheEntry)(self)}
+	if err := json.Unmarshal(content, data); err != nil {
+		return err
+	}
+
+	replyTypesMu.RLock()
+	kind, ok := replyTypes[data.ReplyType]
+	replyTypesMu.RUnlock()
+	if !ok || len(data.Reply) == 0 {
+		return nil
+	}
+
+	value := reflect.New(kind)
+	if err := json.Unmarshal(data.Reply, value.Interface()); err != nil {
+		return fmt.Errorf("还原缓存的原始返回失败: %w", err)
+	}
+	self.Reply = value.Elem().Interface()
+
+	return nil
+}
+
+func (self *CacheEntry) expired() bool {
+	return !self.ExpireAt.IsZero() && time.Now().After(self.ExpireAt)
+}
+
+// CacheStore 缓存存储, Get未命中或已过期时返回nil
+type CacheStore interface {
+	Get(ctx context.Context, key string) (*CacheEntry, error)
+	Set(ctx context.Context, key string, entry *CacheEntry) error
+	Delete(ctx context.Context, key string) error
+}
+
+type cacheScopeKey struct{}
+
+// withCacheScope 记录发起调用的客户端, 由ChatClient写入
+func withCacheScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, cacheScopeKey{}, scope)
+}
+
+// CacheKey 由发起调用的客户端(服务商、全局参数)与规范化后的请求计算缓存键, 流式与非流式请求共用同一个键,
+// 因此不同配置的ChatClient可以共用同一个存储; 直接用Chain组装的调用链没有客户端信息, 只按请求计算
+func CacheKey(ctx context.Context, request *easyai.ChatRequest) string {
+	clone := cloneRequest(request)
+	clone.Stream = false
+	marshal, _ := json.Marshal(clone)
+	scope, _ := ctx.Value(cacheScopeKey{}).(string)
+	sum := sha256.Sum256(append([]byte(scope+"\x00"), marshal...))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// CacheMiddleware 相同请求直接返回缓存结果, 命中的流式调用会以分片的形式回放
+func CacheMiddleware(store CacheStore, ttl time.Duration) Middleware {
+	newEntry := func(resp *easyai.ChatResponse, chunks []string, reply interface{}) *CacheEntry {
+		entry := &CacheEntry{Response: resp, Chunks: chunks, Reply: reply}
+		if ttl > 0 {
+			entry.ExpireAt = time.Now().Add(ttl)
+		}
+
+		return entry
+	}
+
+	return func(next ChatHandler) ChatHandler {
+		normal := func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+			if request == nil {
+				return next.NormalChat(ctx, request)
+			}
+
+			key := CacheKey(ctx, request)
+			if entry, err := store.Get(ctx, key); err == nil && entry != nil {
+				resp := *entry.Response
+
+				return &resp, entry.Reply, nil
+			}
+
+			resp, reply, err := next.NormalChat(ctx, request)
+			if err == nil && resp != nil {
+				clone := *resp
+				_ = store.Set(ctx, key, newEntry(&clone, nil, reply))
+			}
+
+			return resp, reply, err
+		}
+		stream := func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+			if request == nil {
+				return next.StreamChat(ctx, request)
+			}
+
+			key := CacheKey(ctx, request)
+			if entry, err := store.Get(ctx, key); err == nil && entry != nil {
+				return replayEntry(ctx, entry), nil
+			}
+
+			messageChan, err := next.StreamChat(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			return recordStream(ctx, messageChan, func(resp *easyai.ChatResponse, chunks []string) {
+				_ = store.Set(context.WithoutCancel(ctx), key, newEntry(resp, chunks, nil))
+			}), nil
+		}
+
+		return HandlerFuncs(normal, stream)
+	}
+}
+
+// recordStream 转发流式响应并记录所有分片, 完整结束后回调save
+func recordStream(ctx context.Context, stream <-chan *easyai.ChatResponse, save func(resp *easyai.ChatResponse, chunks []string)) <-chan *easyai.ChatResponse {
+	var chunks []string
+	var last easyai.ChatResponse
+
+	return TapStream(ctx, stream, func(resp *easyai.ChatResponse) {
+		chunks = append(chunks, resp.Content)
+		last = *resp
+	}, func() {
+		// 调用方中途取消, 或内层超时、服务出错导致流提前关闭(最后一个分片没有FinishReason)时结果不完整, 不写入缓存
+		if ctx.Err() != nil || last.FinishReason == "" {
+			return
+		}
+
+		last.Content = strings.Join(chunks, "")
+		save(&last, chunks)
+	})
+}
+
+func replayEntry(ctx context.Context, entry *CacheEntry) <-chan *easyai.ChatResponse {
+	chunks := entry.Chunks
+	if len(chunks) == 0 {
+		chunks = splitContent(entry.Response.Content, replayChunkSize)
+	}
+
+	messageChan := make(chan *easyai.ChatResponse)
+	go func() {
+		defer close(messageChan)
+		for i, chunk := range chunks {
+			resp := *entry.Response
+			resp.Content = chunk
+			// 缓存的结果都是完整的, 只在最后一个分片标记结束
+			if i < len(chunks)-1 {
+				resp.FinishReason = ""
+			} else if resp.FinishReason == "" {
+				resp.FinishReason = "stop"
+			}
+			select {
+			case messageChan <- &resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messageChan
+}
+
+func splitContent(content string, size int) []string {
+	var chunks []string
+	runes := []rune(content)
+	for start := 0; start < len(runes); start += size {
+		chunks = append(chunks, string(runes[start:min(start+size, len(runes))]))
+	}
+
+	return chunks
+}
+
+// MemoryCacheStore 基于LRU淘汰的内存缓存
+type MemoryCacheStore struct {
+	capacity int
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCacheStore capacity为最多缓存的条数, 小于1时不限制
+func NewMemoryCacheStore(capacity int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (self *MemoryCacheStore) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	element, ok := self.items[key]
+	if !ok {
+		return nil, nil
+	}
+
+	item := element.Value.(*memoryCacheItem)
+	if item.entry.expired() {
+		self.order.Remove(element)
+		delete(self.items, key)
+
+		return nil, nil
+	}
+	self.order.MoveToFront(element)
+
+	return item.entry, nil
+}
+
+func (self *MemoryCacheStore) Set(ctx context.Context, key string, entry *CacheEntry) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if element, ok := self.items[key]; ok {
+		element.Value.(*memoryCacheItem).entry = entry
+		self.order.MoveToFront(element)
+
+		return nil
+	}
+
+	self.items[key] = self.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	if self.capacity > 0 && self.order.Len() > self.capacity {
+		oldest := self.order.Back()
+		self.order.Remove(oldest)
+		delete(self.items, oldest.Value.(*memoryCacheItem).key)
+	}
+
+	return nil
+}
+
+func (self *MemoryCacheStore) Delete(ctx context.Context, key string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if element, ok := self.items[key]; ok {
+		self.order.Remove(element)
+		delete(self.items, key)
+	}
+
+	return nil
+}
+
+func (self *MemoryCacheStore) Len() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.order.Len()
+}
+
+// FileCacheStore 每条缓存保存为目录下的一个JSON文件, 大模型的原始返回见RegisterCacheReply
+type FileCacheStore struct {
+	dir string
+}
+
+func NewFileCacheStore(dir string) (*FileCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileCacheStore{dir: dir}, nil
+}
+
+func (self *FileCacheStore) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	content, err := os.ReadFile(self.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry := new(CacheEntry)
+	if err = json.Unmarshal(content, entry); err != nil {
+		return nil, err
+	}
+	if entry.expired() {
+		_ = os.Remove(self.path(key))
+
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+func (self *FileCacheStore) Set(ctx context.Context, key string, entry *CacheEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名, 避免读到写了一半的内容
+	tmp, err := os.CreateTemp(self.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), self.path(key))
+}
+
+func (self *FileCacheStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(self.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (self *FileCacheStore) path(key string) string {
+	return filepath.Join(self.dir, filepath.Base(key)+".json")
+}
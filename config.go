@@ -53,3 +53,12 @@ func DefaultConfigWithSecretAndProxy(secretId, secretKey string, types easyai.LL
 		HttpClient: httpClient,
 	}
 }
+
+// DefaultConfigWithCredentials 使用密钥池, 每次请求按pool的策略选取密钥
+func DefaultConfigWithCredentials(pool *easyai.CredentialPool, types easyai.LLMType) *easyai.ClientConfig {
+	return &easyai.ClientConfig{
+		Types:       types,
+		Credentials: pool,
+		HttpClient:  &http.Client{},
+	}
+}
@@ -0,0 +1,442 @@
+package easyllm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 保存时版本冲突的最大重试次数, 每次重试都在最新的记录后追加本轮对话
+const maxConflictRetries = 3
+
+var (
+	// ErrSessionConflict 保存会话时存储中的版本与读取时不一致, 即会话已被其他请求修改
+	ErrSessionConflict = errors.New("会话已被其他请求修改")
+	// ErrReplyTruncated 流式回答因超时或服务出错提前结束, 本轮对话不会写入历史记录
+	ErrReplyTruncated = errors.New("回答不完整, 未保存到历史记录")
+)
+
+// Session 会话的持久化内容
+type Session struct {
+	ID         string                `json:"id"`
+	System     string                `json:"system,omitempty"` // 系统提示词
+	History    []*easyai.ChatHistory `json:"history"`
+	Metadata   map[string]string     `json:"metadata,omitempty"`
+	Version    int64                 `json:"version"` // 每次保存加1, 用于乐观并发控制
+	UpdateTime int64                 `json:"update_time"`
+}
+
+// clone 深拷贝, 避免存储与调用方共享同一份历史记录
+func (self *Session) clone() *Session {
+	clone := *self
+	clone.History = make([]*easyai.ChatHistory, len(self.History))
+	for i, history := range self.History {
+		item := *history
+		clone.History[i] = &item
+	}
+	if self.Metadata != nil {
+		clone.Metadata = make(map[string]string, len(self.Metadata))
+		for key, value := range self.Metadata {
+			clone.Metadata[key] = value
+		}
+	}
+
+	return &clone
+}
+
+// MemoryStore 会话存储, Load不存在时返回nil
+// Save时session.Version需与存储中的版本一致(新会话为0), 否则返回ErrSessionConflict, 保存成功后session.Version加1
+type MemoryStore interface {
+	Load(ctx context.Context, id string) (*Session, error)
+	Save(ctx context.Context, session *Session) error
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionLister 可列出全部会话ID的存储, 用于批量处理, 如更换加密密钥
+type SessionLister interface {
+	SessionIDs(ctx context.Context) ([]string, error)
+}
+
+// Conversation 多轮对话, 自动在历史记录中追加每轮的输入与回复, 并通过MemoryStore持久化
+type Conversation struct {
+	ID         string
+	System     string            // 系统提示词, 作为请求的Tips
+	Metadata   map[string]string // 随会话保存的自定义信息
+	Model      string
+	MaxHistory int // 每次请求最多带上的历史记录条数, 为0时不限制
+
+	client  ChatHandler
+	store   MemoryStore
+	history []*easyai.ChatHistory
+	version int64
+	err     error
+	mu      sync.Mutex
+}
+
+// NewConversation 创建新的会话, store为nil时历史记录只保存在内存中
+func NewConversation(client ChatHandler, store MemoryStore) *Conversation {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return &Conversation{ID: hex.EncodeToString(id), Metadata: make(map[string]string), client: client, store: store}
+}
+
+// LoadConversation 从store加载会话, 不存在时创建ID为id的新会话
+func LoadConversation(ctx context.Context, client ChatHandler, store MemoryStore, id string) (*Conversation, error) {
+	session, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("加载会话失败, 原因: %w", err)
+	}
+
+	conversation := &Conversation{ID: id, Metadata: make(map[string]string), client: client, store: store}
+	if session != nil {
+		conversation.System, conversation.history, conversation.version = session.System, session.History, session.Version
+		if session.Metadata != nil {
+			conversation.Metadata = session.Metadata
+		}
+	}
+
+	return conversation, nil
+}
+
+// History 返回历史记录的副本
+func (self *Conversation) History() []*easyai.ChatHistory {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.session().History
+}
+
+// Send 发送一轮对话, 成功后将输入与回复追加到历史记录并保存
+func (self *Conversation) Send(ctx context.Context, message string) (*easyai.ChatResponse, error) {
+	request, turn := self.request(message, false)
+	resp, _, err := self.client.NormalChat(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = self.commit(ctx, turn, reply(resp.Content)); err != nil {
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+// Stream 以流式发起一轮对话, 完整接收后将输入与回复追加到历史记录并保存, 保存的错误通过Err获取
+// 中途取消时不保存本轮对话
+func (self *Conversation) Stream(ctx context.Context, message string) (<-chan *easyai.ChatResponse, error) {
+	self.mu.Lock()
+	self.err = nil
+	self.mu.Unlock()
+
+	request, turn := self.request(message, true)
+	stream, err := self.client.StreamChat(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	finished := false
+	return TapStream(ctx, stream, func(resp *easyai.ChatResponse) {
+		content.WriteString(resp.Content)
+		finished = resp.FinishReason != ""
+	}, func() {
+		if ctx.Err() != nil {
+			return
+		}
+		err := ErrReplyTruncated
+		if finished {
+			err = self.commit(context.WithoutCancel(ctx), turn, reply(content.String()))
+		}
+		self.mu.Lock()
+		self.err = err
+		self.mu.Unlock()
+	}), nil
+}
+
+// Err 最近一次Stream保存历史记录时的错误, 回答被截断时为ErrReplyTruncated, 每次Stream开始时重置
+func (self *Conversation) Err() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.err
+}
+
+// Save 保存系统提示词与自定义信息的修改
+func (self *Conversation) Save(ctx context.Context) error {
+	return self.commit(ctx)
+}
+
+// request 组装请求, 同时返回本轮用户输入的历史记录
+func (self *Conversation) request(message string, stream bool) (*easyai.ChatRequest, *easyai.ChatHistory) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	history := self.history
+	if self.MaxHistory > 0 && len(history) > self.MaxHistory {
+		history = history[len(history)-self.MaxHistory:]
+	}
+	request := &easyai.ChatRequest{
+		Model:   self.Model,
+		Stream:  stream,
+		Message: message,
+		History: append([]*easyai.ChatHistory(nil), history...),
+	}
+	if self.System != "" {
+		request.Tips = &easyai.ChatMessage{Role: easyai.IdSystem, Content: self.System}
+	}
+
+	return request, &easyai.ChatHistory{
+		ChatMessage: easyai.ChatMessage{Role: easyai.IdUser, Content: message},
+		CreateTime:  time.Now().Unix(),
+	}
+}
+
+func reply(content string) *easyai.ChatHistory {
+	return &easyai.ChatHistory{
+		ChatMessage: easyai.ChatMessage{Role: easyai.IdBot, Content: content},
+		CreateTime:  time.Now().Unix(),
+	}
+}
+
+// commit 追加历史记录并保存, 版本冲突时读取最新的记录, 在其后追加本轮对话后重试
+// 追加对话时以最新记录中的系统提示词与自定义信息为准, 只有Save会覆盖它们
+func (self *Conversation) commit(ctx context.Context, turns ...*easyai.ChatHistory) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.history = append(self.history, turns...)
+	if self.store == nil {
+		return nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		session := self.session()
+		err := self.store.Save(ctx, session)
+		if err == nil {
+			self.version = session.Version
+			return nil
+		}
+		if !errors.Is(err, ErrSessionConflict) || attempt >= maxConflictRetries {
+			return fmt.Errorf("保存会话失败, 原因: %w", err)
+		}
+
+		latest, err := self.store.Load(ctx, self.ID)
+		if err != nil {
+			return fmt.Errorf("加载会话失败, 原因: %w", err)
+		}
+		self.history, self.version = append([]*easyai.ChatHistory(nil), turns...), 0
+		if latest != nil {
+			self.history, self.version = append(latest.History, turns...), latest.Version
+			if len(turns) > 0 {
+				self.System, self.Metadata = latest.System, latest.Metadata
+				if self.Metadata == nil {
+					self.Metadata = make(map[string]string)
+				}
+			}
+		}
+	}
+}
+
+func (self *Conversation) session() *Session {
+	session := &Session{ID: self.ID, System: self.System, History: self.history, Metadata: self.Metadata, Version: self.version}
+
+	return session.clone()
+}
+
+// InMemoryStore 内存中的会话存储
+type InMemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{sessions: make(map[string]*Session)}
+}
+
+func (self *InMemoryStore) Load(ctx context.Context, id string) (*Session, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if session, ok := self.sessions[id]; ok {
+		return session.clone(), nil
+	}
+
+	return nil, nil
+}
+
+func (self *InMemoryStore) Save(ctx context.Context, session *Session) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var current int64
+	if stored, ok := self.sessions[session.ID]; ok {
+		current = stored.Version
+	}
+	if session.Version != current {
+		return ErrSessionConflict
+	}
+
+	session.Version++
+	session.UpdateTime = time.Now().Unix()
+	self.sessions[session.ID] = session.clone()
+
+	return nil
+}
+
+func (self *InMemoryStore) Delete(ctx context.Context, id string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	delete(self.sessions, id)
+
+	return nil
+}
+
+func (self *InMemoryStore) SessionIDs(ctx context.Context) ([]string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	ids := make([]string, 0, len(self.sessions))
+	for id := range self.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// JSONFileStore 每个会话保存为目录下的一个JSON文件, 版本检查只在同一进程内有效
+type JSONFileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewJSONFileStore(dir string) (*JSONFileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &JSONFileStore{dir: dir}, nil
+}
+
+func (self *JSONFileStore) Load(ctx context.Context, id string) (*Session, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.load(id)
+}
+
+func (self *JSONFileStore) load(id string) (*Session, error) {
+	content, err := os.ReadFile(self.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := new(Session)
+	if err = json.Unmarshal(content, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (self *JSONFileStore) Save(ctx context.Context, session *Session) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	stored, err := self.load(session.ID)
+	if err != nil {
+		return err
+	}
+	var current int64
+	if stored != nil {
+		current = stored.Version
+	}
+	if session.Version != current {
+		return ErrSessionConflict
+	}
+
+	clone := session.clone()
+	clone.Version++
+	clone.UpdateTime = time.Now().Unix()
+	content, err := json.Marshal(clone)
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名, 避免读到写了一半的内容
+	tmp, err := os.CreateTemp(self.dir, "session.*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), self.path(session.ID)); err != nil {
+		return err
+	}
+	session.Version, session.UpdateTime = clone.Version, clone.UpdateTime
+
+	return nil
+}
+
+func (self *JSONFileStore) Delete(ctx context.Context, id string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if err := os.Remove(self.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (self *JSONFileStore) SessionIDs(ctx context.Context) ([]string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	entries, err := os.ReadDir(self.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), ".json")
+		if !found || entry.IsDir() {
+			continue
+		}
+		if id, err := url.PathUnescape(name); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// path 会话ID转义后作为文件名, 避免包含路径分隔符
+func (self *JSONFileStore) path(id string) string {
+	return filepath.Join(self.dir, url.PathEscape(id)+".json")
+}
@@ -0,0 +1,252 @@
+package dataset
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"github.com/soryetong/go-easy-llm/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filter 筛选参与导出的消息与会话
+type Filter struct {
+	MinTurns int               // 最少的对话轮数, 一问一答为一轮, 为0时至少需要一轮
+	Roles    []easyai.RoleType // 保留的消息角色, 为空时保留user、assistant与system
+	Since    time.Time         // 只保留CreateTime不早于Since的消息, 为零值时不限制
+	Until    time.Time         // 只保留CreateTime早于Until的消息, 为零值时不限制
+}
+
+// Sample 一个会话整理后的训练样本
+type Sample struct {
+	ID               string               `json:"id"`
+	Messages         []easyai.ChatMessage `json:"messages"` // 以system开头(可选), 其后user与assistant交替, 以assistant结尾
+	Turns            int                  `json:"turns"`
+	Tokens           int                  `json:"tokens"`
+	PromptTokens     int                  `json:"prompt_tokens"`     // system与user消息的token数
+	CompletionTokens int                  `json:"completion_tokens"` // assistant消息的token数
+}
+
+// Stats 导出的统计信息
+type Stats struct {
+	Sessions    int     `json:"sessions"`
+	Filtered    int     `json:"filtered"`   // 轮数不足而丢弃的会话数
+	Duplicates  int     `json:"duplicates"` // 内容重复而丢弃的会话数
+	Train       int     `json:"train"`
+	Validation  int     `json:"validation"`
+	TotalTokens int     `json:"total_tokens"`
+	MinTokens   int     `json:"min_tokens"`
+	MaxTokens   int     `json:"max_tokens"`
+	AvgTokens   float64 `json:"avg_tokens"`
+}
+
+// Dataset 划分后的训练集与验证集
+type Dataset struct {
+	Train      []*Sample
+	Validation []*Sample
+	Stats      Stats
+}
+
+// Exporter 将保存的会话整理为微调数据集
+// 连续的同角色消息合并为一条, 开头的assistant消息与结尾的user消息被丢弃, 历史记录中的system消息并入系统提示词
+type Exporter struct {
+	Format      Format
+	Filter      Filter
+	Dedup       bool                  // 丢弃内容完全相同的样本
+	Validation  float64               // 验证集的比例, 如0.1, 按样本内容的哈希划分, 多次导出的结果相同
+	CountTokens func(text string) int // 为空时使用utils.EstimateTokens
+}
+
+func NewExporter(format Format) *Exporter {
+	return &Exporter{Format: format, Dedup: true}
+}
+
+// LoadSessions 读取存储中的全部会话, 存储需实现easyllm.SessionLister
+func LoadSessions(ctx context.Context, store easyllm.MemoryStore) ([]*easyllm.Session, error) {
+	lister, ok := store.(easyllm.SessionLister)
+	if !ok {
+		return nil, errors.New("存储不支持列出会话")
+	}
+	ids, err := lister.SessionIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*easyllm.Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := store.Load(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("读取会话%q失败, 原因: %w", id, err)
+		}
+		if session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+// Build 筛选、去重并划分样本
+func (self *Exporter) Build(sessions []*easyllm.Session) *Dataset {
+	dataset := &Dataset{Stats: Stats{Sessions: len(sessions)}}
+	seen := make(map[[sha256.Size]byte]bool)
+	for _, session := range sessions {
+		sample := self.sample(session)
+		if sample.Turns < max(self.Filter.MinTurns, 1) {
+			dataset.Stats.Filtered++
+			continue
+		}
+
+		sum := digest(sample.Messages)
+		if self.Dedup && seen[sum] {
+			dataset.Stats.Duplicates++
+			continue
+		}
+		seen[sum] = true
+
+		if float64(binary.BigEndian.Uint64(sum[:8])>>11)/(1<<53) < self.Validation {
+			dataset.Validation = append(dataset.Validation, sample)
+		} else {
+			dataset.Train = append(dataset.Train, sample)
+		}
+	}
+	dataset.Stats.count(dataset.Train, dataset.Validation)
+
+	return dataset
+}
+
+// Export 整理会话并在dir中写入train.jsonl, 有验证集时同时写入validation.jsonl
+func (self *Exporter) Export(sessions []*easyllm.Session, dir string) (*Dataset, error) {
+	dataset := self.Build(sessions)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建目录失败, 原因: %w", err)
+	}
+
+	if err := self.writeFile(filepath.Join(dir, "train.jsonl"), dataset.Train); err != nil {
+		return nil, err
+	}
+	if len(dataset.Validation) > 0 {
+		if err := self.writeFile(filepath.Join(dir, "validation.jsonl"), dataset.Validation); err != nil {
+			return nil, err
+		}
+	}
+
+	return dataset, nil
+}
+
+func (self *Exporter) writeFile(path string, samples []*Sample) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建文件失败, 原因: %w", err)
+	}
+	if err = Encode(file, self.Format, samples); err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	return file.Close()
+}
+
+// sample 按筛选条件整理会话中的消息
+func (self *Exporter) sample(session *easyllm.Session) *Sample {
+	sample := &Sample{ID: session.ID}
+	var system []string
+	if session.System != "" && self.keep(easyai.IdSystem) {
+		system = append(system, session.System)
+	}
+
+	var messages []easyai.ChatMessage
+	for _, history := range session.History {
+		if history == nil || strings.TrimSpace(history.Content) == "" || !self.keep(history.Role) || !self.inRange(history.CreateTime) {
+			continue
+		}
+		switch {
+		case history.Role == easyai.IdSystem:
+			system = append(system, history.Content)
+		case history.Role != easyai.IdUser && history.Role != easyai.IdBot:
+		case len(messages) > 0 && messages[len(messages)-1].Role == history.Role:
+			messages[len(messages)-1].Content += "\n\n" + history.Content
+		case len(messages) == 0 && history.Role == easyai.IdBot:
+		default:
+			messages = append(messages, history.ChatMessage)
+		}
+	}
+	if len(messages) > 0 && messages[len(messages)-1].Role == easyai.IdUser {
+		messages = messages[:len(messages)-1]
+	}
+	if len(messages) == 0 {
+		return sample
+	}
+
+	if len(system) > 0 {
+		sample.Messages = append(sample.Messages, easyai.ChatMessage{Role: easyai.IdSystem, Content: strings.Join(system, "\n\n")})
+	}
+	sample.Messages = append(sample.Messages, messages...)
+
+	count := self.CountTokens
+	if count == nil {
+		count = utils.EstimateTokens
+	}
+	for _, message := range sample.Messages {
+		tokens := count(message.Content)
+		if message.Role == easyai.IdBot {
+			sample.Turns++
+			sample.CompletionTokens += tokens
+		} else {
+			sample.PromptTokens += tokens
+		}
+	}
+	sample.Tokens = sample.PromptTokens + sample.CompletionTokens
+
+	return sample
+}
+
+func (self *Exporter) keep(role easyai.RoleType) bool {
+	return len(self.Filter.Roles) == 0 || slices.Contains(self.Filter.Roles, role)
+}
+
+// inRange 设置了时间范围时, 没有CreateTime的消息同样丢弃
+func (self *Exporter) inRange(createTime int64) bool {
+	if !self.Filter.Since.IsZero() && createTime < self.Filter.Since.Unix() {
+		return false
+	}
+
+	return self.Filter.Until.IsZero() || createTime > 0 && createTime < self.Filter.Until.Unix()
+}
+
+func (self *Stats) count(train, validation []*Sample) {
+	self.Train, self.Validation = len(train), len(validation)
+	for i, sample := range append(slices.Clip(train), validation...) {
+		if i == 0 || sample.Tokens < self.MinTokens {
+			self.MinTokens = sample.Tokens
+		}
+		self.MaxTokens = max(self.MaxTokens, sample.Tokens)
+		self.TotalTokens += sample.Tokens
+	}
+	if count := self.Train + self.Validation; count > 0 {
+		self.AvgTokens = float64(self.TotalTokens) / float64(count)
+	}
+}
+
+func digest(messages []easyai.ChatMessage) [sha256.Size]byte {
+	hash := sha256.New()
+	for _, message := range messages {
+		hash.Write([]byte(message.Role))
+		hash.Write([]byte{0})
+		hash.Write([]byte(message.Content))
+		hash.Write([]byte{0})
+	}
+
+	var sum [sha256.Size]byte
+	hash.Sum(sum[:0])
+
+	return sum
+}
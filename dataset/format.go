@@ -0,0 +1,83 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"io"
+)
+
+type Format string
+
+const (
+	FormatDashScope Format = "dashscope" // 百炼微调, 每行为{"messages":[{"role":"system","content":"..."},...]}
+	FormatOpenAI    Format = "openai"    // OpenAI对话微调, 与百炼相同的messages格式, assistant消息带weight
+	FormatShareGPT  Format = "sharegpt"  // 每行为{"system":"...","conversations":[{"from":"human","value":"..."},{"from":"gpt","value":"..."}]}
+)
+
+type openAIMessage struct {
+	Role    easyai.RoleType `json:"role"`
+	Content string          `json:"content"`
+	Weight  *int            `json:"weight,omitempty"`
+}
+
+type shareGPTMessage struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+type shareGPTSample struct {
+	System        string            `json:"system,omitempty"`
+	Conversations []shareGPTMessage `json:"conversations"`
+}
+
+// Encode 按格式将样本写为JSONL, 每行一个样本
+func Encode(w io.Writer, format Format, samples []*Sample) error {
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	for _, sample := range samples {
+		line, err := encodeSample(format, sample)
+		if err != nil {
+			return err
+		}
+		if err = encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+func encodeSample(format Format, sample *Sample) (interface{}, error) {
+	switch format {
+	case FormatDashScope, "":
+		return map[string][]easyai.ChatMessage{"messages": sample.Messages}, nil
+	case FormatOpenAI:
+		weight := 1
+		messages := make([]openAIMessage, len(sample.Messages))
+		for i, message := range sample.Messages {
+			messages[i] = openAIMessage{Role: message.Role, Content: message.Content}
+			if message.Role == easyai.IdBot {
+				messages[i].Weight = &weight
+			}
+		}
+		return map[string][]openAIMessage{"messages": messages}, nil
+	case FormatShareGPT:
+		line := shareGPTSample{}
+		for _, message := range sample.Messages {
+			switch message.Role {
+			case easyai.IdSystem:
+				line.System = message.Content
+			case easyai.IdUser:
+				line.Conversations = append(line.Conversations, shareGPTMessage{From: "human", Value: message.Content})
+			default:
+				line.Conversations = append(line.Conversations, shareGPTMessage{From: "gpt", Value: message.Content})
+			}
+		}
+		return line, nil
+	default:
+		return nil, fmt.Errorf("不支持的数据集格式%q", format)
+	}
+}
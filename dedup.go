@@ -0,0 +1,226 @@
+package easyllm
+
+import (
+	"context"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"sync"
+)
+
+// DedupMiddleware 合并并发的相同请求, 只向大模型发起一次调用并把结果分发给所有调用方
+// 流式调用在结束前加入的调用方同样会从第一个分片开始收到完整的结果
+// 所有调用方都取消后才会取消对大模型的调用
+func DedupMiddleware() Middleware {
+	return func(next ChatHandler) ChatHandler {
+		group := &dedupGroup{
+			next:    next,
+			normals: make(map[string]*normalFlight),
+			streams: make(map[string]*streamFlight),
+		}
+
+		return HandlerFuncs(group.normalChat, group.streamChat)
+	}
+}
+
+type dedupGroup struct {
+	next ChatHandler
+
+	mu      sync.Mutex
+	normals map[string]*normalFlight
+	streams map[string]*streamFlight
+}
+
+// flightRef 统计调用方数量, 全部离开后取消上游调用
+type flightRef struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+	detach  func() // 从dedupGroup中移除, 之后的相同请求会发起新的调用
+}
+
+func newFlightRef(ctx context.Context) flightRef {
+	flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	return flightRef{ctx: flightCtx, cancel: cancel}
+}
+
+type normalFlight struct {
+	flightRef
+	done  chan struct{}
+	resp  *easyai.ChatResponse
+	reply interface{}
+	err   error
+}
+
+func (self *dedupGroup) normalChat(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+	if request == nil {
+		return self.next.NormalChat(ctx, request)
+	}
+
+	key := CacheKey(ctx, request)
+	self.mu.Lock()
+	flight, ok := self.normals[key]
+	if !ok {
+		flight = &normalFlight{flightRef: newFlightRef(ctx), done: make(chan struct{})}
+		flight.detach = func() {
+			if self.normals[key] == flight {
+				delete(self.normals, key)
+			}
+		}
+		self.normals[key] = flight
+		go self.doNormal(flight, request)
+	}
+	flight.waiters++
+	self.mu.Unlock()
+
+	select {
+	case <-flight.done:
+		self.leave(&flight.flightRef)
+		if flight.resp == nil {
+			return nil, flight.reply, flight.err
+		}
+		resp := *flight.resp
+
+		return &resp, flight.reply, flight.err
+	case <-ctx.Done():
+		self.leave(&flight.flightRef)
+
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (self *dedupGroup) doNormal(flight *normalFlight, request *easyai.ChatRequest) {
+	defer flight.cancel()
+
+	flight.resp, flight.reply, flight.err = self.next.NormalChat(flight.ctx, request)
+
+	self.mu.Lock()
+	flight.detach()
+	self.mu.Unlock()
+	close(flight.done)
+}
+
+type streamFlight struct {
+	flightRef
+	ready  chan struct{} // 建立连接后关闭
+	err    error
+	chunks []*easyai.ChatResponse
+	done   bool
+	notify chan struct{} // 每收到一个分片关闭并替换, 用于唤醒订阅方
+}
+
+func (self *dedupGroup) streamChat(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+	if request == nil {
+		return self.next.StreamChat(ctx, request)
+	}
+
+	key := CacheKey(ctx, request)
+	self.mu.Lock()
+	flight, ok := self.streams[key]
+	if !ok {
+		flight = &streamFlight{flightRef: newFlightRef(ctx), ready: make(chan struct{}), notify: make(chan struct{})}
+		flight.detach = func() {
+			if self.streams[key] == flight {
+				delete(self.streams, key)
+			}
+		}
+		self.streams[key] = flight
+		go self.doStream(flight, request)
+	}
+	flight.waiters++
+	self.mu.Unlock()
+
+	select {
+	case <-flight.ready:
+	case <-ctx.Done():
+		self.leave(&flight.flightRef)
+
+		return nil, ctx.Err()
+	}
+	if flight.err != nil {
+		self.leave(&flight.flightRef)
+
+		return nil, flight.err
+	}
+
+	return self.subscribe(ctx, flight), nil
+}
+
+func (self *dedupGroup) doStream(flight *streamFlight, request *easyai.ChatRequest) {
+	defer flight.cancel()
+
+	stream, err := self.next.StreamChat(flight.ctx, request)
+	flight.err = err
+	close(flight.ready)
+
+	for err == nil {
+		resp, ok := <-stream
+		self.mu.Lock()
+		if ok {
+			flight.chunks = append(flight.chunks, resp)
+		} else {
+			flight.done = true
+			flight.detach()
+		}
+		close(flight.notify)
+		flight.notify = make(chan struct{})
+		self.mu.Unlock()
+
+		if !ok {
+			return
+		}
+	}
+
+	self.mu.Lock()
+	flight.detach()
+	self.mu.Unlock()
+}
+
+// subscribe 从第一个分片开始向调用方推送
+func (self *dedupGroup) subscribe(ctx context.Context, flight *streamFlight) <-chan *easyai.ChatResponse {
+	messageChan := make(chan *easyai.ChatResponse)
+	go func() {
+		defer close(messageChan)
+		defer self.leave(&flight.flightRef)
+
+		for index := 0; ; {
+			self.mu.Lock()
+			if index < len(flight.chunks) {
+				resp := *flight.chunks[index]
+				self.mu.Unlock()
+
+				select {
+				case messageChan <- &resp:
+					index++
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			if flight.done {
+				self.mu.Unlock()
+				return
+			}
+			notify := flight.notify
+			self.mu.Unlock()
+
+			select {
+			case <-notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messageChan
+}
+
+func (self *dedupGroup) leave(ref *flightRef) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	ref.waiters--
+	if ref.waiters == 0 {
+		ref.detach()
+		ref.cancel()
+	}
+}
@@ -1,6 +1,9 @@
 package easyai
 
-import "net/http"
+import (
+	"log/slog"
+	"net/http"
+)
 
 type RoleType string
 
@@ -24,7 +27,12 @@ type ClientConfig struct {
 	SecretKey string
 	baseURL   string
 
+	Credentials *CredentialPool // 配置后按策略从密钥池中选取凭证, 忽略Token、SecretId、SecretKey
+
 	HttpClient *http.Client
+
+	Logger *slog.Logger // 为空时不输出日志
+	Debug  bool         // 以Debug级别输出脱敏后的请求、响应内容
 }
 
 type ChatRequest struct {
@@ -33,6 +41,12 @@ type ChatRequest struct {
 	Message string         `json:"message"`           // 本轮对话用户输入的内容
 	History []*ChatHistory `json:"history,omitempty"` // 上下文历史记录
 	Tips    *ChatMessage   `json:"tips,omitempty"`
+
+	JSONMode bool `json:"json_mode,omitempty"` // 要求大模型只返回JSON, 仅部分服务商支持, 不支持时忽略
+
+	Examples      []*ChatExample `json:"examples,omitempty"`       // 少样本示例, 放在历史记录之前
+	ExampleMode   ExampleMode    `json:"example_mode,omitempty"`   // 示例的组装方式, 默认由服务商决定
+	ExampleTokens int            `json:"example_tokens,omitempty"` // 示例的token预算, 按与Message的相似度选取, 为0时全部使用
 }
 
 type ChatMessage struct {
@@ -51,6 +65,10 @@ type ChatHistory struct {
 }
 
 type ChatResponse struct {
-	Role    RoleType `json:"role"`
-	Content string   `json:"content"`
+	Role     RoleType `json:"role"`
+	Content  string   `json:"content"`
+	Provider string   `json:"provider,omitempty"` // 实际应答的服务方
+	Model    string   `json:"model,omitempty"`
+	// FinishReason 结束原因, 如stop、length; 流式调用只有正常结束时最后一个分片才会携带, 为空说明回答被截断
+	FinishReason string `json:"finish_reason,omitempty"`
 }
@@ -0,0 +1,237 @@
+package easyai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BalanceStrategy string
+
+const (
+	BalanceRoundRobin    BalanceStrategy = "round_robin"
+	BalanceLeastInFlight BalanceStrategy = "least_in_flight"
+	BalanceWeighted      BalanceStrategy = "weighted"
+
+	defaultEvictDuration = time.Minute
+)
+
+var ErrNoAvailableCredential = errors.New("没有可用的密钥")
+
+// Credential 一组调用凭证, 通义千问使用Token, 混元使用SecretId和SecretKey
+type Credential struct {
+	Token     string
+	SecretId  string
+	SecretKey string
+	Weight    int // 仅BalanceWeighted生效, 小于1时按1处理
+}
+
+type CredentialStats struct {
+	Key          string // 脱敏后的密钥标识
+	Requests     int64
+	Failures     int64
+	InFlight     int64
+	Evictions    int64
+	EvictedUntil time.Time
+	LastError    string
+}
+
+// CredentialPool 多个密钥的负载均衡池, 鉴权失败或额度不足的密钥会被临时剔除
+type CredentialPool struct {
+	Strategy      BalanceStrategy
+	EvictDuration time.Duration
+
+	mu      sync.Mutex
+	entries []*credentialEntry
+	next    int
+}
+
+type credentialEntry struct {
+	credential    *Credential
+	stats         CredentialStats
+	currentWeight int
+}
+
+func NewCredentialPool(strategy BalanceStrategy, credentials ...*Credential) *CredentialPool {
+	pool := &CredentialPool{Strategy: strategy, EvictDuration: defaultEvictDuration}
+	for _, credential := range credentials {
+		pool.entries = append(pool.entries, &credentialEntry{
+			credential: credential,
+			stats:      CredentialStats{Key: maskCredential(credential)},
+		})
+	}
+
+	return pool
+}
+
+func (self *CredentialPool) Stats() []*CredentialStats {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	stats := make([]*CredentialStats, 0, len(self.entries))
+	for _, entry := range self.entries {
+		item := entry.stats
+		stats = append(stats, &item)
+	}
+
+	return stats
+}
+
+func (self *CredentialPool) acquire() (*credentialEntry, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	now := time.Now()
+	var available []*credentialEntry
+	for i := range self.entries {
+		entry := self.entries[(self.next+i)%len(self.entries)]
+		if !now.Before(entry.stats.EvictedUntil) {
+			available = append(available, entry)
+		}
+	}
+	if len(available) == 0 {
+		return nil, ErrNoAvailableCredential
+	}
+
+	var picked *credentialEntry
+	switch self.Strategy {
+	case BalanceLeastInFlight:
+		picked = available[0]
+		for _, entry := range available[1:] {
+			if entry.stats.InFlight < picked.stats.InFlight {
+				picked = entry
+			}
+		}
+	case BalanceWeighted:
+		// 平滑加权轮询
+		total := 0
+		for _, entry := range available {
+			weight := max(entry.credential.Weight, 1)
+			total += weight
+			entry.currentWeight += weight
+			if picked == nil || entry.currentWeight > picked.currentWeight {
+				picked = entry
+			}
+		}
+		picked.currentWeight -= total
+	default:
+		picked = available[0]
+	}
+
+	self.next = (self.indexOf(picked) + 1) % len(self.entries)
+	picked.stats.Requests++
+	picked.stats.InFlight++
+
+	return picked, nil
+}
+
+// acquireCredential 再次占用指定的密钥, 密钥已被剔除时返回ErrNoAvailableCredential
+func (self *CredentialPool) acquireCredential(credential *Credential) (*credentialEntry, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for _, entry := range self.entries {
+		if entry.credential != credential {
+			continue
+		}
+		if time.Now().Before(entry.stats.EvictedUntil) {
+			return nil, ErrNoAvailableCredential
+		}
+		entry.stats.Requests++
+		entry.stats.InFlight++
+
+		return entry, nil
+	}
+
+	return nil, ErrNoAvailableCredential
+}
+
+func (self *CredentialPool) release(entry *credentialEntry, err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	entry.stats.InFlight--
+	if err == nil {
+		return
+	}
+
+	entry.stats.Failures++
+	entry.stats.LastError = err.Error()
+	if isCredentialErr(err) {
+		entry.stats.Evictions++
+		entry.stats.EvictedUntil = time.Now().Add(self.EvictDuration)
+	}
+}
+
+func (self *CredentialPool) indexOf(target *credentialEntry) int {
+	for i, entry := range self.entries {
+		if entry == target {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// 获取本次请求使用的凭证, 请求结束后需调用release归还
+func (self *ClientConfig) acquireCredential() (*Credential, func(err error), error) {
+	if self.Credentials == nil {
+		credential := &Credential{Token: self.Token, SecretId: self.SecretId, SecretKey: self.SecretKey}
+
+		return credential, func(err error) {}, nil
+	}
+
+	entry, err := self.Credentials.acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry.credential, func(err error) { self.Credentials.release(entry, err) }, nil
+}
+
+// acquireSameCredential 再次占用已获取过的密钥, 用于与提交时的密钥绑定的异步任务, 每次查询都计入统计与剔除
+func (self *ClientConfig) acquireSameCredential(credential *Credential) (func(err error), error) {
+	if self.Credentials == nil {
+		return func(err error) {}, nil
+	}
+
+	entry, err := self.Credentials.acquireCredential(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(err error) { self.Credentials.release(entry, err) }, nil
+}
+
+// credentialAttempts 一次调用最多尝试的密钥数量
+func (self *ClientConfig) credentialAttempts() int {
+	if self.Credentials == nil {
+		return 1
+	}
+
+	return max(len(self.Credentials.entries), 1)
+}
+
+// rotateCredential 密钥本身导致的失败换下一个密钥重试, 对调用方不可见
+func (self *ClientConfig) rotateCredential(ctx context.Context, err error) bool {
+	return self.Credentials != nil && isCredentialErr(err) && ctx.Err() == nil
+}
+
+// 鉴权失败、额度不足、限流均由密钥本身导致, 需要临时剔除
+func isCredentialErr(err error) bool {
+	return errors.Is(err, ErrAuth) || errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrRateLimited)
+}
+
+func maskCredential(credential *Credential) string {
+	key := credential.Token
+	if key == "" {
+		key = credential.SecretId
+	}
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+
+	return key[:4] + "****" + key[len(key)-4:]
+}
@@ -0,0 +1,55 @@
+package easyai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/utils"
+)
+
+type EmbeddingUsage struct {
+	TotalTokens int64 `json:"total_tokens"`
+}
+
+type EmbeddingResponse struct {
+	Model      string          `json:"model"`
+	Embeddings [][]float64     `json:"embeddings"` // 与输入的texts一一对应
+	Usage      *EmbeddingUsage `json:"usage"`
+}
+
+// EmbeddingClient 文本向量化
+type EmbeddingClient interface {
+	Embed(ctx context.Context, texts []string) (*EmbeddingResponse, error)
+}
+
+// embedBatchFunc 向量化一批文本, 返回的向量与batch一一对应
+type embedBatchFunc func(ctx context.Context, batch []string) ([][]float64, int64, error)
+
+// embedInBatches 按服务商单次请求的上限拆分texts, 合并结果并归一化向量
+func embedInBatches(ctx context.Context, model string, texts []string, batchSize int, embed embedBatchFunc) (*EmbeddingResponse, error) {
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("%w: texts不能为空", ErrInvalidRequest)
+	}
+
+	resp := &EmbeddingResponse{Model: model, Usage: new(EmbeddingUsage)}
+	for start := 0; start < len(texts); start += batchSize {
+		batch := texts[start:min(start+batchSize, len(texts))]
+		embeddings, tokens, err := embed(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(embeddings) != len(batch) {
+			return nil, errors.New("向量数量与输入的文本数量不一致")
+		}
+
+		for i, embedding := range embeddings {
+			if len(embedding) == 0 {
+				return nil, fmt.Errorf("第%d条文本的向量为空", start+i)
+			}
+			resp.Embeddings = append(resp.Embeddings, utils.Normalize(embedding))
+		}
+		resp.Usage.TotalTokens += tokens
+	}
+
+	return resp, nil
+}
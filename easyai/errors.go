@@ -0,0 +1,161 @@
+package easyai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 错误分类, 通过 errors.Is 判断, 与具体的大模型服务无关
+var (
+	ErrRateLimited     = errors.New("请求频率超出限制")
+	ErrQuotaExceeded   = errors.New("账户额度不足或已欠费")
+	ErrAuth            = errors.New("鉴权失败")
+	ErrContentFiltered = errors.New("内容未通过安全审核")
+	ErrContextLength   = errors.New("输入内容超出模型上下文长度")
+	ErrInvalidRequest  = errors.New("请求参数不合法")
+)
+
+// APIError 大模型服务返回的错误, 通过 errors.As 获取
+type APIError struct {
+	Provider   LLMType
+	StatusCode int
+	Code       string // 服务方的错误码, 如QWenResponseError.Code、HunYuanError.Code
+	Message    string
+	RequestId  string
+	Category   error  // 错误分类, 无法归类时为nil
+	Detail     string // 附加信息, 如响应体不是JSON时的解析错误
+}
+
+func (self *APIError) Error() string {
+	if self.Detail != "" {
+		return fmt.Sprintf("%s API错误, status: %d, message: %s, detail: %s",
+			self.Provider, self.StatusCode, self.Message, self.Detail)
+	}
+
+	return fmt.Sprintf("%s API错误, status: %d, code: %s, message: %s, request_id: %s",
+		self.Provider, self.StatusCode, self.Code, self.Message, self.RequestId)
+}
+
+func (self *APIError) Unwrap() error {
+	return self.Category
+}
+
+// IsTransient 判断错误是否为临时性错误, 重试同一服务可能成功
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Category == nil && (apiErr.StatusCode == 0 || apiErr.StatusCode >= http.StatusInternalServerError)
+	}
+
+	return !errors.Is(err, ErrInvalidRequest)
+}
+
+func newQWenError(statusCode int, respErr *QWenResponseError) *APIError {
+	return &APIError{
+		Provider:   ChatTypeQWen,
+		StatusCode: statusCode,
+		Code:       respErr.Code,
+		Message:    respErr.Message,
+		RequestId:  respErr.RequestId,
+		Category:   qwenErrorCategory(statusCode, respErr.Code, respErr.Message),
+	}
+}
+
+// parseQWenError 解析非200的响应体, 网关返回的HTML等非JSON内容按状态码归类
+func parseQWenError(statusCode int, body []byte) *APIError {
+	var respErr QWenResponseError
+	if err := json.Unmarshal(body, &respErr); err != nil {
+		return &APIError{
+			Provider:   ChatTypeQWen,
+			StatusCode: statusCode,
+			Message:    strings.TrimSpace(string(body)),
+			Category:   qwenErrorCategory(statusCode, "", ""),
+			Detail:     fmt.Sprintf("响应体不是JSON, 原因: %v", err),
+		}
+	}
+
+	return newQWenError(statusCode, &respErr)
+}
+
+func qwenErrorCategory(statusCode int, code, message string) error {
+	switch {
+	case code == "DataInspectionFailed", code == "data_inspection_failed":
+		return ErrContentFiltered
+	case code == "Arrearage":
+		return ErrQuotaExceeded
+	case strings.HasPrefix(code, "Throttling"), statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code == "InvalidApiKey", strings.HasPrefix(code, "AccessDenied"),
+		statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return ErrAuth
+	case strings.HasPrefix(code, "InvalidParameter") && isContextLengthMessage(message):
+		return ErrContextLength
+	case strings.HasPrefix(code, "InvalidParameter"), statusCode == http.StatusBadRequest:
+		return ErrInvalidRequest
+	}
+
+	return nil
+}
+
+func newHunYuanError(statusCode int, requestId string, respErr *HunYuanError) *APIError {
+	return &APIError{
+		Provider:   ChatTypeHunYuan,
+		StatusCode: statusCode,
+		Code:       respErr.Code,
+		Message:    respErr.Message,
+		RequestId:  requestId,
+		Category:   hunYuanErrorCategory(respErr.Code, respErr.Message),
+	}
+}
+
+func hunYuanErrorCategory(code, message string) error {
+	hasPrefix := func(prefixes ...string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(code, prefix) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	switch {
+	case strings.Contains(code, "Sensitive"), strings.Contains(code, "ContentRisk"), strings.Contains(code, "Moderation"),
+		strings.Contains(code, "IllegalDetected"):
+		return ErrContentFiltered
+	case hasPrefix("AuthFailure", "UnauthorizedOperation"):
+		return ErrAuth
+	case hasPrefix("RequestLimitExceeded", "LimitExceeded"):
+		return ErrRateLimited
+	case hasPrefix("ResourceInsufficient", "ResourceUnavailable", "FailedOperation.ServiceNotActivated", "FailedOperation.ServiceStop"):
+		return ErrQuotaExceeded
+	case hasPrefix("InvalidParameter", "MissingParameter", "UnknownParameter") && isContextLengthMessage(message):
+		return ErrContextLength
+	case hasPrefix("InvalidParameter", "MissingParameter", "UnknownParameter", "UnsupportedOperation"):
+		return ErrInvalidRequest
+	}
+
+	return nil
+}
+
+func isContextLengthMessage(message string) bool {
+	message = strings.ToLower(message)
+	for _, keyword := range []string{"input length", "too long", "context length", "maximum context", "长度", "超长"} {
+		if strings.Contains(message, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+package easyai
+
+import (
+	"fmt"
+	"github.com/soryetong/go-easy-llm/utils"
+	"sort"
+	"strings"
+)
+
+// ChatExample 少样本示例, 一问一答
+type ChatExample struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+type ExampleMode int
+
+const (
+	ExampleAuto   ExampleMode = iota // 默认以一问一答的对话发送, 服务商不允许时写入系统提示词
+	ExampleTurns                     // 以一问一答的对话发送
+	ExampleSystem                    // 写入系统提示词
+)
+
+// SelectExamples 按与message的相似度从高到低选取示例, 总token数不超过budget, 选中的示例保持原有的顺序
+// budget为0时全部返回
+func SelectExamples(message string, examples []*ChatExample, budget int) []*ChatExample {
+	if budget <= 0 {
+		return examples
+	}
+
+	scores := make([]float64, len(examples))
+	order := make([]int, len(examples))
+	for i, example := range examples {
+		scores[i], order[i] = utils.TextSimilarity(message, example.Input), i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	selected := make([]bool, len(examples))
+	for _, i := range order {
+		tokens := utils.EstimateTokens(examples[i].Input) + utils.EstimateTokens(examples[i].Output)
+		if tokens <= budget {
+			selected[i] = true
+			budget -= tokens
+		}
+	}
+
+	var result []*ChatExample
+	for i, example := range examples {
+		if selected[i] {
+			result = append(result, example)
+		}
+	}
+
+	return result
+}
+
+// chatMessages 依次组装提示词、示例、历史记录与本轮的输入
+// alternate为true时服务商要求user与assistant严格交替, 历史记录不以user开头时示例改为写入提示词
+func chatMessages(request *ChatRequest, alternate bool) []*ChatMessage {
+	examples := SelectExamples(request.Message, request.Examples, request.ExampleTokens)
+	mode := request.ExampleMode
+	if mode == ExampleAuto {
+		mode = ExampleTurns
+		if alternate && len(request.History) > 0 && request.History[0].Role != IdUser {
+			mode = ExampleSystem
+		}
+	}
+
+	var messages []*ChatMessage
+	tips := request.Tips
+	if len(examples) > 0 && mode == ExampleSystem {
+		var builder strings.Builder
+		if tips != nil && tips.Content != "" {
+			builder.WriteString(tips.Content)
+			builder.WriteString("\n\n")
+		}
+		builder.WriteString("参考示例:")
+		for _, example := range examples {
+			_, _ = fmt.Fprintf(&builder, "\n\n输入: %s\n输出: %s", example.Input, example.Output)
+		}
+		// 提示词保留调用方指定的角色
+		role := IdSystem
+		if tips != nil {
+			role = tips.Role
+		}
+		tips = &ChatMessage{Role: role, Content: builder.String()}
+	}
+	if tips != nil {
+		messages = append(messages, tips)
+	}
+
+	if mode == ExampleTurns {
+		for _, example := range examples {
+			messages = append(messages, &ChatMessage{Role: IdUser, Content: example.Input}, &ChatMessage{Role: IdBot, Content: example.Output})
+		}
+	}
+	for _, history := range request.History {
+		messages = append(messages, &ChatMessage{Role: history.Role, Content: history.Content})
+	}
+
+	return append(messages, &ChatMessage{Role: IdUser, Content: request.Message})
+}
@@ -2,18 +2,12 @@ package easyai
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/soryetong/go-easy-llm/utils"
 	"io"
-	"net/http"
-	"os"
+	"log/slog"
 	"strings"
-	"time"
 )
 
 type HunYuanRegionType string
@@ -98,101 +92,155 @@ type HunYuanChat struct {
 
 	request     *ChatRequest
 	paramsClone *HunYuanParameters
+	credential  *Credential
+	log         *callLog
 }
 
 func (self *HunYuanChat) SetCustomParams(params interface{}) {
 	marshal, err := json.Marshal(params)
 	if err != nil {
-		errMsg := fmt.Errorf("混元大模型-设置全局参数-序列化失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+		self.Config.getLogger().Error("set custom params failed", slog.String("provider", string(ChatTypeHunYuan)),
+			slog.Any("error", fmt.Errorf("混元大模型-设置全局参数-序列化失败: { %w }", err)))
 
 		return
 	}
 
 	self.Params = &HunYuanParameters{}
 	if err = json.Unmarshal(marshal, self.Params); err != nil {
-		errMsg := fmt.Errorf("混元大模型-设置全局参数-反序列化失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+		self.Config.getLogger().Error("set custom params failed", slog.String("provider", string(ChatTypeHunYuan)),
+			slog.Any("error", fmt.Errorf("混元大模型-设置全局参数-反序列化失败: { %w }", err)))
 
 		return
 	}
 }
 
-func (self *HunYuanChat) NormalChat(ctx context.Context, request *ChatRequest) (*ChatResponse, interface{}, error) {
-	if err := self.checkAndSetRequest(request); err != nil {
-		errMsg := fmt.Errorf("调用混元API-参数不合法: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+func (self *HunYuanChat) NormalChat(ctx context.Context, request *ChatRequest) (resp *ChatResponse, reply interface{}, err error) {
+	for attempt := 0; attempt < self.Config.credentialAttempts(); attempt++ {
+		chat, release, sessionErr := self.session()
+		if sessionErr != nil {
+			// 其余的密钥都已被剔除时返回上一个密钥的错误
+			if attempt > 0 {
+				return nil, nil, err
+			}
+			return nil, nil, sessionErr
+		}
 
-		return nil, nil, errMsg
+		resp, reply, err = chat.normalChat(ctx, request)
+		release(err)
+		chat.log.done(ctx, err)
+		if !self.Config.rotateCredential(ctx, err) {
+			break
+		}
 	}
 
-	respBody, err := self.doHttpRequest()
-	defer respBody.Close()
+	return resp, reply, err
+}
+
+// StreamChat 建立连接时密钥失败会换下一个密钥重试, 流开始之后的错误无法重试
+func (self *HunYuanChat) StreamChat(ctx context.Context, request *ChatRequest) (messageChan <-chan *ChatResponse, err error) {
+	for attempt := 0; attempt < self.Config.credentialAttempts(); attempt++ {
+		chat, release, sessionErr := self.session()
+		if sessionErr != nil {
+			if attempt > 0 {
+				return nil, err
+			}
+			return nil, sessionErr
+		}
+
+		if messageChan, err = chat.streamChat(ctx, request, release); err == nil {
+			return messageChan, nil
+		}
+		release(err)
+		chat.log.done(ctx, err)
+		if !self.Config.rotateCredential(ctx, err) {
+			break
+		}
+	}
+
+	return nil, err
+}
+
+// 每次调用使用独立的会话, 保证并发调用互不影响
+func (self *HunYuanChat) session() (*HunYuanChat, func(err error), error) {
+	log := newCallLog(self.Config, ChatTypeHunYuan)
+	credential, release, err := self.Config.acquireCredential()
 	if err != nil {
-		errMsg := fmt.Errorf("调用混元API失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+		errMsg := fmt.Errorf("调用混元API-获取密钥失败: { %w }", err)
+		log.done(context.Background(), errMsg)
 
 		return nil, nil, errMsg
 	}
 
-	respByte, err := io.ReadAll(respBody)
+	return &HunYuanChat{Config: self.Config, Params: self.Params, credential: credential, log: log}, release, nil
+}
+
+func (self *HunYuanChat) normalChat(ctx context.Context, request *ChatRequest) (*ChatResponse, interface{}, error) {
+	if err := self.checkAndSetRequest(request); err != nil {
+		return nil, nil, fmt.Errorf("调用混元API-参数不合法: { %w }", err)
+	}
+
+	respBody, err := self.doHttpRequest(ctx)
 	if err != nil {
-		errMsg := fmt.Errorf("调用混元API-解析响应数据失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+		return nil, nil, fmt.Errorf("调用混元API失败: { %w }", err)
+	}
+	defer respBody.Close()
 
-		return nil, nil, errMsg
+	respByte, err := io.ReadAll(respBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("调用混元API-解析响应数据失败: { %w }", err)
 	}
+	self.log.dump(ctx, "llm response", respByte)
 
 	var output = new(HunYuanResponse)
 	if err = json.Unmarshal(respByte, &output); err != nil {
-		errMsg := fmt.Errorf("调用混元API-结果反序列化失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
-
-		return nil, nil, errMsg
+		return nil, nil, fmt.Errorf("调用混元API-结果反序列化失败: { %w }", err)
 	}
+	self.log.requestId = output.Response.RequestId
 
 	if output.Response.Error != nil {
-		errMsg := fmt.Errorf("调用混元API失败: %s", output.Response.Error.Message)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
-
-		return nil, nil, errMsg
+		return nil, nil, newHunYuanError(self.log.status, output.Response.RequestId, output.Response.Error)
 	}
 
-	respMsg := new(ChatResponse)
+	respMsg := &ChatResponse{Provider: string(ChatTypeHunYuan), Model: self.paramsClone.Model}
 	if len(output.Response.Choices) > 0 {
 		respMsg.Role = output.Response.Choices[0].Message.Role
 		respMsg.Content = output.Response.Choices[0].Message.Content
+		respMsg.FinishReason = output.Response.Choices[0].FinishReason
 	}
 
 	return respMsg, output, nil
 }
 
-func (self *HunYuanChat) StreamChat(ctx context.Context, request *ChatRequest) (<-chan *ChatResponse, error) {
-	request.Stream = true
+func (self *HunYuanChat) streamChat(ctx context.Context, request *ChatRequest, release func(err error)) (<-chan *ChatResponse, error) {
+	if request != nil {
+		request.Stream = true
+	}
 	if err := self.checkAndSetRequest(request); err != nil {
-		errMsg := fmt.Errorf("调用混元API-参数不合法: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
-
-		return nil, errMsg
+		return nil, fmt.Errorf("调用混元API-参数不合法: { %w }", err)
 	}
 
-	respBody, err := self.doHttpRequest()
+	respBody, err := self.doHttpRequest(ctx)
 	if err != nil {
-		errMsg := fmt.Errorf("调用混元API失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
-
-		return nil, errMsg
+		return nil, fmt.Errorf("调用混元API失败: { %w }", err)
 	}
 
+	model := self.paramsClone.Model
 	messageChan := make(chan *ChatResponse)
 	go func() {
+		var streamErr error
+		defer func() {
+			release(streamErr)
+			self.log.done(ctx, streamErr)
+		}()
+		defer respBody.Close()
 		info := ""
 		reader := bufio.NewReader(respBody)
 		for {
 			line, readErr := reader.ReadString('\n')
 			if readErr != nil {
-				_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n "+
-					"  流式解析数据结束, 原因: { %v } \n\n", readErr)
+				if readErr != io.EOF {
+					streamErr = fmt.Errorf("调用混元API-流式解析数据失败: { %w }", readErr)
+				}
 				close(messageChan)
 				return
 			}
@@ -201,34 +249,41 @@ func (self *HunYuanChat) StreamChat(ctx context.Context, request *ChatRequest) (
 				line = line[:len(line)-1]
 			}
 			if len(line) > 5 && line[:5] == "data:" {
+				self.log.dump(ctx, "llm stream chunk", []byte(line[5:]))
 				var result HunYuanResponseStreamData
 				_ = json.Unmarshal([]byte(line[5:]), &result)
+				self.log.requestId = result.RequestId
 				if result.Error != nil {
-					errMsg := fmt.Errorf("调用混元API失败: %s", result.Error.Message)
-					_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
-
+					streamErr = newHunYuanError(self.log.status, result.RequestId, result.Error)
 					close(messageChan)
 					return
 				}
 
 				for _, choice := range result.Choices {
-					if choice.Delta.Role == IdBot && choice.Delta.Content != info {
-						respMsg := new(ChatResponse)
+					if choice.Delta.Role == IdBot && (choice.Delta.Content != info || choice.FinishReason != "") {
+						respMsg := &ChatResponse{Provider: string(ChatTypeHunYuan), Model: model}
 						respMsg.Role = choice.Delta.Role
 						respMsg.Content = choice.Delta.Content
-						messageChan <- respMsg
+						respMsg.FinishReason = choice.FinishReason
+						select {
+						case messageChan <- respMsg:
+						case <-ctx.Done():
+							streamErr = ctx.Err()
+							close(messageChan)
+							return
+						}
 					}
 				}
 			}
 		}
 	}()
 
-	return messageChan, err
+	return messageChan, nil
 }
 
 func (self *HunYuanChat) checkAndSetRequest(request *ChatRequest) error {
 	if request == nil || request.Message == "" {
-		return errors.New("message不能为空")
+		return fmt.Errorf("%w: message不能为空", ErrInvalidRequest)
 	}
 
 	self.request = new(ChatRequest)
@@ -243,6 +298,7 @@ func (self *HunYuanChat) cloneParams() {
 	self.setParamsModel()
 	self.setParamsInput()
 	self.setParamsParameters()
+	self.log.model = self.paramsClone.Model
 }
 
 func (self *HunYuanChat) setParamsModel() {
@@ -266,32 +322,27 @@ func (self *HunYuanChat) setParamsInput() {
 			self.paramsClone.Messages = append(self.paramsClone.Messages, message)
 		}
 	}
-	self.paramsClone.Messages = append(self.paramsClone.Messages, &ChatMessageUpper{
-		Role:    IdUser,
-		Content: self.request.Message,
-	})
-	if self.request.Tips != nil {
+	// 混元要求user与assistant交替出现, 提示词固定为system
+	for i, message := range chatMessages(self.request, true) {
+		role := message.Role
+		if i == 0 && self.request.Tips != nil {
+			role = IdSystem
+		}
 		self.paramsClone.Messages = append(self.paramsClone.Messages, &ChatMessageUpper{
-			Role:    IdSystem,
-			Content: self.request.Tips.Content,
+			Role:    role,
+			Content: message.Content,
 		})
 	}
-
-	if len(self.request.History) > 0 {
-		for _, history := range self.request.History {
-			self.paramsClone.Messages = append(self.paramsClone.Messages, &ChatMessageUpper{
-				Role:    history.Role,
-				Content: history.Content,
-			})
-		}
-	}
 }
 
 func (self *HunYuanChat) setParamsParameters() {
 	if self.Params.Model != "" {
-		self.paramsClone = self.Params
+		// 全局参数为共享数据, 拷贝后再使用, 同时保留本次请求组装的消息
+		params := *self.Params
+		params.Messages = self.paramsClone.Messages
+		self.paramsClone = &params
 	} else {
-		self.paramsClone.Version = "2023-09-01"
+		self.paramsClone.Version = HunYuanDefaultVersion
 		self.paramsClone.Language = "zh-CN"
 	}
 
@@ -301,7 +352,7 @@ func (self *HunYuanChat) setParamsParameters() {
 	}
 }
 
-func (self *HunYuanChat) doHttpRequest() (respBody io.ReadCloser, errMsg error) {
+func (self *HunYuanChat) doHttpRequest(ctx context.Context) (respBody io.ReadCloser, errMsg error) {
 	respBody = nil
 	xTcVersion := self.paramsClone.Version
 	language := self.paramsClone.Language
@@ -314,75 +365,41 @@ func (self *HunYuanChat) doHttpRequest() (respBody io.ReadCloser, errMsg error)
 		return
 	}
 
-	req, err := http.NewRequest("POST", HunYuanBaseUrl, bytes.NewReader(jsonBody))
+	self.log.dump(ctx, "llm request", jsonBody)
+
+	req, err := newHunYuanRequest(ctx, self.credential, HunYuanDefaultAction, xTcVersion, language, "", jsonBody)
 	if err != nil {
 		errMsg = fmt.Errorf("构造http请求失败, 原因: %w", err)
 		return
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", self.getAuthorization(string(jsonBody)))
-	req.Header.Set("X-TC-Action", HunYuanDefaultAction)
-	req.Header.Set("X-TC-Version", xTcVersion)
-	req.Header.Set("X-TC-Language", language)
-	req.Header.Set("Host", HunYuanHost)
-	req.Header.Set("X-TC-Timestamp", fmt.Sprintf("%d", time.Now().Unix()))
-
 	resp, err := self.Config.HttpClient.Do(req)
 	if err != nil {
 		errMsg = fmt.Errorf("http请求失败, 原因: %w", err)
 		return
 	}
 
-	respBody = resp.Body
+	self.log.status = resp.StatusCode
+	if self.request.Stream && !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// 流式请求失败时返回的是普通的JSON结果
+		defer resp.Body.Close()
+		var output HunYuanResponse
+		b, _ := io.ReadAll(resp.Body)
+		self.log.dump(ctx, "llm response", b)
+		if err = json.Unmarshal(b, &output); err != nil {
+			errMsg = fmt.Errorf("http结果序列化失败, 原因: %v", err)
+			return
+		}
 
-	return
-}
+		self.log.requestId = output.Response.RequestId
+		if output.Response.Error == nil {
+			output.Response.Error = &HunYuanError{Message: "流式响应格式不正确"}
+		}
+		errMsg = newHunYuanError(resp.StatusCode, output.Response.RequestId, output.Response.Error)
+		return
+	}
 
-func (self *HunYuanChat) getAuthorization(payload string) (authorization string) {
-	algorithm := "TC3-HMAC-SHA256"
-	timestamp := time.Now().Unix()
-	service := "hunyuan"
-
-	// 拼接canonical请求参数
-	httpRequestMethod := "POST"
-	canonicalURI := "/"
-	canonicalQueryString := ""
-	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-tc-action:%s\n",
-		"application/json", HunYuanHost, strings.ToLower(HunYuanDefaultAction))
-	signedHeaders := "content-type;host;x-tc-action"
-	hashedRequestPayload := utils.Sha256hex(payload)
-	canonicalRequest := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
-		httpRequestMethod,
-		canonicalURI,
-		canonicalQueryString,
-		canonicalHeaders,
-		signedHeaders,
-		hashedRequestPayload)
-
-	// 构建sign签名
-	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
-	credentialScope := fmt.Sprintf("%s/%s/tc3_request", date, service)
-	hashedCanonicalRequest := utils.Sha256hex(canonicalRequest)
-	string2sign := fmt.Sprintf("%s\n%d\n%s\n%s",
-		algorithm,
-		timestamp,
-		credentialScope,
-		hashedCanonicalRequest)
-
-	// 签名字符串加密
-	secretDate := utils.HmacSha256(date, "TC3"+self.Config.SecretKey)
-	secretService := utils.HmacSha256(service, secretDate)
-	secretSigning := utils.HmacSha256("tc3_request", secretService)
-	signature := hex.EncodeToString([]byte(utils.HmacSha256(string2sign, secretSigning)))
-
-	// 组装authorization
-	authorization = fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
-		algorithm,
-		self.Config.SecretId,
-		credentialScope,
-		signedHeaders,
-		signature)
+	respBody = resp.Body
 
 	return
 }
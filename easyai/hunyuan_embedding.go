@@ -0,0 +1,86 @@
+package easyai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	EmbeddingModelHunYuan = "hunyuan-embedding"
+
+	HunYuanEmbeddingAction = "GetEmbedding"
+
+	hunYuanEmbeddingBatchSize = 200 // InputList最多200条
+)
+
+type HunYuanEmbeddingParameters struct {
+	InputList []string `json:"InputList"`
+}
+
+type HunYuanEmbeddingResponse struct {
+	Response HunYuanEmbeddingResponseData `json:"Response"`
+}
+
+type HunYuanEmbeddingResponseData struct {
+	Data      []*HunYuanEmbeddingData `json:"Data"`
+	Usage     *HunYuanEmbeddingUsage  `json:"Usage"`
+	RequestId string                  `json:"RequestId"`
+}
+
+type HunYuanEmbeddingData struct {
+	Embedding []float64 `json:"Embedding"`
+	Index     int       `json:"Index"`
+	Object    string    `json:"Object"`
+}
+
+type HunYuanEmbeddingUsage struct {
+	PromptTokens int64 `json:"PromptTokens"`
+	TotalTokens  int64 `json:"TotalTokens"`
+}
+
+// HunYuanEmbedding 腾讯混元文本向量, 固定输出1024维
+type HunYuanEmbedding struct {
+	Config *ClientConfig
+}
+
+func (self *HunYuanEmbedding) Embed(ctx context.Context, texts []string) (*EmbeddingResponse, error) {
+	return embedInBatches(ctx, EmbeddingModelHunYuan, texts, hunYuanEmbeddingBatchSize, self.embedBatch)
+}
+
+func (self *HunYuanEmbedding) embedBatch(ctx context.Context, batch []string) (embeddings [][]float64, tokens int64, errMsg error) {
+	log := newCallLog(self.Config, ChatTypeHunYuan)
+	log.model = EmbeddingModelHunYuan
+	defer func() { log.done(ctx, errMsg) }()
+
+	credential, release, err := self.Config.acquireCredential()
+	if err != nil {
+		return nil, 0, fmt.Errorf("调用混元向量API-获取密钥失败: { %w }", err)
+	}
+	defer func() { release(errMsg) }()
+
+	jsonBody, err := json.Marshal(&HunYuanEmbeddingParameters{InputList: batch})
+	if err != nil {
+		return nil, 0, fmt.Errorf("调用混元向量API-序列化请求参数失败: { %w }", err)
+	}
+
+	var output HunYuanEmbeddingResponse
+	err = doHunYuanJSONRequest(ctx, self.Config, log, credential, HunYuanEmbeddingAction, "", jsonBody, &output)
+	if err != nil {
+		return nil, 0, fmt.Errorf("调用混元向量API失败: { %w }", err)
+	}
+
+	// 按Index还原输入顺序
+	embeddings = make([][]float64, len(batch))
+	for _, data := range output.Response.Data {
+		if data.Index < 0 || data.Index >= len(batch) {
+			return nil, 0, fmt.Errorf("调用混元向量API-Index越界: %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	if output.Response.Usage != nil {
+		tokens = output.Response.Usage.TotalTokens
+	}
+
+	return embeddings, tokens, nil
+}
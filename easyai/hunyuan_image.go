@@ -0,0 +1,157 @@
+package easyai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	HunYuanImageSubmitAction = "SubmitHunyuanImageJob"
+	HunYuanImageQueryAction  = "QueryHunyuanImageJob"
+)
+
+type HunYuanImageParameters struct {
+	Prompt         string `json:"Prompt"`
+	NegativePrompt string `json:"NegativePrompt,omitempty"`
+	Style          string `json:"Style,omitempty"`
+	Resolution     string `json:"Resolution,omitempty"` // 宽:高
+	Num            int    `json:"Num,omitempty"`
+}
+
+type HunYuanImageSubmitResponse struct {
+	Response struct {
+		JobId     string `json:"JobId"`
+		RequestId string `json:"RequestId"`
+	} `json:"Response"`
+}
+
+type HunYuanImageQueryResponse struct {
+	Response struct {
+		JobStatusCode string   `json:"JobStatusCode"` // 1:等待中 2:运行中 4:处理失败 5:处理完成
+		JobStatusMsg  string   `json:"JobStatusMsg"`
+		JobErrorCode  string   `json:"JobErrorCode"`
+		JobErrorMsg   string   `json:"JobErrorMsg"`
+		ResultImage   []string `json:"ResultImage"`
+		RevisedPrompt []string `json:"RevisedPrompt"`
+		RequestId     string   `json:"RequestId"`
+	} `json:"Response"`
+}
+
+// HunYuanImage 腾讯混元生图
+type HunYuanImage struct {
+	Config *ClientConfig
+	Region HunYuanRegionType // 为空时使用ap-guangzhou
+}
+
+func (self *HunYuanImage) SubmitImage(ctx context.Context, request *ImageRequest) (task *ImageTask, errMsg error) {
+	if err := checkImageRequest(request); err != nil {
+		return nil, fmt.Errorf("调用混元生图API-参数不合法: { %w }", err)
+	}
+
+	params := &HunYuanImageParameters{
+		Prompt:         request.Prompt,
+		NegativePrompt: request.NegativePrompt,
+		Style:          request.Style,
+		Num:            request.Count,
+	}
+	if request.Size != "" {
+		width, height, err := parseImageSize(request.Size)
+		if err != nil {
+			return nil, fmt.Errorf("调用混元生图API-参数不合法: { %w }", err)
+		}
+		params.Resolution = width + ":" + height
+	}
+
+	log := newCallLog(self.Config, ChatTypeHunYuan)
+	defer func() { log.done(ctx, errMsg) }()
+
+	credential, release, err := self.Config.acquireCredential()
+	if err != nil {
+		return nil, fmt.Errorf("调用混元生图API-获取密钥失败: { %w }", err)
+	}
+	defer func() { release(errMsg) }()
+
+	jsonBody, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("调用混元生图API-序列化请求参数失败: { %w }", err)
+	}
+
+	var output HunYuanImageSubmitResponse
+	err = doHunYuanJSONRequest(ctx, self.Config, log, credential, HunYuanImageSubmitAction, self.region(), jsonBody, &output)
+	if err != nil {
+		return nil, fmt.Errorf("调用混元生图API失败: { %w }", err)
+	}
+	if output.Response.JobId == "" {
+		return nil, fmt.Errorf("调用混元生图API-未返回JobId")
+	}
+
+	jobId := output.Response.JobId
+	task = &ImageTask{TaskId: jobId, Provider: ChatTypeHunYuan}
+	task.query = func(ctx context.Context) (*ImageResult, error) {
+		release, err := self.Config.acquireSameCredential(credential)
+		if err != nil {
+			return nil, fmt.Errorf("调用混元生图API-获取密钥失败: { %w }", err)
+		}
+		result, err := self.queryImage(ctx, credential, jobId)
+		release(err)
+
+		return result, err
+	}
+
+	return task, nil
+}
+
+func (self *HunYuanImage) QueryImage(ctx context.Context, taskId string) (result *ImageResult, errMsg error) {
+	credential, release, err := self.Config.acquireCredential()
+	if err != nil {
+		return nil, fmt.Errorf("调用混元生图API-获取密钥失败: { %w }", err)
+	}
+	defer func() { release(errMsg) }()
+
+	return self.queryImage(ctx, credential, taskId)
+}
+
+// queryImage 任务与提交时的密钥绑定, 查询需使用同一个密钥
+func (self *HunYuanImage) queryImage(ctx context.Context, credential *Credential, jobId string) (result *ImageResult, errMsg error) {
+	log := newCallLog(self.Config, ChatTypeHunYuan)
+	defer func() { log.done(ctx, errMsg) }()
+
+	jsonBody, _ := json.Marshal(map[string]string{"JobId": jobId})
+	var output HunYuanImageQueryResponse
+	err := doHunYuanJSONRequest(ctx, self.Config, log, credential, HunYuanImageQueryAction, self.region(), jsonBody, &output)
+	if err != nil {
+		return nil, fmt.Errorf("调用混元生图API-查询任务失败: { %w }", err)
+	}
+
+	result = &ImageResult{Provider: string(ChatTypeHunYuan), TaskId: jobId}
+	switch output.Response.JobStatusCode {
+	case "1":
+		result.Status = ImageTaskPending
+	case "2":
+		result.Status = ImageTaskRunning
+	case "5":
+		result.Status = ImageTaskSucceeded
+		result.URLs = output.Response.ResultImage
+	default:
+		result.Status = ImageTaskFailed
+		respErr := &HunYuanError{Code: output.Response.JobErrorCode, Message: output.Response.JobErrorMsg}
+		if respErr.Message == "" {
+			respErr.Message = output.Response.JobStatusMsg
+		}
+
+		return result, fmt.Errorf("调用混元生图API-任务失败: { %w }",
+			newHunYuanError(http.StatusOK, output.Response.RequestId, respErr))
+	}
+
+	return result, nil
+}
+
+func (self *HunYuanImage) region() HunYuanRegionType {
+	if self.Region == "" {
+		return HunYuanRegionGuangZhou
+	}
+
+	return self.Region
+}
@@ -0,0 +1,131 @@
+package easyai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultImagePollInterval    = time.Second
+	defaultImageMaxPollInterval = 10 * time.Second
+)
+
+type ImageTaskStatus string
+
+const (
+	ImageTaskPending   ImageTaskStatus = "PENDING"
+	ImageTaskRunning   ImageTaskStatus = "RUNNING"
+	ImageTaskSucceeded ImageTaskStatus = "SUCCEEDED"
+	ImageTaskFailed    ImageTaskStatus = "FAILED"
+)
+
+type ImageRequest struct {
+	Model          string `json:"model"`           // 混元不需要指定模型
+	Prompt         string `json:"prompt"`          // 正向提示词
+	NegativePrompt string `json:"negative_prompt"` // 反向提示词
+	Size           string `json:"size"`            // 宽*高, 例如1024*1024, 为空时使用服务端默认值
+	Count          int    `json:"count"`           // 生成的图片数量, 为0时使用服务端默认值
+	Style          string `json:"style"`           // 风格, 取值参考各服务商文档
+}
+
+type ImageResult struct {
+	Provider string          `json:"provider"`
+	Model    string          `json:"model,omitempty"`
+	TaskId   string          `json:"task_id"`
+	Status   ImageTaskStatus `json:"status"`
+	URLs     []string        `json:"urls,omitempty"` // 生成成功后的图片地址
+}
+
+func (self *ImageResult) finished() bool {
+	return self.Status == ImageTaskSucceeded || self.Status == ImageTaskFailed
+}
+
+// ImageClient 文生图, 服务商均为异步任务: 提交后轮询任务状态获取结果
+type ImageClient interface {
+	SubmitImage(ctx context.Context, request *ImageRequest) (*ImageTask, error)
+	QueryImage(ctx context.Context, taskId string) (*ImageResult, error)
+}
+
+// ImageTask 已提交的文生图任务, 可自行调用Query轮询, 或调用Wait阻塞等待结果
+type ImageTask struct {
+	TaskId   string
+	Provider LLMType
+	Model    string
+
+	PollInterval    time.Duration // 首次轮询间隔, 之后按1.5倍递增, 零值为1秒
+	MaxPollInterval time.Duration // 轮询间隔上限, 零值为10秒
+
+	query func(ctx context.Context) (*ImageResult, error) // 每次查询重新占用提交任务时的密钥
+}
+
+// Query 查询一次任务状态
+func (self *ImageTask) Query(ctx context.Context) (*ImageResult, error) {
+	return self.query(ctx)
+}
+
+// Wait 轮询直到任务结束或ctx取消, 任务失败时返回错误
+func (self *ImageTask) Wait(ctx context.Context) (*ImageResult, error) {
+	interval := self.PollInterval
+	if interval <= 0 {
+		interval = defaultImagePollInterval
+	}
+	maxInterval := self.MaxPollInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultImageMaxPollInterval
+	}
+
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		result, err := self.query(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if result.finished() {
+			return result, nil
+		}
+
+		interval = min(interval*3/2, maxInterval)
+	}
+}
+
+// GenerateImage 提交任务并阻塞等待结果
+func GenerateImage(ctx context.Context, client ImageClient, request *ImageRequest) (*ImageResult, error) {
+	task, err := client.SubmitImage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return task.Wait(ctx)
+}
+
+func checkImageRequest(request *ImageRequest) error {
+	if request == nil || strings.TrimSpace(request.Prompt) == "" {
+		return fmt.Errorf("%w: prompt不能为空", ErrInvalidRequest)
+	}
+	if request.Count < 0 {
+		return fmt.Errorf("%w: count不能小于0", ErrInvalidRequest)
+	}
+
+	return nil
+}
+
+// parseImageSize 解析宽*高, 兼容 1024*1024、1024x1024、1024:1024 的写法
+func parseImageSize(size string) (width, height string, err error) {
+	parts := strings.FieldsFunc(size, func(r rune) bool {
+		return r == '*' || r == 'x' || r == 'X' || r == ':'
+	})
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("%w: size格式不正确 %s", ErrInvalidRequest, size)
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
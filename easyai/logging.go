@@ -0,0 +1,114 @@
+package easyai
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+const maxDumpBodySize = 4096
+
+var sensitiveKeyRegexp = regexp.MustCompile(`(?i)^(token|access_?token|api_?key|secret_?(id|key)|password|authorization)$`)
+
+// 默认不输出任何日志
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (self discardHandler) WithAttrs([]slog.Attr) slog.Handler   { return self }
+func (self discardHandler) WithGroup(string) slog.Handler        { return self }
+
+func (self *ClientConfig) getLogger() *slog.Logger {
+	if self.Logger == nil {
+		return discardLogger
+	}
+
+	return self.Logger
+}
+
+// callLog 单次调用的日志上下文
+type callLog struct {
+	logger    *slog.Logger
+	debug     bool
+	provider  LLMType
+	model     string
+	status    int
+	requestId string
+	start     time.Time
+}
+
+func newCallLog(config *ClientConfig, provider LLMType) *callLog {
+	return &callLog{
+		logger:   config.getLogger(),
+		debug:    config.Debug,
+		provider: provider,
+		start:    time.Now(),
+	}
+}
+
+func (self *callLog) attrs() []any {
+	return []any{
+		slog.String("provider", string(self.provider)),
+		slog.String("model", self.model),
+		slog.String("request_id", self.requestId),
+		slog.Int("status", self.status),
+		slog.Duration("latency", time.Since(self.start)),
+	}
+}
+
+// done 调用结束时输出一条汇总日志
+func (self *callLog) done(ctx context.Context, err error) {
+	if err != nil {
+		self.logger.ErrorContext(ctx, "llm request failed", append(self.attrs(), slog.Any("error", err))...)
+		return
+	}
+
+	self.logger.InfoContext(ctx, "llm request completed", self.attrs()...)
+}
+
+// dump 调试模式下输出脱敏后的请求、响应内容
+func (self *callLog) dump(ctx context.Context, msg string, body []byte) {
+	if !self.debug {
+		return
+	}
+
+	self.logger.DebugContext(ctx, msg, append(self.attrs(), slog.String("body", redactBody(body)))...)
+}
+
+func redactBody(body []byte) string {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err == nil {
+		if redacted, err := json.Marshal(redactValue(data)); err == nil {
+			body = redacted
+		}
+	}
+
+	if len(body) > maxDumpBodySize {
+		return string(body[:maxDumpBodySize]) + "...(truncated)"
+	}
+
+	return string(body)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch data := value.(type) {
+	case map[string]interface{}:
+		for key, item := range data {
+			if sensitiveKeyRegexp.MatchString(key) {
+				data[key] = "***"
+				continue
+			}
+			data[key] = redactValue(item)
+		}
+	case []interface{}:
+		for i, item := range data {
+			data[i] = redactValue(item)
+		}
+	}
+
+	return value
+}
@@ -5,11 +5,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"os"
 )
 
 const (
@@ -61,94 +60,151 @@ type QWenChat struct {
 
 	request     *ChatRequest
 	paramsClone *QWenParameters
+	credential  *Credential
+	log         *callLog
 }
 
 func (self *QWenChat) SetCustomParams(params interface{}) {
 	marshal, err := json.Marshal(params)
 	if err != nil {
-		errMsg := fmt.Errorf("设置全局参数-序列化失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+		self.Config.getLogger().Error("set custom params failed", slog.String("provider", string(ChatTypeQWen)),
+			slog.Any("error", fmt.Errorf("设置全局参数-序列化失败: { %w }", err)))
 
 		return
 	}
 
 	self.Params = &QWenParameters{}
 	if err = json.Unmarshal(marshal, self.Params); err != nil {
-		errMsg := fmt.Errorf("设置全局参数-反序列化失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+		self.Config.getLogger().Error("set custom params failed", slog.String("provider", string(ChatTypeQWen)),
+			slog.Any("error", fmt.Errorf("设置全局参数-反序列化失败: { %w }", err)))
 
 		return
 	}
 }
 
-func (self *QWenChat) NormalChat(ctx context.Context, request *ChatRequest) (*ChatResponse, interface{}, error) {
-	if err := self.checkAndSetRequest(request); err != nil {
-		errMsg := fmt.Errorf("调用通义千问API-参数不合法: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+func (self *QWenChat) NormalChat(ctx context.Context, request *ChatRequest) (resp *ChatResponse, reply interface{}, err error) {
+	for attempt := 0; attempt < self.Config.credentialAttempts(); attempt++ {
+		chat, release, sessionErr := self.session()
+		if sessionErr != nil {
+			// 其余的密钥都已被剔除时返回上一个密钥的错误
+			if attempt > 0 {
+				return nil, nil, err
+			}
+			return nil, nil, sessionErr
+		}
 
-		return nil, nil, errMsg
+		resp, reply, err = chat.normalChat(ctx, request)
+		release(err)
+		chat.log.done(ctx, err)
+		if !self.Config.rotateCredential(ctx, err) {
+			break
+		}
 	}
 
-	respBody, err := self.doHttpRequest()
-	defer respBody.Close()
+	return resp, reply, err
+}
+
+// StreamChat 建立连接时密钥失败会换下一个密钥重试, 流开始之后的错误无法重试
+func (self *QWenChat) StreamChat(ctx context.Context, request *ChatRequest) (messageChan <-chan *ChatResponse, err error) {
+	for attempt := 0; attempt < self.Config.credentialAttempts(); attempt++ {
+		chat, release, sessionErr := self.session()
+		if sessionErr != nil {
+			if attempt > 0 {
+				return nil, err
+			}
+			return nil, sessionErr
+		}
+
+		if messageChan, err = chat.streamChat(ctx, request, release); err == nil {
+			return messageChan, nil
+		}
+		release(err)
+		chat.log.done(ctx, err)
+		if !self.Config.rotateCredential(ctx, err) {
+			break
+		}
+	}
+
+	return nil, err
+}
+
+// 每次调用使用独立的会话, 保证并发调用互不影响
+func (self *QWenChat) session() (*QWenChat, func(err error), error) {
+	log := newCallLog(self.Config, ChatTypeQWen)
+	credential, release, err := self.Config.acquireCredential()
 	if err != nil {
-		errMsg := fmt.Errorf("调用通义千问API失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+		errMsg := fmt.Errorf("调用通义千问API-获取密钥失败: { %w }", err)
+		log.done(context.Background(), errMsg)
 
 		return nil, nil, errMsg
 	}
 
-	respByte, err := io.ReadAll(respBody)
+	return &QWenChat{Config: self.Config, Params: self.Params, credential: credential, log: log}, release, nil
+}
+
+func (self *QWenChat) normalChat(ctx context.Context, request *ChatRequest) (*ChatResponse, interface{}, error) {
+	if err := self.checkAndSetRequest(request); err != nil {
+		return nil, nil, fmt.Errorf("调用通义千问API-参数不合法: { %w }", err)
+	}
+
+	respBody, err := self.doHttpRequest(ctx)
 	if err != nil {
-		errMsg := fmt.Errorf("调用通义千问API-解析响应数据失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
+		return nil, nil, fmt.Errorf("调用通义千问API失败: { %w }", err)
+	}
+	defer respBody.Close()
 
-		return nil, nil, errMsg
+	respByte, err := io.ReadAll(respBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("调用通义千问API-解析响应数据失败: { %w }", err)
 	}
+	self.log.dump(ctx, "llm response", respByte)
 
 	var output = new(QWenResponse)
 	if err = json.Unmarshal(respByte, &output); err != nil {
-		errMsg := fmt.Errorf("调用通义千问API-结果反序列化失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
-
-		return nil, nil, errMsg
+		return nil, nil, fmt.Errorf("调用通义千问API-结果反序列化失败: { %w }", err)
 	}
+	self.log.requestId = output.RequestId
 
-	respMsg := new(ChatResponse)
-	if len(output.Output.Choices) > 0 {
+	respMsg := &ChatResponse{Provider: string(ChatTypeQWen), Model: self.paramsClone.Model}
+	if output.Output != nil && len(output.Output.Choices) > 0 {
 		respMsg.Role = output.Output.Choices[0].Message.Role
 		respMsg.Content = output.Output.Choices[0].Message.Content
+		respMsg.FinishReason = output.Output.Choices[0].FinishReason
 	}
 
 	return respMsg, output, nil
 }
 
-func (self *QWenChat) StreamChat(ctx context.Context, request *ChatRequest) (<-chan *ChatResponse, error) {
-	request.Stream = true
+func (self *QWenChat) streamChat(ctx context.Context, request *ChatRequest, release func(err error)) (<-chan *ChatResponse, error) {
+	if request != nil {
+		request.Stream = true
+	}
 	if err := self.checkAndSetRequest(request); err != nil {
-		errMsg := fmt.Errorf("调用通义千问API-参数不合法: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
-
-		return nil, errMsg
+		return nil, fmt.Errorf("调用通义千问API-参数不合法: { %w }", err)
 	}
 
-	respBody, err := self.doHttpRequest()
+	respBody, err := self.doHttpRequest(ctx)
 	if err != nil {
-		errMsg := fmt.Errorf("调用通义千问API失败: { %w }", err)
-		_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n  %v \n\n", errMsg)
-
-		return nil, errMsg
+		return nil, fmt.Errorf("调用通义千问API失败: { %w }", err)
 	}
 
+	model := self.paramsClone.Model
 	messageChan := make(chan *ChatResponse)
 	go func() {
+		var streamErr error
+		defer func() {
+			release(streamErr)
+			self.log.done(ctx, streamErr)
+		}()
+		defer respBody.Close()
 		info := ""
 		reader := bufio.NewReader(respBody)
 		for {
 			line, readErr := reader.ReadString('\n')
 			if readErr != nil {
-				_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n "+
-					"  流式解析数据结束, 原因: { %v } \n\n", readErr)
+				if readErr != io.EOF {
+					streamErr = fmt.Errorf("调用通义千问API-流式解析数据失败: { %w }", readErr)
+				}
 				close(messageChan)
 				return
 			}
@@ -157,14 +213,37 @@ func (self *QWenChat) StreamChat(ctx context.Context, request *ChatRequest) (<-c
 				line = line[:len(line)-1]
 			}
 			if len(line) > 5 && line[:5] == "data:" {
+				self.log.dump(ctx, "llm stream chunk", []byte(line[5:]))
 				var result QWenResponse
 				_ = json.Unmarshal([]byte(line[5:]), &result)
+				self.log.requestId = result.RequestId
+
+				var errResp QWenResponseError
+				if _ = json.Unmarshal([]byte(line[5:]), &errResp); errResp.Code != "" {
+					streamErr = newQWenError(self.log.status, &errResp)
+					close(messageChan)
+					return
+				}
+				if result.Output == nil {
+					continue
+				}
 				for _, choice := range result.Output.Choices {
-					if choice.Message.Role == IdBot && choice.Message.Content != info {
-						respMsg := new(ChatResponse)
+					finishReason := choice.FinishReason
+					if finishReason == "null" { // 未结束的分片finish_reason为"null"
+						finishReason = ""
+					}
+					if choice.Message.Role == IdBot && (choice.Message.Content != info || finishReason != "") {
+						respMsg := &ChatResponse{Provider: string(ChatTypeQWen), Model: model}
 						respMsg.Role = choice.Message.Role
 						respMsg.Content = choice.Message.Content
-						messageChan <- respMsg
+						respMsg.FinishReason = finishReason
+						select {
+						case messageChan <- respMsg:
+						case <-ctx.Done():
+							streamErr = ctx.Err()
+							close(messageChan)
+							return
+						}
 					}
 				}
 			}
@@ -176,7 +255,7 @@ func (self *QWenChat) StreamChat(ctx context.Context, request *ChatRequest) (<-c
 
 func (self *QWenChat) checkAndSetRequest(request *ChatRequest) error {
 	if request == nil || request.Message == "" {
-		return errors.New("message不能为空")
+		return fmt.Errorf("%w: message不能为空", ErrInvalidRequest)
 	}
 
 	self.request = new(ChatRequest)
@@ -191,6 +270,7 @@ func (self *QWenChat) cloneParams() {
 	self.setParamsModel()
 	self.setParamsInput()
 	self.setParamsParameters()
+	self.log.model = self.paramsClone.Model
 }
 
 func (self *QWenChat) setParamsModel() {
@@ -216,27 +296,15 @@ func (self *QWenChat) setParamsInput() {
 			self.paramsClone.Input.Messages = append(self.paramsClone.Input.Messages, message)
 		}
 	}
-	self.paramsClone.Input.Messages = append(self.paramsClone.Input.Messages, &ChatMessage{
-		Role:    IdUser,
-		Content: self.request.Message,
-	})
-	if self.request.Tips != nil {
-		self.paramsClone.Input.Messages = append(self.paramsClone.Input.Messages, self.request.Tips)
-	}
-
-	if len(self.request.History) > 0 {
-		for _, history := range self.request.History {
-			self.paramsClone.Input.Messages = append(self.paramsClone.Input.Messages, &ChatMessage{
-				Role:    history.Role,
-				Content: history.Content,
-			})
-		}
-	}
+	self.paramsClone.Input.Messages = append(self.paramsClone.Input.Messages, chatMessages(self.request, false)...)
 }
 
 func (self *QWenChat) setParamsParameters() {
 	if self.Params.Parameters != nil {
-		self.paramsClone.Parameters = self.Params.Parameters
+		self.paramsClone.Parameters = make(map[string]interface{}, len(self.Params.Parameters))
+		for key, value := range self.Params.Parameters {
+			self.paramsClone.Parameters[key] = value
+		}
 	} else {
 		self.paramsClone.Parameters = map[string]interface{}{
 			"temperature": 0.8,
@@ -248,12 +316,16 @@ func (self *QWenChat) setParamsParameters() {
 	// 强制返回output.choices字段
 	self.paramsClone.Parameters["result_format"] = "message"
 
+	if self.request.JSONMode {
+		self.paramsClone.Parameters["response_format"] = map[string]string{"type": "json_object"}
+	}
+
 	if self.request.Stream {
 		self.paramsClone.Parameters["incremental_output"] = true
 	}
 }
 
-func (self *QWenChat) doHttpRequest() (respBody io.ReadCloser, errMsg error) {
+func (self *QWenChat) doHttpRequest(ctx context.Context) (respBody io.ReadCloser, errMsg error) {
 	respBody = nil
 	jsonBody, err := json.Marshal(self.paramsClone)
 	if err != nil {
@@ -261,14 +333,16 @@ func (self *QWenChat) doHttpRequest() (respBody io.ReadCloser, errMsg error) {
 		return
 	}
 
-	req, err := http.NewRequest("POST", QWenBaseUrl, bytes.NewReader(jsonBody))
+	self.log.dump(ctx, "llm request", jsonBody)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", QWenBaseUrl, bytes.NewReader(jsonBody))
 	if err != nil {
 		errMsg = fmt.Errorf("构造http请求失败, 原因: %w", err)
 		return
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", self.Config.Token))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", self.credential.Token))
 	if self.request.Stream {
 		req.Header.Set("X-DashScope-SSE", "enable")
 	}
@@ -279,16 +353,14 @@ func (self *QWenChat) doHttpRequest() (respBody io.ReadCloser, errMsg error) {
 		return
 	}
 
+	self.log.status = resp.StatusCode
 	if resp.StatusCode != http.StatusOK {
 		defer resp.Body.Close()
-		var errResp QWenResponseError
 		b, _ := io.ReadAll(resp.Body)
-		if err = json.Unmarshal(b, &errResp); err != nil {
-			errMsg = fmt.Errorf("http结果序列化失败, 原因: %v", err)
-			return
-		}
-
-		errMsg = fmt.Errorf("http请求失败, 原因: %s, message: %s", errResp.Code, errResp.Message)
+		self.log.dump(ctx, "llm response", b)
+		apiErr := parseQWenError(resp.StatusCode, b)
+		self.log.requestId = apiErr.RequestId
+		errMsg = apiErr
 		return
 	}
 
@@ -296,3 +368,50 @@ func (self *QWenChat) doHttpRequest() (respBody io.ReadCloser, errMsg error) {
 
 	return
 }
+
+// doQWenJSONRequest 发送非流式请求, 非200时返回APIError, 成功时将结果反序列化到output
+func doQWenJSONRequest(ctx context.Context, config *ClientConfig, log *callLog, credential *Credential, method, url string, jsonBody []byte, header http.Header, output interface{}) error {
+	var body io.Reader
+	if jsonBody != nil {
+		log.dump(ctx, "llm request", jsonBody)
+		body = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("构造http请求失败, 原因: %w", err)
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", credential.Token))
+
+	resp, err := config.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http请求失败, 原因: %w", err)
+	}
+	defer resp.Body.Close()
+
+	log.status = resp.StatusCode
+	respByte, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应数据失败, 原因: %w", err)
+	}
+	log.dump(ctx, "llm response", respByte)
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := parseQWenError(resp.StatusCode, respByte)
+		log.requestId = apiErr.RequestId
+
+		return apiErr
+	}
+
+	if err = json.Unmarshal(respByte, output); err != nil {
+		return fmt.Errorf("http结果序列化失败, 原因: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package easyai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	EmbeddingModelQWenV2 = "text-embedding-v2"
+	EmbeddingModelQWenV3 = "text-embedding-v3"
+
+	QWenEmbeddingUrl = "https://dashscope.aliyuncs.com/api/v1/services/embeddings/text-embedding/text-embedding"
+)
+
+// 单次请求最多可向量化的文本数
+var qwenEmbeddingBatchSize = map[string]int{
+	EmbeddingModelQWenV2: 25,
+	EmbeddingModelQWenV3: 10,
+}
+
+type QWenEmbeddingParameters struct {
+	Model      string                 `json:"model"`
+	Input      *QWenEmbeddingInput    `json:"input"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type QWenEmbeddingInput struct {
+	Texts []string `json:"texts"`
+}
+
+type QWenEmbeddingResponse struct {
+	Output    *QWenEmbeddingOutput `json:"output"`
+	Usage     *QWenUsage           `json:"usage"`
+	RequestId string               `json:"request_id"`
+}
+
+type QWenEmbeddingOutput struct {
+	Embeddings []*QWenEmbeddingData `json:"embeddings"`
+}
+
+type QWenEmbeddingData struct {
+	TextIndex int       `json:"text_index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// QWenEmbedding 通义千问通用文本向量
+type QWenEmbedding struct {
+	Config    *ClientConfig
+	Model     string // 默认text-embedding-v2
+	TextType  string // query或document, 为空时使用服务端默认值
+	Dimension int    // 仅text-embedding-v3支持, 为0时使用服务端默认值
+}
+
+func (self *QWenEmbedding) Embed(ctx context.Context, texts []string) (*EmbeddingResponse, error) {
+	model := self.Model
+	if model == "" {
+		model = EmbeddingModelQWenV2
+	}
+	batchSize, ok := qwenEmbeddingBatchSize[model]
+	if !ok {
+		batchSize = qwenEmbeddingBatchSize[EmbeddingModelQWenV3]
+	}
+
+	return embedInBatches(ctx, model, texts, batchSize, func(ctx context.Context, batch []string) ([][]float64, int64, error) {
+		return self.embedBatch(ctx, model, batch)
+	})
+}
+
+func (self *QWenEmbedding) embedBatch(ctx context.Context, model string, batch []string) (embeddings [][]float64, tokens int64, errMsg error) {
+	log := newCallLog(self.Config, ChatTypeQWen)
+	log.model = model
+	defer func() { log.done(ctx, errMsg) }()
+
+	credential, release, err := self.Config.acquireCredential()
+	if err != nil {
+		return nil, 0, fmt.Errorf("调用通义千问向量API-获取密钥失败: { %w }", err)
+	}
+	defer func() { release(errMsg) }()
+
+	params := &QWenEmbeddingParameters{Model: model, Input: &QWenEmbeddingInput{Texts: batch}}
+	if self.TextType != "" || self.Dimension > 0 {
+		params.Parameters = make(map[string]interface{})
+		if self.TextType != "" {
+			params.Parameters["text_type"] = self.TextType
+		}
+		if self.Dimension > 0 {
+			params.Parameters["dimension"] = self.Dimension
+		}
+	}
+
+	jsonBody, err := json.Marshal(params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("调用通义千问向量API-序列化请求参数失败: { %w }", err)
+	}
+
+	var output QWenEmbeddingResponse
+	if err = doQWenJSONRequest(ctx, self.Config, log, credential, "POST", QWenEmbeddingUrl, jsonBody, nil, &output); err != nil {
+		return nil, 0, fmt.Errorf("调用通义千问向量API失败: { %w }", err)
+	}
+	log.requestId = output.RequestId
+	if output.Output == nil {
+		return nil, 0, fmt.Errorf("调用通义千问向量API-返回结果为空")
+	}
+
+	// 按text_index还原输入顺序
+	embeddings = make([][]float64, len(batch))
+	for _, data := range output.Output.Embeddings {
+		if data.TextIndex < 0 || data.TextIndex >= len(batch) {
+			return nil, 0, fmt.Errorf("调用通义千问向量API-text_index越界: %d", data.TextIndex)
+		}
+		embeddings[data.TextIndex] = data.Embedding
+	}
+	if output.Usage != nil {
+		tokens = output.Usage.TotalTokens
+	}
+
+	return embeddings, tokens, nil
+}
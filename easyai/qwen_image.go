@@ -0,0 +1,173 @@
+package easyai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	ImageModelWanXV1 = "wanx-v1"
+
+	QWenImageUrl     = "https://dashscope.aliyuncs.com/api/v1/services/aigc/text2image/image-synthesis"
+	QWenImageTaskUrl = "https://dashscope.aliyuncs.com/api/v1/tasks/"
+)
+
+type QWenImageParameters struct {
+	Model      string                 `json:"model"`
+	Input      *QWenImageInput        `json:"input"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type QWenImageInput struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+}
+
+type QWenImageResponse struct {
+	Output    *QWenImageOutput `json:"output"`
+	RequestId string           `json:"request_id"`
+}
+
+type QWenImageOutput struct {
+	TaskId     string             `json:"task_id"`
+	TaskStatus string             `json:"task_status"`
+	Results    []*QWenImageResult `json:"results,omitempty"`
+	Code       string             `json:"code,omitempty"`
+	Message    string             `json:"message,omitempty"`
+}
+
+type QWenImageResult struct {
+	Url     string `json:"url,omitempty"`
+	Code    string `json:"code,omitempty"` // 单张图片生成失败时返回
+	Message string `json:"message,omitempty"`
+}
+
+// QWenImage 通义万相文生图
+type QWenImage struct {
+	Config *ClientConfig
+}
+
+func (self *QWenImage) SubmitImage(ctx context.Context, request *ImageRequest) (task *ImageTask, errMsg error) {
+	if err := checkImageRequest(request); err != nil {
+		return nil, fmt.Errorf("调用通义万相API-参数不合法: { %w }", err)
+	}
+
+	model := request.Model
+	if model == "" {
+		model = ImageModelWanXV1
+	}
+	params := &QWenImageParameters{
+		Model:      model,
+		Input:      &QWenImageInput{Prompt: request.Prompt, NegativePrompt: request.NegativePrompt},
+		Parameters: make(map[string]interface{}),
+	}
+	if request.Size != "" {
+		width, height, err := parseImageSize(request.Size)
+		if err != nil {
+			return nil, fmt.Errorf("调用通义万相API-参数不合法: { %w }", err)
+		}
+		params.Parameters["size"] = width + "*" + height
+	}
+	if request.Count > 0 {
+		params.Parameters["n"] = request.Count
+	}
+	if request.Style != "" {
+		params.Parameters["style"] = request.Style
+	}
+
+	log := newCallLog(self.Config, ChatTypeQWen)
+	log.model = model
+	defer func() { log.done(ctx, errMsg) }()
+
+	credential, release, err := self.Config.acquireCredential()
+	if err != nil {
+		return nil, fmt.Errorf("调用通义万相API-获取密钥失败: { %w }", err)
+	}
+	defer func() { release(errMsg) }()
+
+	jsonBody, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("调用通义万相API-序列化请求参数失败: { %w }", err)
+	}
+
+	var output QWenImageResponse
+	header := http.Header{"X-DashScope-Async": []string{"enable"}}
+	if err = doQWenJSONRequest(ctx, self.Config, log, credential, "POST", QWenImageUrl, jsonBody, header, &output); err != nil {
+		return nil, fmt.Errorf("调用通义万相API失败: { %w }", err)
+	}
+	log.requestId = output.RequestId
+	if output.Output == nil || output.Output.TaskId == "" {
+		return nil, fmt.Errorf("调用通义万相API-未返回task_id")
+	}
+
+	taskId := output.Output.TaskId
+	task = &ImageTask{TaskId: taskId, Provider: ChatTypeQWen, Model: model}
+	task.query = func(ctx context.Context) (*ImageResult, error) {
+		release, err := self.Config.acquireSameCredential(credential)
+		if err != nil {
+			return nil, fmt.Errorf("调用通义万相API-获取密钥失败: { %w }", err)
+		}
+		result, err := self.queryImage(ctx, credential, taskId)
+		release(err)
+		if result != nil {
+			result.Model = model
+		}
+
+		return result, err
+	}
+
+	return task, nil
+}
+
+func (self *QWenImage) QueryImage(ctx context.Context, taskId string) (result *ImageResult, errMsg error) {
+	credential, release, err := self.Config.acquireCredential()
+	if err != nil {
+		return nil, fmt.Errorf("调用通义万相API-获取密钥失败: { %w }", err)
+	}
+	defer func() { release(errMsg) }()
+
+	return self.queryImage(ctx, credential, taskId)
+}
+
+// queryImage 任务与提交时的密钥绑定, 查询需使用同一个密钥
+func (self *QWenImage) queryImage(ctx context.Context, credential *Credential, taskId string) (result *ImageResult, errMsg error) {
+	log := newCallLog(self.Config, ChatTypeQWen)
+	defer func() { log.done(ctx, errMsg) }()
+
+	var output QWenImageResponse
+	if err := doQWenJSONRequest(ctx, self.Config, log, credential, "GET", QWenImageTaskUrl+taskId, nil, nil, &output); err != nil {
+		return nil, fmt.Errorf("调用通义万相API-查询任务失败: { %w }", err)
+	}
+	log.requestId = output.RequestId
+	if output.Output == nil {
+		return nil, fmt.Errorf("调用通义万相API-查询任务返回结果为空")
+	}
+
+	result = &ImageResult{Provider: string(ChatTypeQWen), TaskId: taskId}
+	switch output.Output.TaskStatus {
+	case "PENDING":
+		result.Status = ImageTaskPending
+	case "RUNNING":
+		result.Status = ImageTaskRunning
+	case "SUCCEEDED":
+		result.Status = ImageTaskSucceeded
+		for _, image := range output.Output.Results {
+			if image.Url != "" {
+				result.URLs = append(result.URLs, image.Url)
+			}
+		}
+	default:
+		// FAILED、CANCELED、UNKNOWN(任务不存在或已过期)
+		result.Status = ImageTaskFailed
+		respErr := &QWenResponseError{Code: output.Output.Code, Message: output.Output.Message, RequestId: output.RequestId}
+		if respErr.Code == "" {
+			respErr.Code, respErr.Message = output.Output.TaskStatus, "任务"+output.Output.TaskStatus
+		}
+
+		return result, fmt.Errorf("调用通义万相API-任务失败: { %w }", newQWenError(http.StatusOK, respErr))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package easyai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	RerankModelGte = "gte-rerank"
+
+	QWenRerankUrl = "https://dashscope.aliyuncs.com/api/v1/services/rerank/text-rerank/text-rerank"
+)
+
+type QWenRerankParameters struct {
+	Model      string                 `json:"model"`
+	Input      *QWenRerankInput       `json:"input"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type QWenRerankInput struct {
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+type QWenRerankResponse struct {
+	Output    *QWenRerankOutput `json:"output"`
+	Usage     *QWenUsage        `json:"usage"`
+	RequestId string            `json:"request_id"`
+}
+
+type QWenRerankOutput struct {
+	Results []*QWenRerankResult `json:"results"`
+}
+
+type QWenRerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
+// QWenRerank 通义文本排序
+type QWenRerank struct {
+	Config *ClientConfig
+	Model  string // 默认gte-rerank
+}
+
+func (self *QWenRerank) Rerank(ctx context.Context, query string, documents []string, topN int) (rerankResp *RerankResponse, errMsg error) {
+	if err := checkRerankRequest(query, documents); err != nil {
+		return nil, fmt.Errorf("调用通义排序API-参数不合法: { %w }", err)
+	}
+
+	model := self.Model
+	if model == "" {
+		model = RerankModelGte
+	}
+	params := &QWenRerankParameters{
+		Model:      model,
+		Input:      &QWenRerankInput{Query: query, Documents: documents},
+		Parameters: map[string]interface{}{"return_documents": false},
+	}
+	if topN > 0 {
+		params.Parameters["top_n"] = topN
+	}
+
+	log := newCallLog(self.Config, ChatTypeQWen)
+	log.model = model
+	defer func() { log.done(ctx, errMsg) }()
+
+	credential, release, err := self.Config.acquireCredential()
+	if err != nil {
+		return nil, fmt.Errorf("调用通义排序API-获取密钥失败: { %w }", err)
+	}
+	defer func() { release(errMsg) }()
+
+	jsonBody, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("调用通义排序API-序列化请求参数失败: { %w }", err)
+	}
+
+	var output QWenRerankResponse
+	if err = doQWenJSONRequest(ctx, self.Config, log, credential, "POST", QWenRerankUrl, jsonBody, nil, &output); err != nil {
+		return nil, fmt.Errorf("调用通义排序API失败: { %w }", err)
+	}
+	log.requestId = output.RequestId
+	if output.Output == nil {
+		return nil, fmt.Errorf("调用通义排序API-返回结果为空")
+	}
+
+	rerankResp = &RerankResponse{Model: model, Usage: new(RerankUsage)}
+	for _, result := range output.Output.Results {
+		if result.Index < 0 || result.Index >= len(documents) {
+			return nil, fmt.Errorf("调用通义排序API-index越界: %d", result.Index)
+		}
+		rerankResp.Results = append(rerankResp.Results, &RerankResult{
+			Index:    result.Index,
+			Document: documents[result.Index],
+			Score:    result.RelevanceScore,
+		})
+	}
+	sortRerankResults(rerankResp.Results)
+	rerankResp.Results = limitRerankResults(rerankResp.Results, topN)
+	if output.Usage != nil {
+		rerankResp.Usage.TotalTokens = output.Usage.TotalTokens
+	}
+
+	return rerankResp, nil
+}
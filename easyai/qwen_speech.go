@@ -0,0 +1,412 @@
+package easyai
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	SpeechModelCosyVoiceV1      = "cosyvoice-v1"
+	SpeechModelSambertZhiChuV1  = "sambert-zhichu-v1"
+	SpeechModelParaformerRealV2 = "paraformer-realtime-v2"
+
+	QWenSpeechUrl = "wss://dashscope.aliyuncs.com/api-ws/v1/inference"
+
+	defaultSpeechVoice       = "longxiaochun"
+	defaultSpeechFormat      = "mp3"
+	defaultRecognitionFormat = "pcm"
+	defaultRecognitionRate   = 16000
+	recognitionChunkSize     = 3200 // 每帧发送的音频字节数, 16k采样率的pcm约为100ms
+)
+
+// QWenTaskMessage DashScope WebSocket接口的指令与事件
+type QWenTaskMessage struct {
+	Header  *QWenTaskHeader  `json:"header"`
+	Payload *QWenTaskPayload `json:"payload"`
+}
+
+type QWenTaskHeader struct {
+	Action       string `json:"action,omitempty"` // run-task、continue-task、finish-task
+	TaskId       string `json:"task_id"`
+	Streaming    string `json:"streaming,omitempty"`
+	Event        string `json:"event,omitempty"` // task-started、result-generated、task-finished、task-failed
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+type QWenTaskPayload struct {
+	TaskGroup  string                 `json:"task_group,omitempty"`
+	Task       string                 `json:"task,omitempty"`
+	Function   string                 `json:"function,omitempty"`
+	Model      string                 `json:"model,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Input      map[string]interface{} `json:"input"`
+	Output     *QWenTaskOutput        `json:"output,omitempty"`
+}
+
+type QWenTaskOutput struct {
+	Sentence *QWenRecognizedSentence `json:"sentence,omitempty"`
+}
+
+type QWenRecognizedSentence struct {
+	BeginTime   int64  `json:"begin_time"`
+	EndTime     *int64 `json:"end_time"` // 句子未结束时为null
+	Text        string `json:"text"`
+	SentenceEnd bool   `json:"sentence_end"`
+	Heartbeat   bool   `json:"heartbeat"`
+}
+
+// QWenSpeech 通义语音合成(CosyVoice、Sambert)与实时语音识别(Paraformer)
+type QWenSpeech struct {
+	Config *ClientConfig
+}
+
+// qwenSpeechTask 一次WebSocket连接, 结束时统一释放密钥并输出日志
+type qwenSpeechTask struct {
+	conn    *wsConn
+	log     *callLog
+	release func(err error)
+	cancel  context.CancelFunc
+}
+
+func (self *QWenSpeech) connect(ctx context.Context, model string) (*qwenSpeechTask, context.Context, error) {
+	log := newCallLog(self.Config, ChatTypeQWen)
+	log.model = model
+
+	credential, release, err := self.Config.acquireCredential()
+	if err != nil {
+		errMsg := fmt.Errorf("调用通义语音API-获取密钥失败: { %w }", err)
+		log.done(ctx, errMsg)
+
+		return nil, nil, errMsg
+	}
+
+	header := http.Header{"Authorization": []string{fmt.Sprintf("Bearer %s", credential.Token)}}
+	conn, resp, body, err := dialWebSocket(ctx, self.Config.HttpClient, QWenSpeechUrl, header)
+	if resp != nil {
+		log.status = resp.StatusCode
+	}
+	if err != nil {
+		var errResp QWenResponseError
+		if len(body) > 0 && json.Unmarshal(body, &errResp) == nil && errResp.Code != "" {
+			log.requestId = errResp.RequestId
+			err = newQWenError(resp.StatusCode, &errResp)
+		}
+		errMsg := fmt.Errorf("调用通义语音API失败: { %w }", err)
+		release(errMsg)
+		log.done(ctx, errMsg)
+
+		return nil, nil, errMsg
+	}
+
+	// ctx取消或任务结束时关闭连接, 阻塞中的读写随之返回
+	taskCtx, cancel := context.WithCancel(ctx)
+	context.AfterFunc(taskCtx, func() { _ = conn.close() })
+
+	return &qwenSpeechTask{conn: conn, log: log, release: release, cancel: cancel}, taskCtx, nil
+}
+
+func (self *qwenSpeechTask) finish(ctx context.Context, err error) {
+	self.cancel()
+	self.release(err)
+	self.log.done(ctx, err)
+}
+
+// readEvent 读取一条消息, 二进制消息为音频数据, task-failed转为APIError
+func (self *qwenSpeechTask) readEvent(ctx context.Context) (*QWenTaskMessage, []byte, error) {
+	opcode, message, err := self.conn.readMessage()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, fmt.Errorf("读取websocket消息失败, 原因: %w", err)
+	}
+	if opcode == wsOpBinary {
+		return nil, message, nil
+	}
+
+	self.log.dump(ctx, "llm response", message)
+	event := new(QWenTaskMessage)
+	if err = json.Unmarshal(message, event); err != nil || event.Header == nil {
+		return nil, nil, fmt.Errorf("websocket消息反序列化失败: %s", message)
+	}
+	self.log.requestId = event.Header.TaskId
+	if event.Header.Event == "task-failed" {
+		return nil, nil, newQWenError(0, &QWenResponseError{
+			Code:      event.Header.ErrorCode,
+			Message:   event.Header.ErrorMessage,
+			RequestId: event.Header.TaskId,
+		})
+	}
+
+	return event, nil, nil
+}
+
+// waitEvent 等待指定事件, 期间收到的音频交给onAudio处理
+func (self *qwenSpeechTask) waitEvent(ctx context.Context, name string, onAudio func(audio []byte) error) error {
+	for {
+		event, audio, err := self.readEvent(ctx)
+		if err != nil {
+			return err
+		}
+		if audio != nil {
+			if onAudio == nil {
+				continue
+			}
+			if err = onAudio(audio); err != nil {
+				return err
+			}
+			continue
+		}
+		if event.Header.Event == name {
+			return nil
+		}
+	}
+}
+
+func (self *qwenSpeechTask) send(ctx context.Context, message *QWenTaskMessage) error {
+	data, _ := json.Marshal(message)
+	self.log.dump(ctx, "llm request", data)
+
+	return self.conn.writeFrame(wsOpText, data)
+}
+
+func (self *QWenSpeech) Synthesize(ctx context.Context, request *SpeechRequest) (io.ReadCloser, error) {
+	if request == nil || strings.TrimSpace(request.Text) == "" {
+		return nil, fmt.Errorf("调用通义语音API-参数不合法: { %w }", fmt.Errorf("%w: text不能为空", ErrInvalidRequest))
+	}
+
+	sentenceChan := make(chan string, 1)
+	sentenceChan <- request.Text
+	close(sentenceChan)
+
+	return self.synthesize(ctx, request, func(context.Context) <-chan string { return sentenceChan })
+}
+
+func (self *QWenSpeech) SynthesizeStream(ctx context.Context, request *SpeechRequest, stream <-chan *ChatResponse) (io.ReadCloser, error) {
+	if request == nil {
+		request = new(SpeechRequest)
+	}
+
+	return self.synthesize(ctx, request, func(ctx context.Context) <-chan string {
+		return SplitSentences(ctx, stream)
+	})
+}
+
+func (self *QWenSpeech) synthesize(ctx context.Context, request *SpeechRequest, sentences func(ctx context.Context) <-chan string) (io.ReadCloser, error) {
+	model := request.Model
+	if model == "" {
+		model = SpeechModelCosyVoiceV1
+	}
+	parameters := map[string]interface{}{"text_type": "PlainText", "format": defaultSpeechFormat}
+	if request.Format != "" {
+		parameters["format"] = request.Format
+	}
+	if request.SampleRate > 0 {
+		parameters["sample_rate"] = request.SampleRate
+	}
+
+	task, taskCtx, err := self.connect(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	onAudio := func(audio []byte) error {
+		// 调用方关闭reader后写入失败, 任务随之结束
+		_, err := writer.Write(audio)
+		return err
+	}
+	done := func(err error) {
+		writer.CloseWithError(err)
+		task.finish(ctx, err)
+	}
+
+	if !strings.HasPrefix(model, "cosyvoice") {
+		// sambert不支持双向流式, 每句话在同一个连接上依次发起一个任务
+		go func() {
+			for sentence := range sentences(taskCtx) {
+				message := newQWenTaskMessage("run-task", "out")
+				message.Payload = &QWenTaskPayload{TaskGroup: "audio", Task: "tts", Function: "SpeechSynthesizer",
+					Model: model, Parameters: parameters, Input: map[string]interface{}{"text": sentence}}
+				if err := task.send(ctx, message); err != nil {
+					done(err)
+					return
+				}
+				if err := task.waitEvent(taskCtx, "task-finished", onAudio); err != nil {
+					done(err)
+					return
+				}
+			}
+			done(taskCtx.Err())
+		}()
+
+		return reader, nil
+	}
+
+	voice := request.Voice
+	if voice == "" {
+		voice = defaultSpeechVoice
+	}
+	parameters["voice"] = voice
+
+	message := newQWenTaskMessage("run-task", "duplex")
+	taskId := message.Header.TaskId
+	message.Payload = &QWenTaskPayload{TaskGroup: "audio", Task: "tts", Function: "SpeechSynthesizer",
+		Model: model, Parameters: parameters, Input: map[string]interface{}{}}
+	if err = task.send(ctx, message); err == nil {
+		err = task.waitEvent(taskCtx, "task-started", nil)
+	}
+	if err != nil {
+		errMsg := fmt.Errorf("调用通义语音API失败: { %w }", err)
+		done(errMsg)
+
+		return nil, errMsg
+	}
+
+	// 边接收文本边合成
+	go func() {
+		for sentence := range sentences(taskCtx) {
+			message := &QWenTaskMessage{
+				Header:  &QWenTaskHeader{Action: "continue-task", TaskId: taskId, Streaming: "duplex"},
+				Payload: &QWenTaskPayload{Input: map[string]interface{}{"text": sentence}},
+			}
+			if task.send(ctx, message) != nil {
+				return
+			}
+		}
+		if taskCtx.Err() == nil {
+			_ = task.send(ctx, &QWenTaskMessage{
+				Header:  &QWenTaskHeader{Action: "finish-task", TaskId: taskId, Streaming: "duplex"},
+				Payload: &QWenTaskPayload{Input: map[string]interface{}{}},
+			})
+		}
+	}()
+	go func() {
+		done(task.waitEvent(taskCtx, "task-finished", onAudio))
+	}()
+
+	return reader, nil
+}
+
+func (self *QWenSpeech) Recognize(ctx context.Context, request *RecognitionRequest, audio io.Reader) (result *RecognitionResult, errMsg error) {
+	if request == nil {
+		request = new(RecognitionRequest)
+	}
+	if audio == nil {
+		return nil, fmt.Errorf("调用通义语音API-参数不合法: { %w }", fmt.Errorf("%w: audio不能为空", ErrInvalidRequest))
+	}
+
+	model := request.Model
+	if model == "" {
+		model = SpeechModelParaformerRealV2
+	}
+	parameters := map[string]interface{}{"format": defaultRecognitionFormat, "sample_rate": defaultRecognitionRate}
+	if request.Format != "" {
+		parameters["format"] = request.Format
+	}
+	if request.SampleRate > 0 {
+		parameters["sample_rate"] = request.SampleRate
+	}
+
+	task, taskCtx, err := self.connect(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { task.finish(ctx, errMsg) }()
+
+	message := newQWenTaskMessage("run-task", "duplex")
+	taskId := message.Header.TaskId
+	message.Payload = &QWenTaskPayload{TaskGroup: "audio", Task: "asr", Function: "recognition",
+		Model: model, Parameters: parameters, Input: map[string]interface{}{}}
+	if err = task.send(ctx, message); err == nil {
+		err = task.waitEvent(taskCtx, "task-started", nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("调用通义语音API失败: { %w }", err)
+	}
+
+	// 发送音频的同时接收识别结果, 任务结束或取消后不再读取audio
+	// 已阻塞的Read无法中断, 需要调用方关闭audio
+	sendErr := make(chan error, 1)
+	go func() {
+		buffer := make([]byte, recognitionChunkSize)
+		for {
+			if err := taskCtx.Err(); err != nil {
+				sendErr <- err
+				return
+			}
+			n, err := audio.Read(buffer)
+			if n > 0 {
+				if writeErr := task.conn.writeBinary(buffer[:n]); writeErr != nil {
+					sendErr <- writeErr
+					return
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				sendErr <- fmt.Errorf("读取音频失败, 原因: %w", err)
+				task.cancel()
+				return
+			}
+		}
+		sendErr <- task.send(ctx, &QWenTaskMessage{
+			Header:  &QWenTaskHeader{Action: "finish-task", TaskId: taskId, Streaming: "duplex"},
+			Payload: &QWenTaskPayload{Input: map[string]interface{}{}},
+		})
+	}()
+
+	result = new(RecognitionResult)
+	for {
+		event, _, err := task.readEvent(taskCtx)
+		if err != nil {
+			select {
+			case readErr := <-sendErr:
+				if readErr != nil {
+					err = readErr
+				}
+			default:
+			}
+
+			return nil, fmt.Errorf("调用通义语音API失败: { %w }", err)
+		}
+		if event == nil {
+			continue
+		}
+
+		switch event.Header.Event {
+		case "result-generated":
+			if event.Payload == nil || event.Payload.Output == nil || event.Payload.Output.Sentence == nil {
+				continue
+			}
+			sentence := event.Payload.Output.Sentence
+			if sentence.Heartbeat || (!sentence.SentenceEnd && sentence.EndTime == nil) {
+				continue
+			}
+			recognized := &RecognizedSentence{Text: sentence.Text, BeginTime: sentence.BeginTime}
+			if sentence.EndTime != nil {
+				recognized.EndTime = *sentence.EndTime
+			}
+			result.Sentences = append(result.Sentences, recognized)
+			result.Text += sentence.Text
+		case "task-finished":
+			return result, nil
+		}
+	}
+}
+
+func newQWenTaskMessage(action, streaming string) *QWenTaskMessage {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return &QWenTaskMessage{Header: &QWenTaskHeader{Action: action, TaskId: hex.EncodeToString(id), Streaming: streaming}}
+}
@@ -0,0 +1,92 @@
+package easyai
+
+import (
+	"context"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/utils"
+	"sort"
+	"strings"
+)
+
+type RerankResult struct {
+	Index    int     `json:"index"` // 在输入documents中的下标
+	Document string  `json:"document"`
+	Score    float64 `json:"score"`
+}
+
+type RerankUsage struct {
+	TotalTokens int64 `json:"total_tokens"`
+}
+
+type RerankResponse struct {
+	Model   string          `json:"model"`
+	Results []*RerankResult `json:"results"` // 按Score从高到低排列
+	Usage   *RerankUsage    `json:"usage"`
+}
+
+// RerankClient 按与query的相关性对documents重新排序, topN小于1时返回全部
+type RerankClient interface {
+	Rerank(ctx context.Context, query string, documents []string, topN int) (*RerankResponse, error)
+}
+
+// EmbeddingReranker 基于向量余弦相似度的重排序, 适用于服务商不提供重排序接口的场景
+type EmbeddingReranker struct {
+	Embedder EmbeddingClient
+}
+
+func (self *EmbeddingReranker) Rerank(ctx context.Context, query string, documents []string, topN int) (*RerankResponse, error) {
+	if err := checkRerankRequest(query, documents); err != nil {
+		return nil, err
+	}
+
+	resp, err := self.Embedder.Embed(ctx, append([]string{query}, documents...))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(documents)+1 {
+		return nil, fmt.Errorf("向量数量与输入的文本数量不一致")
+	}
+
+	results := make([]*RerankResult, len(documents))
+	for i, document := range documents {
+		results[i] = &RerankResult{
+			Index:    i,
+			Document: document,
+			Score:    utils.CosineSimilarity(resp.Embeddings[0], resp.Embeddings[i+1]),
+		}
+	}
+	sortRerankResults(results)
+
+	rerankResp := &RerankResponse{Model: resp.Model, Results: limitRerankResults(results, topN), Usage: new(RerankUsage)}
+	if resp.Usage != nil {
+		rerankResp.Usage.TotalTokens = resp.Usage.TotalTokens
+	}
+
+	return rerankResp, nil
+}
+
+func checkRerankRequest(query string, documents []string) error {
+	if strings.TrimSpace(query) == "" {
+		return fmt.Errorf("%w: query不能为空", ErrInvalidRequest)
+	}
+	if len(documents) == 0 {
+		return fmt.Errorf("%w: documents不能为空", ErrInvalidRequest)
+	}
+
+	return nil
+}
+
+// sortRerankResults 分数相同时保持原有顺序
+func sortRerankResults(results []*RerankResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
+
+func limitRerankResults(results []*RerankResult, topN int) []*RerankResult {
+	if topN > 0 && topN < len(results) {
+		return results[:topN]
+	}
+
+	return results
+}
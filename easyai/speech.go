@@ -0,0 +1,87 @@
+package easyai
+
+import (
+	"context"
+	"github.com/soryetong/go-easy-llm/utils"
+	"io"
+)
+
+type SpeechRequest struct {
+	Model      string `json:"model"`
+	Text       string `json:"text"`        // Synthesize使用, SynthesizeStream忽略
+	Voice      string `json:"voice"`       // 音色, 仅cosyvoice使用, sambert的音色由模型决定
+	Format     string `json:"format"`      // mp3、wav、pcm, 默认mp3
+	SampleRate int    `json:"sample_rate"` // 为0时使用服务端默认值
+}
+
+type RecognitionRequest struct {
+	Model      string `json:"model"`
+	Format     string `json:"format"`      // pcm、wav、mp3等, 默认pcm
+	SampleRate int    `json:"sample_rate"` // 默认16000
+}
+
+type RecognizedSentence struct {
+	Text      string `json:"text"`
+	BeginTime int64  `json:"begin_time"` // 毫秒
+	EndTime   int64  `json:"end_time"`
+}
+
+type RecognitionResult struct {
+	Text      string                `json:"text"`
+	Sentences []*RecognizedSentence `json:"sentences"`
+}
+
+// SpeechSynthesizer 语音合成, 返回的音频边合成边读取, 读取完毕或不再需要时调用Close
+type SpeechSynthesizer interface {
+	Synthesize(ctx context.Context, request *SpeechRequest) (io.ReadCloser, error)
+	// SynthesizeStream 直接消费StreamChat的结果, 按句合成
+	SynthesizeStream(ctx context.Context, request *SpeechRequest, stream <-chan *ChatResponse) (io.ReadCloser, error)
+}
+
+// SpeechRecognizer 语音识别, 读取audio直到EOF后返回完整的识别结果
+// ctx取消后不再读取audio, 但无法中断正在阻塞的Read, 麦克风等实时音频源需要由调用方关闭
+type SpeechRecognizer interface {
+	Recognize(ctx context.Context, request *RecognitionRequest, audio io.Reader) (*RecognitionResult, error)
+}
+
+type SpeechClient interface {
+	SpeechSynthesizer
+	SpeechRecognizer
+}
+
+// SplitSentences 缓冲流式回复, 按标点切分为完整的句子并跳过代码块, 结束时输出剩余的文本
+func SplitSentences(ctx context.Context, stream <-chan *ChatResponse) <-chan string {
+	sentenceChan := make(chan string)
+	go func() {
+		defer close(sentenceChan)
+
+		send := func(sentences []string) bool {
+			for _, sentence := range sentences {
+				select {
+				case sentenceChan <- sentence:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		segmenter := &utils.SentenceSegmenter{SkipCode: true}
+		for {
+			select {
+			case resp, ok := <-stream:
+				if !ok {
+					send(segmenter.Flush())
+					return
+				}
+				if !send(segmenter.Do(resp.Content)) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return sentenceChan
+}
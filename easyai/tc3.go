@@ -0,0 +1,132 @@
+package easyai
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/utils"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	HunYuanDefaultVersion = "2023-09-01"
+
+	tc3Algorithm = "TC3-HMAC-SHA256"
+	tc3Service   = "hunyuan"
+)
+
+// newHunYuanRequest 构造带TC3签名的混元API请求, action对应X-TC-Action, language、region为空时不设置
+func newHunYuanRequest(ctx context.Context, credential *Credential, action, version, language string, region HunYuanRegionType, jsonBody []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", HunYuanBaseUrl, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	// 签名与请求头使用同一个时间戳
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", tc3Authorization(credential, action, string(jsonBody), timestamp))
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Version", version)
+	if language != "" {
+		req.Header.Set("X-TC-Language", language)
+	}
+	if region != "" {
+		req.Header.Set("X-TC-Region", string(region))
+	}
+	req.Header.Set("Host", HunYuanHost)
+	req.Header.Set("X-TC-Timestamp", fmt.Sprintf("%d", timestamp))
+
+	return req, nil
+}
+
+// tc3Authorization 计算腾讯云TC3-HMAC-SHA256签名
+func tc3Authorization(credential *Credential, action, payload string, timestamp int64) (authorization string) {
+	// 拼接canonical请求参数
+	httpRequestMethod := "POST"
+	canonicalURI := "/"
+	canonicalQueryString := ""
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-tc-action:%s\n",
+		"application/json", HunYuanHost, strings.ToLower(action))
+	signedHeaders := "content-type;host;x-tc-action"
+	hashedRequestPayload := utils.Sha256hex(payload)
+	canonicalRequest := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
+		httpRequestMethod,
+		canonicalURI,
+		canonicalQueryString,
+		canonicalHeaders,
+		signedHeaders,
+		hashedRequestPayload)
+
+	// 构建sign签名
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+	credentialScope := fmt.Sprintf("%s/%s/tc3_request", date, tc3Service)
+	hashedCanonicalRequest := utils.Sha256hex(canonicalRequest)
+	string2sign := fmt.Sprintf("%s\n%d\n%s\n%s",
+		tc3Algorithm,
+		timestamp,
+		credentialScope,
+		hashedCanonicalRequest)
+
+	// 签名字符串加密
+	secretDate := utils.HmacSha256(date, "TC3"+credential.SecretKey)
+	secretService := utils.HmacSha256(tc3Service, secretDate)
+	secretSigning := utils.HmacSha256("tc3_request", secretService)
+	signature := hex.EncodeToString([]byte(utils.HmacSha256(string2sign, secretSigning)))
+
+	// 组装authorization
+	authorization = fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		tc3Algorithm,
+		credential.SecretId,
+		credentialScope,
+		signedHeaders,
+		signature)
+
+	return
+}
+
+// doHunYuanJSONRequest 发送非流式请求, 返回Error时转为APIError, 成功时将结果反序列化到output
+func doHunYuanJSONRequest(ctx context.Context, config *ClientConfig, log *callLog, credential *Credential, action string, region HunYuanRegionType, jsonBody []byte, output interface{}) error {
+	log.dump(ctx, "llm request", jsonBody)
+
+	req, err := newHunYuanRequest(ctx, credential, action, HunYuanDefaultVersion, "", region, jsonBody)
+	if err != nil {
+		return fmt.Errorf("构造http请求失败, 原因: %w", err)
+	}
+
+	resp, err := config.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http请求失败, 原因: %w", err)
+	}
+	defer resp.Body.Close()
+
+	log.status = resp.StatusCode
+	respByte, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应数据失败, 原因: %w", err)
+	}
+	log.dump(ctx, "llm response", respByte)
+
+	// 各接口的公共字段
+	var common struct {
+		Response HunYuanResponseData `json:"Response"`
+	}
+	if err = json.Unmarshal(respByte, &common); err != nil {
+		return fmt.Errorf("http结果序列化失败, 原因: %v", err)
+	}
+	log.requestId = common.Response.RequestId
+	if common.Response.Error != nil {
+		return newHunYuanError(resp.StatusCode, common.Response.RequestId, common.Response.Error)
+	}
+
+	if err = json.Unmarshal(respByte, output); err != nil {
+		return fmt.Errorf("http结果序列化失败, 原因: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package easyai
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsAcceptGUID     = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxMessageSize = 32 << 20
+)
+
+// wsConn 最小实现的WebSocket客户端, 仅满足语音接口的需要
+type wsConn struct {
+	conn   io.ReadWriteCloser
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	once    sync.Once
+}
+
+// dialWebSocket 通过http.Client完成握手, 因此同样支持代理与自定义Transport
+// 握手失败时返回服务端的响应内容, 由调用方解析错误
+func dialWebSocket(ctx context.Context, client *http.Client, url string, header http.Header) (*wsConn, *http.Response, []byte, error) {
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+	secKey := base64.StdEncoding.EncodeToString(key)
+
+	// 握手使用http(s)协议, 建立连接后由调用方通过ctx关闭
+	url = strings.Replace(strings.Replace(url, "wss://", "https://", 1), "ws://", "http://", 1)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", secKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		return nil, resp, body, fmt.Errorf("websocket握手失败, status: %d", resp.StatusCode)
+	}
+
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		_ = resp.Body.Close()
+		return nil, resp, nil, errors.New("websocket握手失败, 连接不可写")
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(secKey) {
+		_ = conn.Close()
+		return nil, resp, nil, errors.New("websocket握手失败, Sec-WebSocket-Accept不正确")
+	}
+
+	return &wsConn{conn: conn, reader: bufio.NewReader(conn)}, resp, nil, nil
+}
+
+func wsAcceptKey(secKey string) string {
+	sum := sha1.Sum([]byte(secKey + wsAcceptGUID))
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (self *wsConn) writeBinary(data []byte) error {
+	return self.writeFrame(wsOpBinary, data)
+}
+
+// writeFrame 客户端发送的帧必须添加掩码
+func (self *wsConn) writeFrame(opcode byte, payload []byte) error {
+	self.writeMu.Lock()
+	defer self.writeMu.Unlock()
+
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	mask := make([]byte, 4)
+	_, _ = rand.Read(mask)
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := self.conn.Write(frame)
+
+	return err
+}
+
+// readMessage 读取一条完整的消息, 自动回复ping, 收到close时返回io.EOF
+func (self *wsConn) readMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, frameOp, payload, err := self.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOp {
+		case wsOpPing:
+			if err = self.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			return 0, nil, io.EOF
+		case wsOpContinuation:
+		default:
+			opcode, message = frameOp, nil
+		}
+
+		message = append(message, payload...)
+		if len(message) > wsMaxMessageSize {
+			return 0, nil, errors.New("websocket消息过大")
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (self *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(self.reader, header); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err = io.ReadFull(self.reader, extended); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err = io.ReadFull(self.reader, extended); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > wsMaxMessageSize {
+		err = errors.New("websocket消息过大")
+		return
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err = io.ReadFull(self.reader, mask); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(self.reader, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return
+}
+
+// close 发送close帧后关闭连接, 可重复调用
+func (self *wsConn) close() error {
+	var err error
+	self.once.Do(func() {
+		_ = self.writeFrame(wsOpClose, []byte{0x03, 0xE8}) // 1000 正常关闭
+		err = self.conn.Close()
+	})
+
+	return err
+}
@@ -0,0 +1,22 @@
+package easyllm
+
+import (
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+)
+
+// NewEmbeddingClient 根据配置创建文本向量客户端, 与NewChatClient使用相同的配置
+// 通义千问默认使用text-embedding-v2, 需要其他模型时可直接构造easyai.QWenEmbedding
+func NewEmbeddingClient(config *easyai.ClientConfig) (easyai.EmbeddingClient, error) {
+	switch config.Types {
+	case easyai.ChatTypeQWen:
+		return &easyai.QWenEmbedding{Config: config}, nil
+	case easyai.ChatTypeHunYuan:
+		if config.Credentials == nil && (config.SecretId == "" || config.SecretKey == "") {
+			return nil, fmt.Errorf("%w: 获取EmbeddingClient异常, 请配置SecretId和SecretKey { %s }", easyai.ErrInvalidRequest, config.Types)
+		}
+		return &easyai.HunYuanEmbedding{Config: config}, nil
+	}
+
+	return nil, fmt.Errorf("%w: 获取EmbeddingClient异常, 无效的LLM配置 { %s }", easyai.ErrInvalidRequest, config.Types)
+}
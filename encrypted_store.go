@@ -0,0 +1,269 @@
+package easyllm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/utils"
+	"sync"
+)
+
+// 加密后的会话保存在Metadata中的字段
+const (
+	envelopeKeyID   = "key_id"   // 加密数据密钥的主密钥ID
+	envelopeDataKey = "data_key" // 主密钥加密后的数据密钥
+	envelopePayload = "payload"  // 数据密钥加密后的会话内容
+)
+
+// KeyRing 主密钥集合, 新保存的会话使用当前的主密钥, 旧密钥用于读取更换密钥前保存的会话
+type KeyRing struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	primary string
+}
+
+// NewKeyRing 创建密钥集合, key的长度为16、24或32字节
+func NewKeyRing(id string, key []byte) (*KeyRing, error) {
+	ring := &KeyRing{keys: make(map[string][]byte)}
+	if err := ring.Add(id, key); err != nil {
+		return nil, err
+	}
+	ring.primary = id
+
+	return ring, nil
+}
+
+// Add 添加密钥, 不改变当前的主密钥
+func (self *KeyRing) Add(id string, key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("密钥%q的长度需为16、24或32字节", id)
+	}
+	if id == "" {
+		return errors.New("密钥ID不能为空")
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.keys[id] = append([]byte(nil), key...)
+
+	return nil
+}
+
+// SetPrimary 切换主密钥, 之后保存的会话使用该密钥
+func (self *KeyRing) SetPrimary(id string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if _, ok := self.keys[id]; !ok {
+		return fmt.Errorf("未知的密钥%q", id)
+	}
+	self.primary = id
+
+	return nil
+}
+
+// Remove 移除不再使用的密钥, 不能移除主密钥
+func (self *KeyRing) Remove(id string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if id == self.primary {
+		return fmt.Errorf("密钥%q是当前的主密钥, 不能移除", id)
+	}
+	delete(self.keys, id)
+
+	return nil
+}
+
+// Primary 当前的主密钥ID
+func (self *KeyRing) Primary() string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return self.primary
+}
+
+func (self *KeyRing) key(id string) ([]byte, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	key, ok := self.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("未知的密钥%q", id)
+	}
+
+	return key, nil
+}
+
+// EncryptedStore 加密保存会话的MemoryStore包装
+// 每次保存随机生成数据密钥, 以AES-GCM加密会话内容, 数据密钥再由KeyRing中的主密钥加密
+// 会话ID以HMAC-SHA256计算后作为底层存储的ID, 不解密即可按ID读取, 且底层存储中不出现原始ID
+type EncryptedStore struct {
+	store    MemoryStore
+	keys     *KeyRing
+	indexKey string
+}
+
+// NewEncryptedStore indexKey用于计算会话ID的索引, 更换后将无法找到之前保存的会话
+func NewEncryptedStore(store MemoryStore, keys *KeyRing, indexKey []byte) (*EncryptedStore, error) {
+	if len(indexKey) < 16 {
+		return nil, errors.New("索引密钥的长度不能少于16字节")
+	}
+
+	return &EncryptedStore{store: store, keys: keys, indexKey: string(indexKey)}, nil
+}
+
+// Index 会话ID在底层存储中的ID
+func (self *EncryptedStore) Index(id string) string {
+	return hex.EncodeToString([]byte(utils.HmacSha256(id, self.indexKey)))
+}
+
+func (self *EncryptedStore) Load(ctx context.Context, id string) (*Session, error) {
+	index := self.Index(id)
+	envelope, err := self.store.Load(ctx, index)
+	if err != nil || envelope == nil {
+		return nil, err
+	}
+
+	dataKey, err := self.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Metadata[envelopePayload])
+	if err != nil {
+		return nil, fmt.Errorf("会话%q的内容格式错误, 原因: %w", id, err)
+	}
+	content, err := utils.AesGcmDecrypt(payload, dataKey, []byte(index))
+	if err != nil {
+		return nil, fmt.Errorf("解密会话%q失败, 原因: %w", id, err)
+	}
+
+	session := new(Session)
+	if err = json.Unmarshal(content, session); err != nil {
+		return nil, fmt.Errorf("解析会话%q失败, 原因: %w", id, err)
+	}
+	// 版本以底层存储为准
+	session.Version, session.UpdateTime = envelope.Version, envelope.UpdateTime
+
+	return session, nil
+}
+
+func (self *EncryptedStore) Save(ctx context.Context, session *Session) error {
+	index := self.Index(session.ID)
+	content, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err = rand.Read(dataKey); err != nil {
+		return err
+	}
+	payload, err := utils.AesGcmEncrypt(content, dataKey, []byte(index))
+	if err != nil {
+		return err
+	}
+
+	envelope := &Session{ID: index, Version: session.Version, Metadata: map[string]string{
+		envelopePayload: base64.StdEncoding.EncodeToString(payload),
+	}}
+	if err = self.wrap(envelope, dataKey); err != nil {
+		return err
+	}
+	if err = self.store.Save(ctx, envelope); err != nil {
+		return err
+	}
+	session.Version, session.UpdateTime = envelope.Version, envelope.UpdateTime
+
+	return nil
+}
+
+func (self *EncryptedStore) Delete(ctx context.Context, id string) error {
+	return self.store.Delete(ctx, self.Index(id))
+}
+
+// Rotate 将底层存储中不是由当前主密钥加密的会话改用主密钥重新加密, 返回处理的会话数
+// 只重新加密数据密钥, 不解密会话内容; 完成后即可从KeyRing中移除旧密钥, 底层存储需实现SessionLister
+func (self *EncryptedStore) Rotate(ctx context.Context) (int, error) {
+	lister, ok := self.store.(SessionLister)
+	if !ok {
+		return 0, errors.New("底层存储不支持列出会话")
+	}
+	indexes, err := lister.SessionIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	primary := self.keys.Primary()
+	for _, index := range indexes {
+		if err = ctx.Err(); err != nil {
+			return count, err
+		}
+		envelope, err := self.store.Load(ctx, index)
+		if err != nil {
+			return count, err
+		}
+		if envelope == nil || envelope.Metadata[envelopeKeyID] == primary {
+			continue
+		}
+
+		dataKey, err := self.unwrap(envelope)
+		if err != nil {
+			return count, err
+		}
+		if err = self.wrap(envelope, dataKey); err != nil {
+			return count, err
+		}
+		// 期间会话已被重新保存, 保存时使用的已是当前的主密钥
+		if err = self.store.Save(ctx, envelope); errors.Is(err, ErrSessionConflict) {
+			continue
+		} else if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// wrap 以当前的主密钥加密数据密钥, 主密钥ID与索引作为附加数据, 避免替换为其他会话的数据密钥
+func (self *EncryptedStore) wrap(envelope *Session, dataKey []byte) error {
+	id := self.keys.Primary()
+	key, err := self.keys.key(id)
+	if err != nil {
+		return err
+	}
+	wrapped, err := utils.AesGcmEncrypt(dataKey, key, []byte(id+":"+envelope.ID))
+	if err != nil {
+		return err
+	}
+	envelope.Metadata[envelopeKeyID] = id
+	envelope.Metadata[envelopeDataKey] = base64.StdEncoding.EncodeToString(wrapped)
+
+	return nil
+}
+
+func (self *EncryptedStore) unwrap(envelope *Session) ([]byte, error) {
+	id := envelope.Metadata[envelopeKeyID]
+	key, err := self.keys.key(id)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(envelope.Metadata[envelopeDataKey])
+	if err != nil {
+		return nil, fmt.Errorf("数据密钥格式错误, 原因: %w", err)
+	}
+	dataKey, err := utils.AesGcmDecrypt(wrapped, key, []byte(id+":"+envelope.ID))
+	if err != nil {
+		return nil, fmt.Errorf("解密数据密钥失败, 原因: %w", err)
+	}
+
+	return dataKey, nil
+}
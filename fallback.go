@@ -0,0 +1,261 @@
+package easyllm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultCooldown         = 30 * time.Second
+)
+
+var ErrNoAvailableProvider = errors.New("没有可用的大模型服务")
+
+// FallbackHop 故障转移链路中的一个节点
+type FallbackHop struct {
+	Name    string // 用于标识实际应答的服务, 为空时使用服务自身返回的值
+	Client  LLMChatInterface
+	Model   string        // 非空时替换请求中的Model
+	Timeout time.Duration // NormalChat为整体超时, StreamChat为等待首个分片的超时
+
+	breaker circuitBreaker
+}
+
+// FallbackClient 按顺序调用多个大模型服务, 前一个失败时自动切换到下一个
+type FallbackClient struct {
+	hops []*FallbackHop
+
+	FailureThreshold int           // 连续失败多少次后熔断
+	Cooldown         time.Duration // 熔断后跳过该服务的时长
+	Retryable        func(err error) bool
+}
+
+func NewFallbackClient(hops ...*FallbackHop) *FallbackClient {
+	return &FallbackClient{
+		hops:             hops,
+		FailureThreshold: defaultFailureThreshold,
+		Cooldown:         defaultCooldown,
+		Retryable:        isRetryableErr,
+	}
+}
+
+func (self *FallbackClient) SetCustomParams(params interface{}) {
+	for _, hop := range self.hops {
+		hop.Client.SetCustomParams(params)
+	}
+}
+
+func (self *FallbackClient) NormalChat(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+	var errs []error
+	for _, hop := range self.hops {
+		if !hop.breaker.allow() {
+			continue
+		}
+
+		resp, reply, err := self.normalChat(ctx, hop, request)
+		if err == nil {
+			hop.breaker.success()
+			self.markProvider(hop, resp)
+
+			return resp, reply, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", hop.label(), err))
+		// 调用方取消或超时不是服务的故障, 不计入熔断
+		if ctx.Err() != nil {
+			break
+		}
+		hop.breaker.failure(self.FailureThreshold, self.Cooldown)
+		if !self.Retryable(err) {
+			break
+		}
+	}
+
+	return nil, nil, self.joinErrors(errs)
+}
+
+func (self *FallbackClient) StreamChat(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+	var errs []error
+	for _, hop := range self.hops {
+		if !hop.breaker.allow() {
+			continue
+		}
+
+		hopCtx, cancel := context.WithCancel(ctx)
+		first, stream, err := self.streamChat(hopCtx, cancel, hop, request)
+		if err == nil {
+			hop.breaker.success()
+
+			return self.forward(hopCtx, hop, first, stream, cancel), nil
+		}
+
+		cancel()
+		errs = append(errs, fmt.Errorf("%s: %w", hop.label(), err))
+		// 调用方取消或超时不是服务的故障, 不计入熔断
+		if ctx.Err() != nil {
+			break
+		}
+		hop.breaker.failure(self.FailureThreshold, self.Cooldown)
+		if !self.Retryable(err) {
+			break
+		}
+	}
+
+	return nil, self.joinErrors(errs)
+}
+
+func (self *FallbackClient) normalChat(ctx context.Context, hop *FallbackHop, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+	if hop.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hop.Timeout)
+		defer cancel()
+	}
+
+	return hop.Client.NormalChat(ctx, self.remapRequest(hop, request))
+}
+
+// 建立流式连接并等待首个分片, 收到首个分片后才认为该服务可用
+func (self *FallbackClient) streamChat(ctx context.Context, cancel context.CancelFunc, hop *FallbackHop, request *easyai.ChatRequest) (*easyai.ChatResponse, <-chan *easyai.ChatResponse, error) {
+	var timedOut atomic.Bool
+	stopTimer := func() bool { return true }
+	if hop.Timeout > 0 {
+		timer := time.AfterFunc(hop.Timeout, func() {
+			timedOut.Store(true)
+			cancel()
+		})
+		stopTimer = timer.Stop
+		defer timer.Stop()
+	}
+
+	stream, err := hop.Client.StreamChat(ctx, self.remapRequest(hop, request))
+	if err != nil {
+		if timedOut.Load() {
+			return nil, nil, context.DeadlineExceeded
+		}
+
+		return nil, nil, err
+	}
+
+	select {
+	case first, ok := <-stream:
+		if ok && stopTimer() {
+			return first, stream, nil
+		}
+		if ok {
+			go drain(stream)
+		} else if !timedOut.Load() {
+			return nil, nil, errors.New("流式响应未返回任何数据")
+		}
+	case <-ctx.Done():
+		go drain(stream)
+	}
+
+	if timedOut.Load() {
+		return nil, nil, context.DeadlineExceeded
+	}
+
+	return nil, nil, ctx.Err()
+}
+
+func (self *FallbackClient) forward(ctx context.Context, hop *FallbackHop, first *easyai.ChatResponse, stream <-chan *easyai.ChatResponse, cancel context.CancelFunc) <-chan *easyai.ChatResponse {
+	messageChan := make(chan *easyai.ChatResponse)
+	go func() {
+		defer cancel()
+		defer close(messageChan)
+
+		for resp := first; resp != nil; resp = <-stream {
+			self.markProvider(hop, resp)
+			select {
+			case messageChan <- resp:
+			case <-ctx.Done():
+				go drain(stream)
+				return
+			}
+		}
+	}()
+
+	return messageChan
+}
+
+func (self *FallbackClient) remapRequest(hop *FallbackHop, request *easyai.ChatRequest) *easyai.ChatRequest {
+	// 各服务会修改请求, 每一跳都使用副本
+	clone := cloneRequest(request)
+	if clone != nil && hop.Model != "" {
+		clone.Model = hop.Model
+	}
+
+	return clone
+}
+
+func (self *FallbackHop) label() string {
+	if self.Name != "" {
+		return self.Name
+	}
+
+	return fmt.Sprintf("%T", self.Client)
+}
+
+func (self *FallbackClient) markProvider(hop *FallbackHop, resp *easyai.ChatResponse) {
+	if resp != nil && hop.Name != "" {
+		resp.Provider = hop.Name
+	}
+}
+
+func (self *FallbackClient) joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return ErrNoAvailableProvider
+	}
+
+	return fmt.Errorf("所有大模型服务均调用失败: { %w }", errors.Join(errs...))
+}
+
+// 调用方主动取消、请求本身不合法、内容未通过审核时不再切换, 其余错误均尝试下一个服务
+func isRetryableErr(err error) bool {
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, easyai.ErrInvalidRequest) &&
+		!errors.Is(err, easyai.ErrContentFiltered)
+}
+
+func drain(stream <-chan *easyai.ChatResponse) {
+	for range stream {
+	}
+}
+
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func (self *circuitBreaker) allow() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return !time.Now().Before(self.openUntil)
+}
+
+func (self *circuitBreaker) success() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.failures = 0
+	self.openUntil = time.Time{}
+}
+
+func (self *circuitBreaker) failure(threshold int, cooldown time.Duration) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.failures++
+	if threshold > 0 && self.failures >= threshold {
+		// 冷却结束后的首次调用再失败会立即重新熔断
+		self.failures = threshold - 1
+		self.openUntil = time.Now().Add(cooldown)
+	}
+}
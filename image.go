@@ -0,0 +1,22 @@
+package easyllm
+
+import (
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+)
+
+// NewImageClient 根据配置创建文生图客户端, 与NewChatClient使用相同的配置
+// 通义千问对应通义万相, 默认使用wanx-v1; 混元默认使用ap-guangzhou地域
+func NewImageClient(config *easyai.ClientConfig) (easyai.ImageClient, error) {
+	switch config.Types {
+	case easyai.ChatTypeQWen:
+		return &easyai.QWenImage{Config: config}, nil
+	case easyai.ChatTypeHunYuan:
+		if config.Credentials == nil && (config.SecretId == "" || config.SecretKey == "") {
+			return nil, fmt.Errorf("%w: 获取ImageClient异常, 请配置SecretId和SecretKey { %s }", easyai.ErrInvalidRequest, config.Types)
+		}
+		return &easyai.HunYuanImage{Config: config}, nil
+	}
+
+	return nil, fmt.Errorf("%w: 获取ImageClient异常, 无效的LLM配置 { %s }", easyai.ErrInvalidRequest, config.Types)
+}
@@ -2,6 +2,7 @@ package easyllm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/soryetong/go-easy-llm/easyai"
 	"os"
@@ -10,6 +11,10 @@ import (
 type ChatClient struct {
 	*easyai.ClientConfig
 	LLMChatInterface
+
+	middlewares []Middleware
+	handler     ChatHandler
+	scope       string // 服务商与全局参数, 参与缓存键的计算
 }
 
 type LLMChatInterface interface {
@@ -20,9 +25,13 @@ type LLMChatInterface interface {
 }
 
 func NewChatClient(config *easyai.ClientConfig) *ChatClient {
+	llm := getLLM(config)
+
 	return &ChatClient{
-		config,
-		getLLM(config),
+		ClientConfig:     config,
+		LLMChatInterface: llm,
+		handler:          llm,
+		scope:            string(config.Types),
 	}
 }
 
@@ -32,12 +41,54 @@ func (c *ChatClient) SetGlobalParams(params interface{}) *ChatClient {
 	return c
 }
 
+func (c *ChatClient) SetCustomParams(params interface{}) {
+	c.LLMChatInterface.SetCustomParams(params)
+	marshal, _ := json.Marshal(params)
+	c.scope = string(c.Types) + "\x00" + string(marshal)
+}
+
+// Use 注册中间件, 需在发起调用前完成注册
+func (c *ChatClient) Use(middlewares ...Middleware) *ChatClient {
+	c.middlewares = append(c.middlewares, middlewares...)
+	c.handler = Chain(c.LLMChatInterface, c.middlewares...)
+
+	return c
+}
+
+func (c *ChatClient) NormalChat(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+	return c.handler.NormalChat(withCacheScope(ctx, c.scope), c.normalizeRequest(request, false))
+}
+
+func (c *ChatClient) StreamChat(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+	return c.handler.StreamChat(withCacheScope(ctx, c.scope), c.normalizeRequest(request, true))
+}
+
+// 中间件拿到的是补全默认值后的请求副本, 不会修改调用方传入的请求
+func (c *ChatClient) normalizeRequest(request *easyai.ChatRequest, stream bool) *easyai.ChatRequest {
+	clone := cloneRequest(request)
+	if clone == nil {
+		return nil
+	}
+
+	clone.Stream = stream
+	if clone.Model == "" {
+		switch c.Types {
+		case easyai.ChatTypeQWen:
+			clone.Model = easyai.ChatModelQWenTurbo
+		case easyai.ChatTypeHunYuan:
+			clone.Model = easyai.ChatModelHunYuanPro
+		}
+	}
+
+	return clone
+}
+
 func getLLM(cfg *easyai.ClientConfig) LLMChatInterface {
 	switch cfg.Types {
 	case easyai.ChatTypeQWen:
 		return &easyai.QWenChat{Config: cfg}
 	case easyai.ChatTypeHunYuan:
-		if cfg.SecretId == "" || cfg.SecretKey == "" {
+		if cfg.Credentials == nil && (cfg.SecretId == "" || cfg.SecretKey == "") {
 			_, _ = fmt.Fprintf(os.Stderr, "\n\n [go-easy-llm] \n"+
 				"  获取Client异常: 请配置SecretId和SecretKey,{ %s } \n\n", cfg.Types)
 
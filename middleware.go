@@ -0,0 +1,226 @@
+package easyllm
+
+import (
+	"context"
+	"errors"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"log/slog"
+	"time"
+)
+
+// ChatHandler 中间件之间传递的调用链节点, LLMChatInterface、ChatClient、FallbackClient均满足该接口
+type ChatHandler interface {
+	NormalChat(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error)
+	StreamChat(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error)
+}
+
+// Middleware 包装下一个节点, 先注册的中间件位于外层, 即 Use(A, B) 的调用顺序为 A -> B -> 大模型
+type Middleware func(next ChatHandler) ChatHandler
+
+type NormalChatFunc func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error)
+
+type StreamChatFunc func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error)
+
+type chatHandlerFuncs struct {
+	normal NormalChatFunc
+	stream StreamChatFunc
+}
+
+func (self *chatHandlerFuncs) NormalChat(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+	return self.normal(ctx, request)
+}
+
+func (self *chatHandlerFuncs) StreamChat(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+	return self.stream(ctx, request)
+}
+
+// HandlerFuncs 由两个函数组装ChatHandler, 只需拦截一种调用时另一个直接传 next.NormalChat 或 next.StreamChat
+func HandlerFuncs(normal NormalChatFunc, stream StreamChatFunc) ChatHandler {
+	return &chatHandlerFuncs{normal: normal, stream: stream}
+}
+
+// Chain 为任意ChatHandler套上中间件
+func Chain(handler ChatHandler, middlewares ...Middleware) ChatHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// TapStream 转发流式响应, 每个分片转发前调用onChunk, 流结束后调用onDone
+func TapStream(ctx context.Context, stream <-chan *easyai.ChatResponse, onChunk func(resp *easyai.ChatResponse), onDone func()) <-chan *easyai.ChatResponse {
+	messageChan := make(chan *easyai.ChatResponse)
+	go func() {
+		defer close(messageChan)
+		if onDone != nil {
+			defer onDone()
+		}
+
+		for resp := range stream {
+			if onChunk != nil {
+				onChunk(resp)
+			}
+			select {
+			case messageChan <- resp:
+			case <-ctx.Done():
+				go drain(stream)
+				return
+			}
+		}
+	}()
+
+	return messageChan
+}
+
+// LoggingMiddleware 记录每次调用的模型、耗时、结果
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(next ChatHandler) ChatHandler {
+		normal := func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+			start, model := time.Now(), requestModel(request)
+			resp, reply, err := next.NormalChat(ctx, request)
+			attrs := []any{slog.String("model", model), slog.Duration("latency", time.Since(start))}
+			if err != nil {
+				logger.ErrorContext(ctx, "chat failed", append(attrs, slog.Any("error", err))...)
+			} else {
+				logger.InfoContext(ctx, "chat completed", append(attrs, slog.Int("content_length", len(resp.Content)))...)
+			}
+
+			return resp, reply, err
+		}
+		stream := func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+			start, model := time.Now(), requestModel(request)
+			messageChan, err := next.StreamChat(ctx, request)
+			if err != nil {
+				logger.ErrorContext(ctx, "stream chat failed", slog.String("model", model),
+					slog.Duration("latency", time.Since(start)), slog.Any("error", err))
+
+				return nil, err
+			}
+
+			chunks, length := 0, 0
+			return TapStream(ctx, messageChan, func(resp *easyai.ChatResponse) {
+				chunks++
+				length += len(resp.Content)
+			}, func() {
+				logger.InfoContext(ctx, "stream chat completed", slog.String("model", model),
+					slog.Duration("latency", time.Since(start)), slog.Int("chunks", chunks), slog.Int("content_length", length))
+			}), nil
+		}
+
+		return HandlerFuncs(normal, stream)
+	}
+}
+
+// RetryMiddleware 调用遇到临时性错误(见easyai.IsTransient)时按指数退避重试, 流式调用只重试建立连接的阶段
+func RetryMiddleware(attempts int, backoff time.Duration) Middleware {
+	return func(next ChatHandler) ChatHandler {
+		normal := func(ctx context.Context, request *easyai.ChatRequest) (resp *easyai.ChatResponse, reply interface{}, err error) {
+			err = retry(ctx, attempts, backoff, func() error {
+				resp, reply, err = next.NormalChat(ctx, cloneRequest(request))
+				return err
+			})
+
+			return
+		}
+		stream := func(ctx context.Context, request *easyai.ChatRequest) (messageChan <-chan *easyai.ChatResponse, err error) {
+			err = retry(ctx, attempts, backoff, func() error {
+				messageChan, err = next.StreamChat(ctx, cloneRequest(request))
+				return err
+			})
+
+			return
+		}
+
+		return HandlerFuncs(normal, stream)
+	}
+}
+
+// TimeoutMiddleware 限制单次调用的总时长, 流式调用超时后会提前结束
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next ChatHandler) ChatHandler {
+		normal := func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			return next.NormalChat(ctx, request)
+		}
+		stream := func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			messageChan, err := next.StreamChat(ctx, request)
+			if err != nil {
+				cancel()
+
+				return nil, err
+			}
+
+			return TapStream(ctx, messageChan, nil, cancel), nil
+		}
+
+		return HandlerFuncs(normal, stream)
+	}
+}
+
+// GuardrailMiddleware 在请求发往大模型之前进行校验, check返回错误时直接拒绝
+func GuardrailMiddleware(check func(ctx context.Context, request *easyai.ChatRequest) error) Middleware {
+	return func(next ChatHandler) ChatHandler {
+		normal := func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+			if err := check(ctx, request); err != nil {
+				return nil, nil, err
+			}
+
+			return next.NormalChat(ctx, request)
+		}
+		stream := func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+			if err := check(ctx, request); err != nil {
+				return nil, err
+			}
+
+			return next.StreamChat(ctx, request)
+		}
+
+		return HandlerFuncs(normal, stream)
+	}
+}
+
+func retry(ctx context.Context, attempts int, backoff time.Duration, fn func() error) error {
+	var err error
+	for i := 0; i < max(attempts, 1); i++ {
+		if i > 0 {
+			select {
+			case <-time.After(backoff << (i - 1)):
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			}
+		}
+
+		if err = fn(); err == nil || ctx.Err() != nil || !easyai.IsTransient(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// requestModel 请求为nil时交给下游返回ErrInvalidRequest, 这里不能直接取字段
+func requestModel(request *easyai.ChatRequest) string {
+	if request == nil {
+		return ""
+	}
+
+	return request.Model
+}
+
+func cloneRequest(request *easyai.ChatRequest) *easyai.ChatRequest {
+	if request == nil {
+		return nil
+	}
+
+	clone := *request
+
+	return &clone
+}
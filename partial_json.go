@@ -0,0 +1,528 @@
+package easyllm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// PartialJSONParser 累积流式回复的片段, 每次输出尽力解析的结果:
+// 未结束的字符串按已收到的内容闭合, 数组包含已收到的元素, 对象只包含键已完整的字段,
+// 未结束的数字与true/false/null暂不输出; 第一个{或[之前的内容(如代码块标记)会被忽略
+// 解析是增量的, 每次只扫描新的片段; 返回的值会在后续Feed时原地更新, 需要保留时请自行复制
+type PartialJSONParser struct {
+	pending  string // 尚无法解析的内容, 如被截断的转义符、数字与字面量
+	offset   int    // pending在全部内容中的偏移
+	started  bool
+	complete bool
+	err      error
+
+	root  interface{}
+	stack []*partialFrame  // 尚未结束的对象与数组
+	text  *strings.Builder // 正在接收的字符串, nil表示不在字符串中
+	isKey bool             // text是对象的键
+
+	changed     map[string]bool // 本次Feed修改过的顶层字段, 供PartialDecoder只解码有变化的部分
+	changedFrom int             // 顶层为数组时本次修改过的第一个下标, -1表示没有修改
+}
+
+type partialState int
+
+const (
+	expectKey   partialState = iota // 对象的键、,或}
+	expectColon                     // 键之后的冒号
+	expectValue                     // 值, 数组中还可以是,或]
+)
+
+type partialFrame struct {
+	object  map[string]interface{}
+	array   []interface{}
+	isArray bool
+	key     string // 对象中当前的键
+	state   partialState
+}
+
+func NewPartialJSONParser() *PartialJSONParser {
+	return &PartialJSONParser{changed: make(map[string]bool), changedFrom: -1}
+}
+
+// Feed 追加片段并返回当前的解析结果, 尚未出现JSON时返回nil
+func (self *PartialJSONParser) Feed(delta string) (interface{}, error) {
+	clear(self.changed)
+	self.changedFrom = -1
+	if self.err != nil {
+		return nil, self.err
+	}
+	if self.complete {
+		return self.root, nil
+	}
+
+	scanner := &partialScanner{data: self.pending + delta, base: self.offset}
+	if !self.started {
+		if scanner.pos = strings.IndexAny(scanner.data, "{["); scanner.pos < 0 {
+			self.pending, self.offset = "", self.offset+len(scanner.data)
+			return nil, nil
+		}
+		self.started = true
+	}
+
+	if self.err = self.scan(scanner); self.err != nil {
+		return nil, self.err
+	}
+	self.pending, self.offset = scanner.data[scanner.pos:], scanner.base+scanner.pos
+
+	return self.root, nil
+}
+
+// Complete 顶层的对象或数组是否已经结束
+func (self *PartialJSONParser) Complete() bool {
+	return self.complete
+}
+
+// scan 从上次停下的位置继续解析, 内容不足时停在无法解析的位置
+func (self *PartialJSONParser) scan(scanner *partialScanner) error {
+	for !self.complete {
+		if self.text != nil {
+			if done, err := self.scanString(scanner); !done || err != nil {
+				return err
+			}
+			continue
+		}
+
+		scanner.skipSpace()
+		if scanner.eof() {
+			return nil
+		}
+		if len(self.stack) == 0 {
+			if _, err := self.scanValue(scanner); err != nil {
+				return err
+			}
+			continue
+		}
+
+		frame := self.stack[len(self.stack)-1]
+		switch c := scanner.data[scanner.pos]; {
+		case frame.state == expectKey && c == '}', frame.isArray && c == ']':
+			scanner.pos++
+			self.pop()
+		case frame.state == expectKey && c == ',', frame.isArray && c == ',':
+			scanner.pos++
+		case frame.state == expectKey:
+			if c != '"' {
+				return scanner.errorf("对象的键应为字符串")
+			}
+			scanner.pos++
+			self.text, self.isKey = new(strings.Builder), true
+		case frame.state == expectColon:
+			if c != ':' {
+				return scanner.errorf("缺少冒号")
+			}
+			scanner.pos++
+			frame.state = expectValue
+		default:
+			if ok, err := self.scanValue(scanner); !ok || err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// scanValue 解析值的开头, 数字与字面量不完整时返回false, 等待后续片段
+func (self *PartialJSONParser) scanValue(scanner *partialScanner) (bool, error) {
+	switch c := scanner.data[scanner.pos]; {
+	case c == '{':
+		scanner.pos++
+		frame := &partialFrame{object: make(map[string]interface{}), state: expectKey}
+		self.attach(frame.object)
+		self.stack = append(self.stack, frame)
+	case c == '[':
+		scanner.pos++
+		frame := &partialFrame{array: make([]interface{}, 0), isArray: true, state: expectValue}
+		self.attach(frame.array)
+		self.stack = append(self.stack, frame)
+	case c == '"':
+		scanner.pos++
+		self.text, self.isKey = new(strings.Builder), false
+		self.attach("")
+	case c == '-' || (c >= '0' && c <= '9'):
+		end := scanner.pos
+		for end < len(scanner.data) && strings.IndexByte("+-0123456789.eE", scanner.data[end]) >= 0 {
+			end++
+		}
+		// 数字可能尚未结束
+		if end == len(scanner.data) {
+			return false, nil
+		}
+		number, err := strconv.ParseFloat(scanner.data[scanner.pos:end], 64)
+		if err != nil {
+			return false, scanner.errorf("不合法的数字%s", scanner.data[scanner.pos:end])
+		}
+		scanner.pos = end
+		self.attach(number)
+	case c == 't' || c == 'f' || c == 'n':
+		rest := scanner.data[scanner.pos:]
+		for _, literal := range []string{"true", "false", "null"} {
+			if strings.HasPrefix(rest, literal) {
+				scanner.pos += len(literal)
+				self.attach(jsonLiterals[literal])
+				return true, nil
+			}
+			if strings.HasPrefix(literal, rest) {
+				return false, nil
+			}
+		}
+		return false, scanner.errorf("意外的字面量")
+	default:
+		return false, scanner.errorf("意外的字符%q", c)
+	}
+
+	return true, nil
+}
+
+// scanString 接收字符串的内容, 末尾不完整的转义符与多字节字符留到下次解析
+func (self *PartialJSONParser) scanString(scanner *partialScanner) (bool, error) {
+	for !scanner.eof() {
+		c := scanner.data[scanner.pos]
+		switch {
+		case c == '"':
+			scanner.pos++
+			if self.isKey {
+				frame := self.stack[len(self.stack)-1]
+				frame.key, frame.state = self.text.String(), expectColon
+			} else {
+				self.replace(self.text.String())
+			}
+			self.text = nil
+			return true, nil
+		case c == '\\':
+			if scanner.pos+1 >= len(scanner.data) {
+				self.flush()
+				return false, nil
+			}
+			escape := scanner.data[scanner.pos+1]
+			if escape == 'u' {
+				r, size, truncated, err := scanner.parseUnicodeEscape(scanner.pos)
+				if err != nil {
+					return false, err
+				}
+				if truncated {
+					self.flush()
+					return false, nil
+				}
+				self.text.WriteRune(r)
+				scanner.pos += size
+				continue
+			}
+
+			replacement, ok := jsonEscapes[escape]
+			if !ok {
+				return false, scanner.errorf("不合法的转义符\\%c", escape)
+			}
+			self.text.WriteString(replacement)
+			scanner.pos += 2
+		case c < 0x20:
+			return false, scanner.errorf("字符串中包含控制字符")
+		default:
+			// 多字节字符被截断时等待后续片段
+			r, size := utf8.DecodeRuneInString(scanner.data[scanner.pos:])
+			if r == utf8.RuneError && !utf8.FullRuneInString(scanner.data[scanner.pos:]) {
+				self.flush()
+				return false, nil
+			}
+			self.text.WriteString(scanner.data[scanner.pos : scanner.pos+size])
+			scanner.pos += size
+		}
+	}
+
+	self.flush()
+
+	return false, nil
+}
+
+// flush 字符串未结束时先输出已收到的内容
+func (self *PartialJSONParser) flush() {
+	if !self.isKey {
+		self.replace(self.text.String())
+	}
+}
+
+// attach 将新的值加入当前的对象或数组
+func (self *PartialJSONParser) attach(value interface{}) {
+	if len(self.stack) == 0 {
+		self.root = value
+		return
+	}
+
+	frame := self.stack[len(self.stack)-1]
+	if frame.isArray {
+		frame.array = append(frame.array, value)
+		self.store(len(self.stack) - 1)
+	} else {
+		frame.object[frame.key] = value
+		frame.state = expectKey
+	}
+	self.touch()
+}
+
+// replace 更新当前的对象或数组中最后一个值, 即正在接收的字符串
+func (self *PartialJSONParser) replace(value interface{}) {
+	frame := self.stack[len(self.stack)-1]
+	if frame.isArray {
+		frame.array[len(frame.array)-1] = value
+	} else {
+		frame.object[frame.key] = value
+	}
+	self.touch()
+}
+
+// store 数组追加元素后切片可能重新分配, 需要写回上一层
+func (self *PartialJSONParser) store(index int) {
+	array := self.stack[index].array
+	if index == 0 {
+		self.root = array
+		return
+	}
+
+	parent := self.stack[index-1]
+	if parent.isArray {
+		parent.array[len(parent.array)-1] = array
+	} else {
+		parent.object[parent.key] = array
+	}
+}
+
+func (self *PartialJSONParser) pop() {
+	if self.stack = self.stack[:len(self.stack)-1]; len(self.stack) == 0 {
+		self.complete = true
+	}
+}
+
+// touch 记录本次修改的顶层字段, 嵌套的修改都发生在顶层当前的字段或最后一个元素中
+func (self *PartialJSONParser) touch() {
+	root := self.stack[0]
+	if !root.isArray {
+		self.changed[root.key] = true
+		return
+	}
+	if index := len(root.array) - 1; self.changedFrom < 0 || index < self.changedFrom {
+		self.changedFrom = index
+	}
+}
+
+var (
+	jsonEscapes  = map[byte]string{'"': "\"", '\\': "\\", '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}
+	jsonLiterals = map[string]interface{}{"true": true, "false": false, "null": nil}
+)
+
+type partialScanner struct {
+	data string
+	pos  int
+	base int // data在全部内容中的偏移
+}
+
+func (self *partialScanner) eof() bool {
+	return self.pos >= len(self.data)
+}
+
+func (self *partialScanner) skipSpace() {
+	for !self.eof() && strings.IndexByte(" \t\r\n", self.data[self.pos]) >= 0 {
+		self.pos++
+	}
+}
+
+func (self *partialScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("偏移%d处不是合法的JSON: %s", self.base+self.pos, fmt.Sprintf(format, args...))
+}
+
+// parseUnicodeEscape 解析\uXXXX, 包括代理对; truncated表示转义符被截断, 需等待后续片段
+func (self *partialScanner) parseUnicodeEscape(pos int) (r rune, size int, truncated bool, err error) {
+	readHex := func(at int) (rune, bool, error) {
+		if at+6 > len(self.data) {
+			return 0, true, nil
+		}
+		if self.data[at] != '\\' || self.data[at+1] != 'u' {
+			return 0, false, self.errorf("不合法的\\u转义")
+		}
+		value, err := strconv.ParseUint(self.data[at+2:at+6], 16, 16)
+		if err != nil {
+			return 0, false, self.errorf("不合法的\\u转义")
+		}
+		return rune(value), false, nil
+	}
+
+	if r, truncated, err = readHex(pos); truncated || err != nil {
+		return 0, 0, truncated, err
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, 6, false, nil
+	}
+
+	// 代理对的后半部分缺失时按encoding/json的处理方式替换为RuneError
+	if pos+8 > len(self.data) {
+		return 0, 0, true, nil
+	}
+	if self.data[pos+6] != '\\' || self.data[pos+7] != 'u' {
+		return utf8.RuneError, 6, false, nil
+	}
+	low, truncated, err := readHex(pos + 6)
+	if truncated || err != nil {
+		return 0, 0, truncated, err
+	}
+	if decoded := utf16.DecodeRune(r, low); decoded != utf8.RuneError {
+		return decoded, 12, false, nil
+	}
+
+	return utf8.RuneError, 6, false, nil
+}
+
+// PartialDecoder 将流式回复逐步解析到T中, 每次返回基于已收到内容的新值
+// T为结构体或map时只重新解码有变化的顶层字段, 为切片时只解码有变化的元素
+type PartialDecoder[T any] struct {
+	parser *PartialJSONParser
+	result T
+}
+
+func NewPartialDecoder[T any]() *PartialDecoder[T] {
+	return &PartialDecoder[T]{parser: NewPartialJSONParser()}
+}
+
+// Feed 追加片段并返回当前的结果, 与T类型不符的字段保持零值
+// T为切片时返回值与之前的结果共用底层数组, 之前结果中最后一个未完成的元素会随之更新
+func (self *PartialDecoder[T]) Feed(delta string) (T, error) {
+	var zero T
+	value, err := self.parser.Feed(delta)
+	if err != nil || value == nil {
+		return zero, err
+	}
+
+	target := reflect.ValueOf(&self.result).Elem()
+	switch root := value.(type) {
+	case map[string]interface{}:
+		if kind := target.Kind(); kind != reflect.Struct && kind != reflect.Map {
+			break
+		}
+		fields, nulls := make(map[string]interface{}), make(map[string]interface{})
+		for key := range self.parser.changed {
+			if field, ok := root[key]; ok {
+				fields[key], nulls[key] = field, nil
+			}
+		}
+
+		// 在副本上解码, 不影响之前返回的结果
+		result := reflect.New(target.Type()).Elem()
+		if target.Kind() == reflect.Map {
+			result.Set(reflect.MakeMapWithSize(target.Type(), target.Len()+len(fields)))
+			for iter := target.MapRange(); iter.Next(); {
+				result.SetMapIndex(iter.Key(), iter.Value())
+			}
+		} else {
+			result.Set(target)
+			// 先置为null, 切片、map与指针会重新分配而不是复用之前的
+			if err = decodePartial(nulls, result.Addr().Interface()); err != nil {
+				return zero, err
+			}
+		}
+		if err = decodePartial(fields, result.Addr().Interface()); err != nil {
+			return zero, err
+		}
+		target.Set(result)
+
+		return self.result, nil
+	case []interface{}:
+		if target.Kind() != reflect.Slice {
+			break
+		}
+		from := len(root)
+		if self.parser.changedFrom >= 0 {
+			from = min(self.parser.changedFrom, target.Len())
+		}
+		items := reflect.New(target.Type())
+		if err = decodePartial(root[from:], items.Interface()); err != nil {
+			return zero, err
+		}
+		target.Set(reflect.AppendSlice(target.Slice(0, min(from, target.Len())), items.Elem()))
+
+		return self.result, nil
+	}
+
+	// 其他类型每次完整解码
+	var result T
+	if err = decodePartial(value, &result); err != nil {
+		return zero, err
+	}
+	self.result = result
+
+	return result, nil
+}
+
+func (self *PartialDecoder[T]) Complete() bool {
+	return self.parser.Complete()
+}
+
+func decodePartial(value interface{}, target interface{}) error {
+	marshal, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var typeErr *json.UnmarshalTypeError
+	if err = json.Unmarshal(marshal, target); err != nil && !errors.As(err, &typeErr) {
+		return err
+	}
+
+	return nil
+}
+
+// PartialResult StreamJSON输出的中间结果
+type PartialResult[T any] struct {
+	Value    T
+	Complete bool  // JSON已完整结束
+	Err      error // 解析失败时为最后一个结果
+}
+
+// StreamJSON 消费StreamChat的结果, 每收到一个片段输出一次当前解析到的T
+func StreamJSON[T any](ctx context.Context, stream <-chan *easyai.ChatResponse) <-chan *PartialResult[T] {
+	resultChan := make(chan *PartialResult[T])
+	go func() {
+		defer drain(stream)
+		defer close(resultChan)
+
+		decoder := NewPartialDecoder[T]()
+		for {
+			var resp *easyai.ChatResponse
+			var ok bool
+			select {
+			case resp, ok = <-stream:
+			case <-ctx.Done():
+				return
+			}
+			if !ok {
+				return
+			}
+
+			value, err := decoder.Feed(resp.Content)
+			if err == nil && !decoder.parser.started {
+				continue
+			}
+
+			select {
+			case resultChan <- &PartialResult[T]{Value: value, Complete: decoder.Complete(), Err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return resultChan
+}
@@ -0,0 +1,330 @@
+package prompt
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// 模板文件的扩展名, 以_开头的文件为公共片段, 如_tone.tmpl可在其他模板中以{{template "tone" .}}引用
+const templateExt = ".tmpl"
+
+// 模板正文中的分段, 没有分段时全部内容作为用户输入
+var sectionPattern = regexp.MustCompile(`^\[(system|user|example\.user|example\.assistant)\]\s*$`)
+
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// Registry 按名称与版本管理提示词模板, 全部模板与公共片段共享同一个模板集合
+type Registry struct {
+	mu        sync.RWMutex
+	base      *template.Template
+	templates map[string][]*Template // 按版本从低到高排列
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		base:      template.New("").Option("missingkey=error").Funcs(templateFuncs),
+		templates: make(map[string][]*Template),
+	}
+}
+
+// LoadFS 加载fsys中root目录下全部的.tmpl文件, 可直接使用embed.FS
+func LoadFS(fsys fs.FS, root string) (*Registry, error) {
+	registry := NewRegistry()
+	if err := registry.Load(fsys, root); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// LoadDir 加载目录下全部的.tmpl文件
+func LoadDir(dir string) (*Registry, error) {
+	return LoadFS(os.DirFS(dir), ".")
+}
+
+// Load 加载fsys中root目录下全部的.tmpl文件, 包括子目录
+func (self *Registry) Load(fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || path.Ext(name) != templateExt {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if err = self.Parse(path.Base(name), string(content)); err != nil {
+			return fmt.Errorf("加载提示词模板%s失败, 原因: %w", name, err)
+		}
+
+		return nil
+	})
+}
+
+// Parse 解析一个模板文件, 文件开头---之间为名称、版本与变量的声明, 名称默认为文件名
+//
+//	---
+//	name: translate
+//	version: v2
+//	vars:
+//	  text: string, required
+//	  target: string, default=英文
+//	---
+//	[system]
+//	你是专业的翻译, 将用户输入翻译为{{.target}}
+//	[example.user]
+//	你好
+//	[example.assistant]
+//	Hello
+//	[user]
+//	{{.text}}
+func (self *Registry) Parse(filename, content string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	name := strings.TrimSuffix(filename, path.Ext(filename))
+	header, body := splitFrontMatter(content)
+	if partial, found := strings.CutPrefix(name, "_"); found {
+		_, err := self.base.New(partial).Parse(body)
+		return err
+	}
+
+	tmpl := &Template{Name: name, lock: &self.mu}
+	if err := tmpl.parseHeader(header); err != nil {
+		return err
+	}
+	for _, existing := range self.templates[tmpl.Name] {
+		if existing.Version == tmpl.Version {
+			return fmt.Errorf("提示词模板%s@%s重复", tmpl.Name, tmpl.Version)
+		}
+	}
+	if err := self.parseSections(tmpl, body); err != nil {
+		return err
+	}
+
+	versions := append(self.templates[tmpl.Name], tmpl)
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareVersion(versions[i].Version, versions[j].Version) < 0
+	})
+	self.templates[tmpl.Name] = versions
+
+	return nil
+}
+
+// Get 获取指定版本的模板, version为空或latest时返回最新的版本
+func (self *Registry) Get(name, version string) (*Template, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	versions := self.templates[name]
+	if len(versions) > 0 && (version == "" || version == "latest") {
+		return versions[len(versions)-1], nil
+	}
+	for _, tmpl := range versions {
+		if tmpl.Version == version {
+			return tmpl, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s@%s", ErrNotFound, name, version)
+}
+
+// Versions 模板的全部版本, 从低到高排列
+func (self *Registry) Versions(name string) []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	var versions []string
+	for _, tmpl := range self.templates[name] {
+		versions = append(versions, tmpl.Version)
+	}
+
+	return versions
+}
+
+// Render 渲染指定版本的模板
+func (self *Registry) Render(name, version string, vars map[string]interface{}) (*Rendered, error) {
+	tmpl, err := self.Get(name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return tmpl.Render(vars)
+}
+
+func (self *Registry) parseSections(tmpl *Template, body string) error {
+	current := "user"
+	sections := map[string]*strings.Builder{current: new(strings.Builder)}
+	var order []string
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if match := sectionPattern.FindStringSubmatch(strings.TrimRight(line, "\r\n")); match != nil {
+			current = fmt.Sprintf("%s#%d", match[1], len(order))
+			order = append(order, current)
+			sections[current] = new(strings.Builder)
+			continue
+		}
+		sections[current].WriteString(line)
+	}
+	// 有分段时, 第一个分段之前只能是空白
+	if len(order) > 0 && strings.TrimSpace(sections["user"].String()) != "" {
+		return fmt.Errorf("提示词模板%s的内容需位于分段之中", tmpl.Name)
+	}
+	if len(order) == 0 {
+		order = []string{"user"}
+	}
+
+	var input *template.Template
+	for _, key := range order {
+		section, _, _ := strings.Cut(key, "#")
+		parsed, err := self.base.New(fmt.Sprintf("%s@%s/%s", tmpl.Name, tmpl.Version, key)).Parse(sections[key].String())
+		if err != nil {
+			return err
+		}
+
+		switch section {
+		case "system":
+			tmpl.system = parsed
+		case "user":
+			tmpl.user = parsed
+		case "example.user":
+			if input != nil {
+				return fmt.Errorf("提示词模板%s的示例需要一问一答成对出现", tmpl.Name)
+			}
+			input = parsed
+		case "example.assistant":
+			if input == nil {
+				return fmt.Errorf("提示词模板%s的示例需要一问一答成对出现", tmpl.Name)
+			}
+			tmpl.examples = append(tmpl.examples, [2]*template.Template{input, parsed})
+			input = nil
+		}
+	}
+	if input != nil {
+		return fmt.Errorf("提示词模板%s的示例需要一问一答成对出现", tmpl.Name)
+	}
+
+	return nil
+}
+
+// parseHeader 解析name、version、description与vars, vars下每行声明一个变量
+func (self *Template) parseHeader(header string) error {
+	inVars := false
+	for _, line := range strings.Split(header, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return fmt.Errorf("无法解析%q", line)
+		}
+		value = strings.TrimSpace(value)
+
+		if inVars && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			variable, err := parseVariable(strings.TrimSpace(key), value)
+			if err != nil {
+				return err
+			}
+			self.Vars = append(self.Vars, variable)
+			continue
+		}
+
+		inVars = false
+		switch strings.TrimSpace(key) {
+		case "name":
+			self.Name = value
+		case "version":
+			self.Version = value
+		case "description":
+			self.Description = value
+		case "vars":
+			inVars = true
+		default:
+			return fmt.Errorf("未知的字段%q", strings.TrimSpace(key))
+		}
+	}
+
+	return nil
+}
+
+// parseVariable 解析如 string, required, default=英文 的声明, default之后的内容全部作为默认值
+func parseVariable(name, spec string) (*Variable, error) {
+	spec, value, hasDefault := strings.Cut(spec, "default=")
+	parts := strings.Split(strings.TrimRight(strings.TrimSpace(spec), ","), ",")
+	variable := &Variable{Name: name, Type: VarType(strings.TrimSpace(parts[0])), Default: strings.TrimSpace(value)}
+	switch variable.Type {
+	case TypeString, TypeInt, TypeFloat, TypeBool, TypeList, TypeAny:
+	case "":
+		variable.Type = TypeString
+	default:
+		return nil, fmt.Errorf("变量%s的类型%q不支持", name, variable.Type)
+	}
+
+	for _, part := range parts[1:] {
+		if part = strings.TrimSpace(part); part != "required" {
+			return nil, fmt.Errorf("变量%s的声明%q无法解析", name, part)
+		}
+		variable.Required = true
+	}
+	if _, err := convert(variable.Type, variable.Default); hasDefault && err != nil {
+		return nil, fmt.Errorf("变量%s的默认值%q不是%s", name, variable.Default, variable.Type)
+	}
+
+	return variable, nil
+}
+
+func splitFrontMatter(content string) (header, body string) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	rest, found := strings.CutPrefix(content, "---\n")
+	if !found {
+		if rest, found = strings.CutPrefix(content, "---\r\n"); !found {
+			return "", content
+		}
+	}
+	for offset := 0; offset < len(rest); {
+		line, _, _ := strings.Cut(rest[offset:], "\n")
+		if strings.TrimRight(line, "\r") == "---" {
+			return rest[:offset], rest[min(offset+len(line)+1, len(rest)):]
+		}
+		offset += len(line) + 1
+	}
+
+	return "", content
+}
+
+// compareVersion 比较版本, 忽略开头的v, 按.与-分隔后逐段比较, 数字按大小比较
+func compareVersion(a, b string) int {
+	split := func(version string) []string {
+		version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+		return strings.FieldsFunc(version, func(r rune) bool { return r == '.' || r == '-' })
+	}
+
+	left, right := split(a), split(b)
+	for i := 0; i < len(left) && i < len(right); i++ {
+		x, errX := strconv.Atoi(left[i])
+		y, errY := strconv.Atoi(right[i])
+		switch {
+		case errX == nil && errY == nil && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		case (errX != nil || errY != nil) && left[i] != right[i]:
+			return strings.Compare(left[i], right[i])
+		}
+	}
+
+	return len(left) - len(right)
+}
@@ -0,0 +1,220 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var (
+	ErrNotFound        = errors.New("提示词模板不存在")
+	ErrMissingVariable = errors.New("缺少必填的变量")
+	ErrInvalidVariable = errors.New("变量的类型不正确")
+)
+
+// VarType 模板变量的类型, 渲染时字符串会按类型转换, 如"3"可作为int
+type VarType string
+
+const (
+	TypeString VarType = "string"
+	TypeInt    VarType = "int"
+	TypeFloat  VarType = "float"
+	TypeBool   VarType = "bool"
+	TypeList   VarType = "list" // 字符串列表, 可配合join使用
+	TypeAny    VarType = "any"
+)
+
+// Variable 模板中声明的变量, 如 text: string, required 与 target: string, default=英文
+type Variable struct {
+	Name     string
+	Type     VarType
+	Required bool
+	Default  string // 未传入时使用的值, 按Type转换
+}
+
+// Example 少样本示例, 一问一答
+type Example struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// Template 一个版本的提示词模板, 由系统提示词、用户输入与少样本示例组成
+type Template struct {
+	Name        string
+	Version     string
+	Description string
+	Vars        []*Variable
+
+	system   *template.Template
+	user     *template.Template
+	examples [][2]*template.Template
+	lock     *sync.RWMutex // 所属Registry的锁, 避免渲染时同时加载新的模板
+}
+
+// Rendered 渲染后的提示词
+type Rendered struct {
+	Name     string
+	Version  string
+	System   string
+	Message  string
+	Examples []Example
+}
+
+// Render 校验并转换变量后渲染, 模板中引用了未传入且没有声明的变量时同样返回错误
+func (self *Template) Render(vars map[string]interface{}) (*Rendered, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	data, err := self.values(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := &Rendered{Name: self.Name, Version: self.Version}
+	if rendered.System, err = execute(self.system, data); err != nil {
+		return nil, err
+	}
+	if rendered.Message, err = execute(self.user, data); err != nil {
+		return nil, err
+	}
+	for _, pair := range self.examples {
+		var example Example
+		if example.Input, err = execute(pair[0], data); err != nil {
+			return nil, err
+		}
+		if example.Output, err = execute(pair[1], data); err != nil {
+			return nil, err
+		}
+		rendered.Examples = append(rendered.Examples, example)
+	}
+
+	return rendered, nil
+}
+
+// Request 组装为请求, 系统提示词作为Tips, 少样本示例作为Examples
+func (self *Rendered) Request() *easyai.ChatRequest {
+	request := &easyai.ChatRequest{Message: self.Message}
+	if self.System != "" {
+		request.Tips = &easyai.ChatMessage{Role: easyai.IdSystem, Content: self.System}
+	}
+	for _, example := range self.Examples {
+		request.Examples = append(request.Examples, &easyai.ChatExample{Input: example.Input, Output: example.Output})
+	}
+
+	return request
+}
+
+// values 补充默认值并按声明的类型转换
+func (self *Template) values(vars map[string]interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(vars)+len(self.Vars))
+	for key, value := range vars {
+		data[key] = value
+	}
+
+	var missing []string
+	for _, variable := range self.Vars {
+		value, ok := data[variable.Name]
+		if !ok || value == nil {
+			if variable.Required {
+				missing = append(missing, variable.Name)
+				continue
+			}
+			value = variable.Default
+		}
+
+		converted, err := convert(variable.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s需为%s, 原因: %v", ErrInvalidVariable, variable.Name, variable.Type, err)
+		}
+		data[variable.Name] = converted
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingVariable, strings.Join(missing, ", "))
+	}
+
+	return data, nil
+}
+
+func convert(kind VarType, value interface{}) (interface{}, error) {
+	text, isText := value.(string)
+	switch kind {
+	case TypeString:
+		if !isText {
+			return fmt.Sprint(value), nil
+		}
+		return text, nil
+	case TypeInt:
+		if isText {
+			if text = strings.TrimSpace(text); text == "" {
+				return 0, nil
+			}
+			return strconv.Atoi(text)
+		}
+		switch number := reflect.ValueOf(value); number.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return int(number.Int()), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int(number.Uint()), nil
+		}
+	case TypeFloat:
+		if isText {
+			if text = strings.TrimSpace(text); text == "" {
+				return 0.0, nil
+			}
+			return strconv.ParseFloat(text, 64)
+		}
+		switch number := reflect.ValueOf(value); number.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return number.Float(), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(number.Int()), nil
+		}
+	case TypeBool:
+		if isText {
+			if text = strings.TrimSpace(text); text == "" {
+				return false, nil
+			}
+			return strconv.ParseBool(text)
+		}
+		if flag, ok := value.(bool); ok {
+			return flag, nil
+		}
+	case TypeList:
+		if isText {
+			if text == "" {
+				return []string(nil), nil
+			}
+			return strings.Split(text, ","), nil
+		}
+		list := reflect.ValueOf(value)
+		if list.Kind() == reflect.Slice || list.Kind() == reflect.Array {
+			items := make([]string, list.Len())
+			for i := range items {
+				items[i] = fmt.Sprint(list.Index(i).Interface())
+			}
+			return items, nil
+		}
+	case TypeAny, "":
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("不支持%T", value)
+}
+
+func execute(tmpl *template.Template, data map[string]interface{}) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("渲染提示词失败, 原因: %w", err)
+	}
+
+	return strings.TrimSpace(builder.String()), nil
+}
@@ -0,0 +1,162 @@
+package rag
+
+import (
+	"fmt"
+	"github.com/soryetong/go-easy-llm/utils"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultChunkSize    = 500
+	defaultChunkOverlap = 50
+)
+
+// Chunk 文档切分后的片段, 是向量化与检索的最小单位
+type Chunk struct {
+	Id         string `json:"id"`
+	DocumentId string `json:"document_id"`
+	Source     string `json:"source"`
+	Title      string `json:"title"`
+	Index      int    `json:"index"` // 在文档中的序号
+	Content    string `json:"content"`
+	Tokens     int    `json:"tokens"`
+}
+
+// Chunker 按句子切分文档, 每个片段不超过ChunkSize个token, 相邻片段重叠约Overlap个token
+type Chunker struct {
+	ChunkSize   int
+	Overlap     int
+	CountTokens func(text string) int // 为空时使用EstimateTokens
+}
+
+func NewChunker(chunkSize, overlap int) *Chunker {
+	return &Chunker{ChunkSize: chunkSize, Overlap: overlap}
+}
+
+// EstimateTokens 粗略估算token数: 中日韩文字每字1个, 其余字母数字每4个字符约1个
+func EstimateTokens(text string) int {
+	return utils.EstimateTokens(text)
+}
+
+func (self *Chunker) Split(doc *Document) []*Chunk {
+	size, overlap := self.ChunkSize, self.Overlap
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = min(defaultChunkOverlap, size/2)
+	}
+	count := self.CountTokens
+	if count == nil {
+		count = EstimateTokens
+	}
+
+	var chunks []*Chunk
+	var window []string
+	windowTokens := 0
+	emit := func() {
+		content := strings.TrimSpace(strings.Join(window, ""))
+		if content == "" {
+			return
+		}
+		chunks = append(chunks, &Chunk{
+			Id:         fmt.Sprintf("%s-%d", doc.Id, len(chunks)),
+			DocumentId: doc.Id,
+			Source:     doc.Source,
+			Title:      doc.Title,
+			Index:      len(chunks),
+			Content:    content,
+			Tokens:     count(content),
+		})
+	}
+
+	for _, sentence := range splitUnits(doc.Content, size, count) {
+		tokens := count(sentence)
+		if windowTokens+tokens > size && len(window) > 0 {
+			emit()
+
+			// 保留末尾的句子作为下一个片段的开头
+			kept, keptTokens := 0, 0
+			for i := len(window) - 1; i >= 0; i-- {
+				sentenceTokens := count(window[i])
+				if keptTokens+sentenceTokens > overlap || keptTokens+sentenceTokens+tokens > size {
+					break
+				}
+				kept++
+				keptTokens += sentenceTokens
+			}
+			window = append([]string(nil), window[len(window)-kept:]...)
+			windowTokens = keptTokens
+		}
+
+		window = append(window, sentence)
+		windowTokens += tokens
+	}
+	emit()
+
+	return chunks
+}
+
+// hardCut 返回token数达到size的最短前缀的长度, 不足size时返回全部
+// 先倍增再二分查找切分点, 避免每增加一个字就重新计算整段的token数
+func hardCut(runes []rune, size int, count func(string) int) int {
+	high := 1
+	for high < len(runes) && count(string(runes[:high])) < size {
+		high *= 2
+	}
+	if high >= len(runes) {
+		if count(string(runes)) < size {
+			return len(runes)
+		}
+		high = len(runes)
+	}
+
+	low := high / 2 // runes[:low]的token数不足size
+	for low+1 < high {
+		middle := (low + high) / 2
+		if count(string(runes[:middle])) >= size {
+			high = middle
+		} else {
+			low = middle
+		}
+	}
+
+	return high
+}
+
+// splitUnits 按句子切分, 超过size的长句再按字数硬切
+func splitUnits(content string, size int, count func(string) int) []string {
+	var units []string
+	var sentence strings.Builder
+	flush := func() {
+		if sentence.Len() == 0 {
+			return
+		}
+		text := sentence.String()
+		sentence.Reset()
+		if count(text) <= size {
+			units = append(units, text)
+			return
+		}
+
+		for runes := []rune(text); len(runes) > 0; {
+			cut := hardCut(runes, size, count)
+			units = append(units, string(runes[:cut]))
+			runes = runes[cut:]
+		}
+	}
+
+	var prev rune
+	for _, r := range content {
+		sentence.WriteRune(r)
+		// 英文句号需后跟空白才断句, 避免切开小数、网址
+		if strings.ContainsRune("。！？；!?;\n", r) || (prev == '.' && unicode.IsSpace(r)) {
+			flush()
+		}
+		prev = r
+	}
+	flush()
+
+	return units
+}
@@ -0,0 +1,149 @@
+package rag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Document 加载后的纯文本文档
+type Document struct {
+	Id       string            `json:"id"`
+	Source   string            `json:"source"` // 文件路径或URL, 用于引用溯源
+	Title    string            `json:"title"`
+	Content  string            `json:"content"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func newDocument(source, title, content string) *Document {
+	sum := sha256.Sum256([]byte(source + "\x00" + content))
+
+	return &Document{
+		Id:      hex.EncodeToString(sum[:8]),
+		Source:  source,
+		Title:   strings.TrimSpace(title),
+		Content: strings.TrimSpace(content),
+	}
+}
+
+// LoadText 加载纯文本, 标题取第一行非空内容
+func LoadText(source, content string) *Document {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	title := ""
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			title = line
+			break
+		}
+	}
+
+	return newDocument(source, truncateRunes(title, 64), content)
+}
+
+var (
+	markdownFence   = regexp.MustCompile("(?m)^[ \\t]*(```|~~~).*$")
+	markdownHeading = regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}[ \t]+(.*?)[ \t]*#*[ \t]*$`)
+	markdownImage   = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink    = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	// 单个下划线常见于标识符中, 不视为强调
+	markdownEmphasis = regexp.MustCompile(`(\*\*|__|\*|~~|` + "`" + `)([^*~` + "`" + `\n]+?)(\*\*|__|\*|~~|` + "`" + `)`)
+	markdownListMark = regexp.MustCompile(`(?m)^[ \t]*([-+*]|\d+\.)[ \t]+`)
+	markdownQuote    = regexp.MustCompile(`(?m)^[ \t]*>[ \t]?`)
+	markdownRule     = regexp.MustCompile(`(?m)^[ \t]*([-*_][ \t]*){3,}$`)
+)
+
+// LoadMarkdown 去除markdown语法并保留文字内容, 标题取第一个标题行
+func LoadMarkdown(source, content string) *Document {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	title := ""
+	if match := markdownHeading.FindStringSubmatch(content); match != nil {
+		title = match[1]
+	}
+
+	content = markdownFence.ReplaceAllString(content, "")
+	content = markdownHeading.ReplaceAllString(content, "$1")
+	content = markdownImage.ReplaceAllString(content, "$1")
+	content = markdownLink.ReplaceAllString(content, "$1")
+	content = markdownEmphasis.ReplaceAllString(content, "$2")
+	content = markdownRule.ReplaceAllString(content, "")
+	content = markdownListMark.ReplaceAllString(content, "")
+	content = markdownQuote.ReplaceAllString(content, "")
+
+	doc := newDocument(source, title, collapseBlankLines(content))
+	if doc.Title == "" {
+		doc.Title = LoadText(source, doc.Content).Title
+	}
+
+	return doc
+}
+
+var (
+	htmlInvisible = regexp.MustCompile(`(?is)<(script|style|noscript|head)[^>]*>.*?</(script|style|noscript|head)>`)
+	htmlTitle     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlComment   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlBlock     = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6]|/section|/article|/blockquote|/pre)\b[^>]*>`)
+	htmlTag       = regexp.MustCompile(`(?s)<[^>]+>`)
+	htmlSpaces    = regexp.MustCompile(`[ \t\f\v]+`)
+)
+
+// LoadHTML 提取网页中的可见文字, 块级元素结束处换行
+func LoadHTML(source, content string) *Document {
+	title := ""
+	if match := htmlTitle.FindStringSubmatch(content); match != nil {
+		title = html.UnescapeString(htmlTag.ReplaceAllString(match[1], ""))
+	}
+
+	content = htmlComment.ReplaceAllString(content, "")
+	content = htmlInvisible.ReplaceAllString(content, "")
+	content = htmlBlock.ReplaceAllString(content, "\n")
+	content = htmlTag.ReplaceAllString(content, "")
+	content = html.UnescapeString(content)
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(htmlSpaces.ReplaceAllString(line, " "))
+	}
+
+	doc := newDocument(source, title, collapseBlankLines(strings.Join(lines, "\n")))
+	if doc.Title == "" {
+		doc.Title = LoadText(source, doc.Content).Title
+	}
+
+	return doc
+}
+
+// LoadFile 按扩展名选择加载方式, 未知扩展名按纯文本处理
+func LoadFile(path string) (*Document, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败, 原因: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return LoadMarkdown(path, string(content)), nil
+	case ".html", ".htm":
+		return LoadHTML(path, string(content)), nil
+	default:
+		return LoadText(path, string(content)), nil
+	}
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+func collapseBlankLines(content string) string {
+	return blankLines.ReplaceAllString(strings.TrimSpace(content), "\n\n")
+}
+
+func truncateRunes(value string, size int) string {
+	if runes := []rune(value); len(runes) > size {
+		return string(runes[:size])
+	}
+
+	return value
+}
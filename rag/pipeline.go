@@ -0,0 +1,57 @@
+package rag
+
+import (
+	"context"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+)
+
+// Pipeline 串联切分、向量化、检索、提示词组装与引用解析
+type Pipeline struct {
+	Chunker   *Chunker
+	Store     VectorStore
+	Retriever *Retriever
+	Prompt    *PromptBuilder
+	Chat      easyllm.ChatHandler // ChatClient、FallbackClient或中间件链
+	Model     string              // 为空时使用Chat的默认模型
+}
+
+// NewPipeline 使用内存向量库及默认的切分、检索配置
+func NewPipeline(chat easyllm.ChatHandler, embedder easyai.EmbeddingClient) *Pipeline {
+	store := NewMemoryVectorStore(embedder)
+
+	return &Pipeline{
+		Chunker:   NewChunker(defaultChunkSize, defaultChunkOverlap),
+		Store:     store,
+		Retriever: NewRetriever(store),
+		Prompt:    new(PromptBuilder),
+		Chat:      chat,
+	}
+}
+
+// Index 切分文档并写入向量库
+func (self *Pipeline) Index(ctx context.Context, docs ...*Document) error {
+	var chunks []*Chunk
+	for _, doc := range docs {
+		chunks = append(chunks, self.Chunker.Split(doc)...)
+	}
+
+	return self.Store.Add(ctx, chunks...)
+}
+
+// Ask 检索相关片段后调用大模型回答, 并解析回答中的引用
+func (self *Pipeline) Ask(ctx context.Context, question string) (*Answer, error) {
+	results, err := self.Retriever.Retrieve(ctx, question)
+	if err != nil {
+		return nil, err
+	}
+
+	request := self.Prompt.Build(question, results)
+	request.Model = self.Model
+	resp, _, err := self.Chat.NormalChat(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return ResolveCitations(resp.Content, results), nil
+}
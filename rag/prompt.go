@@ -0,0 +1,83 @@
+package rag
+
+import (
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultRAGInstruction = "请仅根据给出的参考资料回答问题, 引用资料时在句末标注对应的编号, 例如[1]、[2]。" +
+	"如果参考资料中没有相关内容, 请直接说明无法回答, 不要编造。"
+
+// PromptBuilder 将检索到的片段以带编号的参考资料注入到请求中, 编号从1开始与results的顺序一致
+type PromptBuilder struct {
+	Instruction string // 作为Tips发送的系统提示, 为空时使用默认提示
+}
+
+func (self *PromptBuilder) Build(question string, results []*SearchResult) *easyai.ChatRequest {
+	instruction := self.Instruction
+	if instruction == "" {
+		instruction = defaultRAGInstruction
+	}
+
+	var builder strings.Builder
+	builder.WriteString("参考资料:\n")
+	for i, result := range results {
+		_, _ = fmt.Fprintf(&builder, "[%d] ", i+1)
+		if result.Chunk.Title != "" {
+			_, _ = fmt.Fprintf(&builder, "《%s》", result.Chunk.Title)
+		}
+		builder.WriteString(result.Chunk.Content)
+		builder.WriteString("\n\n")
+	}
+	builder.WriteString("问题: ")
+	builder.WriteString(question)
+
+	return &easyai.ChatRequest{
+		Message: builder.String(),
+		Tips:    &easyai.ChatMessage{Role: easyai.IdSystem, Content: instruction},
+	}
+}
+
+// Citation 回答中引用的参考资料
+type Citation struct {
+	Marker int    `json:"marker"` // 回答中的编号
+	Chunk  *Chunk `json:"chunk"`
+}
+
+// Answer 带引用来源的回答
+type Answer struct {
+	Content   string          `json:"content"`
+	Citations []*Citation     `json:"citations"` // 按编号排列, 不存在的编号会被忽略
+	Sources   []*SearchResult `json:"sources"`   // 提供给大模型的全部参考资料
+}
+
+// 兼容 [1]、[1,2]、[1, 2]、【1】 的写法
+var (
+	citationMarker = regexp.MustCompile(`[\[【]\s*(\d+(?:\s*[,，、]\s*\d+)*)\s*[\]】]`)
+	citationNumber = regexp.MustCompile(`\d+`)
+)
+
+// ResolveCitations 将回答中的引用编号映射回对应的片段
+func ResolveCitations(content string, results []*SearchResult) *Answer {
+	answer := &Answer{Content: content, Sources: results}
+	seen := make(map[int]bool)
+	for _, match := range citationMarker.FindAllStringSubmatch(content, -1) {
+		for _, field := range citationNumber.FindAllString(match[1], -1) {
+			marker, _ := strconv.Atoi(field)
+			if marker < 1 || marker > len(results) || seen[marker] {
+				continue
+			}
+			seen[marker] = true
+			answer.Citations = append(answer.Citations, &Citation{Marker: marker, Chunk: results[marker-1].Chunk})
+		}
+	}
+	sort.Slice(answer.Citations, func(i, j int) bool {
+		return answer.Citations[i].Marker < answer.Citations[j].Marker
+	})
+
+	return answer
+}
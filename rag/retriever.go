@@ -0,0 +1,71 @@
+package rag
+
+import (
+	"context"
+	"github.com/soryetong/go-easy-llm/easyai"
+)
+
+const defaultRetrieveTopK = 4
+
+// VectorStore 片段的存储与检索
+type VectorStore interface {
+	Add(ctx context.Context, chunks ...*Chunk) error
+	Search(ctx context.Context, query string, topK int) ([]*SearchResult, error)
+}
+
+// Retriever 从向量库中召回片段, 配置Reranker时先多召回一些再重排序
+type Retriever struct {
+	Store    VectorStore
+	TopK     int     // 默认4
+	MinScore float64 // 低于该分数的片段会被丢弃
+	Reranker easyai.RerankClient
+}
+
+func NewRetriever(store VectorStore) *Retriever {
+	return &Retriever{Store: store, TopK: defaultRetrieveTopK}
+}
+
+func (self *Retriever) Retrieve(ctx context.Context, query string) ([]*SearchResult, error) {
+	topK := self.TopK
+	if topK <= 0 {
+		topK = defaultRetrieveTopK
+	}
+
+	recall := topK
+	if self.Reranker != nil {
+		recall = topK * 3
+	}
+	results, err := self.Store.Search(ctx, query, recall)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.Reranker != nil && len(results) > 0 {
+		documents := make([]string, len(results))
+		for i, result := range results {
+			documents[i] = result.Chunk.Content
+		}
+		resp, err := self.Reranker.Rerank(ctx, query, documents, topK)
+		if err != nil {
+			return nil, err
+		}
+
+		reranked := make([]*SearchResult, 0, len(resp.Results))
+		for _, result := range resp.Results {
+			reranked = append(reranked, &SearchResult{Chunk: results[result.Index].Chunk, Score: result.Score})
+		}
+		results = reranked
+	}
+
+	filtered := results[:0]
+	for _, result := range results {
+		if result.Score >= self.MinScore {
+			filtered = append(filtered, result)
+		}
+	}
+	if len(filtered) > topK {
+		filtered = filtered[:topK]
+	}
+
+	return filtered, nil
+}
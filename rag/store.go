@@ -0,0 +1,160 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"github.com/soryetong/go-easy-llm/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// SearchResult 检索到的片段及其与问题的相似度
+type SearchResult struct {
+	Chunk *Chunk  `json:"chunk"`
+	Score float64 `json:"score"`
+}
+
+// MemoryVectorStore 基于向量余弦相似度的内存检索, 可保存为JSON文件
+type MemoryVectorStore struct {
+	Embedder easyai.EmbeddingClient
+
+	mu    sync.RWMutex
+	items []*vectorItem
+	ids   map[string]int
+}
+
+type vectorItem struct {
+	Chunk  *Chunk    `json:"chunk"`
+	Vector []float64 `json:"vector"`
+}
+
+func NewMemoryVectorStore(embedder easyai.EmbeddingClient) *MemoryVectorStore {
+	return &MemoryVectorStore{Embedder: embedder, ids: make(map[string]int)}
+}
+
+// Add 向量化并写入片段, Id相同的片段会被覆盖
+func (self *MemoryVectorStore) Add(ctx context.Context, chunks ...*Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Content
+	}
+	resp, err := self.Embedder.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if len(resp.Embeddings) != len(chunks) {
+		return errors.New("向量数量与片段数量不一致")
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for i, chunk := range chunks {
+		self.put(&vectorItem{Chunk: chunk, Vector: resp.Embeddings[i]})
+	}
+
+	return nil
+}
+
+func (self *MemoryVectorStore) put(item *vectorItem) {
+	if index, ok := self.ids[item.Chunk.Id]; ok {
+		self.items[index] = item
+		return
+	}
+
+	self.ids[item.Chunk.Id] = len(self.items)
+	self.items = append(self.items, item)
+}
+
+// Search 返回与query最相近的topK个片段
+func (self *MemoryVectorStore) Search(ctx context.Context, query string, topK int) ([]*SearchResult, error) {
+	resp, err := self.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) == 0 {
+		return nil, errors.New("向量化结果为空")
+	}
+
+	self.mu.RLock()
+	results := make([]*SearchResult, len(self.items))
+	for i, item := range self.items {
+		results[i] = &SearchResult{Chunk: item.Chunk, Score: utils.CosineSimilarity(resp.Embeddings[0], item.Vector)}
+	}
+	self.mu.RUnlock()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if topK > 0 && topK < len(results) {
+		results = results[:topK]
+	}
+
+	return results, nil
+}
+
+func (self *MemoryVectorStore) Len() int {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	return len(self.items)
+}
+
+// Save 保存为JSON文件, 先写临时文件再重命名
+func (self *MemoryVectorStore) Save(path string) error {
+	self.mu.RLock()
+	content, err := json.Marshal(self.items)
+	self.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load 从Save保存的文件中加载, 与已有的片段合并
+func (self *MemoryVectorStore) Load(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var items []*vectorItem
+	if err = json.Unmarshal(content, &items); err != nil {
+		return err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for _, item := range items {
+		if item.Chunk != nil {
+			self.put(item)
+		}
+	}
+
+	return nil
+}
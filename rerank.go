@@ -0,0 +1,16 @@
+package easyllm
+
+import (
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+)
+
+// NewRerankClient 根据配置创建重排序客户端, 目前仅支持通义(DashScope)
+// 其他服务商可使用 &easyai.EmbeddingReranker{Embedder: embedder}, embedder由NewEmbeddingClient创建
+func NewRerankClient(config *easyai.ClientConfig) (easyai.RerankClient, error) {
+	if config.Types == easyai.ChatTypeQWen {
+		return &easyai.QWenRerank{Config: config}, nil
+	}
+
+	return nil, fmt.Errorf("%w: 获取RerankClient异常, 暂不支持的LLM配置 { %s }", easyai.ErrInvalidRequest, config.Types)
+}
@@ -0,0 +1,221 @@
+package easyllm
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSONSchema 由Go类型推导出的JSON Schema, 仅包含校验大模型输出所需的子集
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Nullable             bool                   `json:"nullable,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textUnmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// SchemaOf 根据T推导JSON Schema
+// 字段名取json标签, 带omitempty或为指针的字段为非必填, desc标签为字段说明, enum标签为以|分隔的可选值
+func SchemaOf[T any]() *JSONSchema {
+	return schemaFor(reflect.TypeOf((*T)(nil)).Elem(), make(map[reflect.Type]bool))
+}
+
+func schemaFor(typ reflect.Type, visiting map[reflect.Type]bool) *JSONSchema {
+	if typ.Kind() == reflect.Pointer {
+		schema := schemaFor(typ.Elem(), visiting)
+		schema.Nullable = true
+
+		return schema
+	}
+
+	switch {
+	case typ == timeType:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case reflect.PointerTo(typ).Implements(textUnmarshalType):
+		return &JSONSchema{Type: "string"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string", Format: "byte"}
+		}
+		return &JSONSchema{Type: "array", Items: schemaFor(typ.Elem(), visiting)}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaFor(typ.Elem(), visiting)}
+	case reflect.Struct:
+		// 递归类型只展开一层
+		if visiting[typ] {
+			return &JSONSchema{Type: "object"}
+		}
+		visiting[typ] = true
+		defer delete(visiting, typ)
+
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		addStructFields(schema, typ, visiting)
+		sort.Strings(schema.Required)
+
+		return schema
+	}
+
+	// interface{}等任意类型
+	return &JSONSchema{}
+}
+
+func addStructFields(schema *JSONSchema, typ reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			// 匿名嵌入的结构体字段展开到外层
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addStructFields(schema, fieldType, visiting)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaFor(fieldType, visiting)
+		property.Description = field.Tag.Get("desc")
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property.Enum = strings.Split(enum, "|")
+		}
+		schema.Properties[name] = property
+		if !strings.Contains(options, "omitempty") && fieldType.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// Validate 校验json.Unmarshal得到的值, 返回全部不符合的位置
+func (self *JSONSchema) Validate(value interface{}) error {
+	var problems []string
+	self.validate("$", value, &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func (self *JSONSchema) validate(path string, value interface{}, problems *[]string) {
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if value == nil {
+		if self.Type != "" && !self.Nullable {
+			report("不能为null")
+		}
+		return
+	}
+
+	switch self.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			report("应为object")
+			return
+		}
+		for _, name := range self.Required {
+			if _, ok := object[name]; !ok {
+				report("缺少必填字段%s", name)
+			}
+		}
+		for name, item := range object {
+			if property, ok := self.Properties[name]; ok {
+				property.validate(path+"."+name, item, problems)
+			} else if self.AdditionalProperties != nil {
+				self.AdditionalProperties.validate(path+"."+name, item, problems)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			report("应为array")
+			return
+		}
+		for i, item := range array {
+			self.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			report("应为string")
+			return
+		}
+		if self.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				report("应为RFC3339格式的时间")
+			}
+		}
+		if len(self.Enum) > 0 && !containsString(self.Enum, text) {
+			report("取值应为%s之一", strings.Join(self.Enum, "、"))
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			report("应为integer")
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			report("应为number")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report("应为boolean")
+		}
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *JSONSchema) String() string {
+	marshal, _ := json.Marshal(self)
+
+	return string(marshal)
+}
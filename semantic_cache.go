@@ -0,0 +1,201 @@
+package easyllm
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"github.com/soryetong/go-easy-llm/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSemanticThreshold = 0.92
+	defaultSemanticCapacity  = 1000
+)
+
+// SemanticCache 语义缓存, 对用户输入向量化后按余弦相似度查找相近问题的回答
+// 每个客户端、模型(及提示词)使用独立的命名空间, 带上下文历史的请求不参与缓存
+type SemanticCache struct {
+	Embedder  easyai.EmbeddingClient
+	Threshold float64       // 相似度达到该值才算命中
+	Capacity  int           // 每个命名空间最多缓存的条数, 超出后淘汰最久未使用的
+	TTL       time.Duration // 零值表示不过期
+
+	mu         sync.Mutex
+	namespaces map[string]*list.List
+}
+
+type semanticItem struct {
+	vector []float64
+	entry  *CacheEntry
+}
+
+func NewSemanticCache(embedder easyai.EmbeddingClient) *SemanticCache {
+	return &SemanticCache{
+		Embedder:   embedder,
+		Threshold:  defaultSemanticThreshold,
+		Capacity:   defaultSemanticCapacity,
+		namespaces: make(map[string]*list.List),
+	}
+}
+
+// Lookup 查找最相近的缓存, 未命中时返回nil, 同时返回问题的向量供Store复用
+func (self *SemanticCache) Lookup(ctx context.Context, request *easyai.ChatRequest) (*CacheEntry, []float64, error) {
+	if !self.cacheable(request) {
+		return nil, nil, nil
+	}
+
+	vector, err := self.embed(ctx, request.Message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	items := self.namespaces[self.namespace(ctx, request)]
+	if items == nil {
+		return nil, vector, nil
+	}
+
+	var best *list.Element
+	bestScore := self.Threshold
+	for element := items.Front(); element != nil; {
+		next := element.Next()
+		item := element.Value.(*semanticItem)
+		if item.entry.expired() {
+			items.Remove(element)
+		} else if score := utils.CosineSimilarity(vector, item.vector); score >= bestScore {
+			best, bestScore = element, score
+		}
+		element = next
+	}
+	if best == nil {
+		return nil, vector, nil
+	}
+	items.MoveToFront(best)
+
+	return best.Value.(*semanticItem).entry, vector, nil
+}
+
+// Store 写入缓存, vector为空时重新向量化
+func (self *SemanticCache) Store(ctx context.Context, request *easyai.ChatRequest, vector []float64, entry *CacheEntry) error {
+	if !self.cacheable(request) {
+		return nil
+	}
+
+	if len(vector) == 0 {
+		var err error
+		if vector, err = self.embed(ctx, request.Message); err != nil {
+			return err
+		}
+	}
+	if self.TTL > 0 && entry.ExpireAt.IsZero() {
+		entry.ExpireAt = time.Now().Add(self.TTL)
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	namespace := self.namespace(ctx, request)
+	items := self.namespaces[namespace]
+	if items == nil {
+		items = list.New()
+		self.namespaces[namespace] = items
+	}
+
+	items.PushFront(&semanticItem{vector: vector, entry: entry})
+	for self.Capacity > 0 && items.Len() > self.Capacity {
+		items.Remove(items.Back())
+	}
+
+	return nil
+}
+
+// Len 返回命名空间下的缓存条数
+func (self *SemanticCache) Len(ctx context.Context, request *easyai.ChatRequest) int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if items := self.namespaces[self.namespace(ctx, request)]; items != nil {
+		return items.Len()
+	}
+
+	return 0
+}
+
+func (self *SemanticCache) cacheable(request *easyai.ChatRequest) bool {
+	return request != nil && len(request.History) == 0 && strings.TrimSpace(request.Message) != ""
+}
+
+// namespace 发起调用的客户端(服务商、全局参数)、模型、JSON模式与提示词相同的请求才共用缓存
+func (self *SemanticCache) namespace(ctx context.Context, request *easyai.ChatRequest) string {
+	scope, _ := ctx.Value(cacheScopeKey{}).(string)
+	namespace := fmt.Sprintf("%s\x00%s\x00%t", scope, request.Model, request.JSONMode)
+	if request.Tips != nil {
+		namespace += "\x00" + request.Tips.Content
+	}
+	// 示例不同时回答也可能不同
+	if len(request.Examples) > 0 {
+		examples, _ := json.Marshal(request.Examples)
+		namespace += fmt.Sprintf("\x00%s\x00%d\x00%d", examples, request.ExampleMode, request.ExampleTokens)
+	}
+
+	return namespace
+}
+
+func (self *SemanticCache) embed(ctx context.Context, text string) ([]float64, error) {
+	resp, err := self.Embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) == 0 {
+		return nil, errors.New("向量化结果为空")
+	}
+
+	return resp.Embeddings[0], nil
+}
+
+// SemanticCacheMiddleware 语义缓存中间件, 向量化失败时直接调用大模型
+func SemanticCacheMiddleware(cache *SemanticCache) Middleware {
+	return func(next ChatHandler) ChatHandler {
+		normal := func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+			entry, vector, err := cache.Lookup(ctx, request)
+			if err == nil && entry != nil {
+				resp := *entry.Response
+
+				return &resp, entry.Reply, nil
+			}
+
+			resp, reply, err := next.NormalChat(ctx, request)
+			if err == nil && resp != nil {
+				clone := *resp
+				_ = cache.Store(ctx, request, vector, &CacheEntry{Response: &clone, Reply: reply})
+			}
+
+			return resp, reply, err
+		}
+		stream := func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+			entry, vector, err := cache.Lookup(ctx, request)
+			if err == nil && entry != nil {
+				return replayEntry(ctx, entry), nil
+			}
+
+			messageChan, err := next.StreamChat(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			return recordStream(ctx, messageChan, func(resp *easyai.ChatResponse, chunks []string) {
+				_ = cache.Store(context.WithoutCancel(ctx), request, vector, &CacheEntry{Response: resp, Chunks: chunks})
+			}), nil
+		}
+
+		return HandlerFuncs(normal, stream)
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CodeBlock 回复中```或~~~包围的代码块
+type CodeBlock struct {
+	Language string // 开始标记后的语言, 如go
+	Info     string // 开始标记后的完整信息, 如go title=main.go
+	Filename string // 从信息或首行注释中识别出的文件名, 没有时为空
+	Content  string // 代码内容, 不包括结尾的换行
+	Line     int    // 开始标记所在的行, 从1开始
+	Start    int    // 开始标记在原文中的字节位置
+	End      int    // 结束标记之后的字节位置, 未闭合时为原文的长度
+	Closed   bool   // 为false时代码块未闭合, 如回复被截断
+}
+
+// ExtractCodeBlocks 提取全部代码块, 未闭合的代码块同样返回
+func ExtractCodeBlocks(value string) []CodeBlock {
+	extractor := new(CodeBlockExtractor)
+
+	return append(extractor.Do(value), extractor.Flush()...)
+}
+
+// CodeBlockExtractor 逐段提取代码块, 收到结束标记所在的整行后立即返回该代码块
+type CodeBlockExtractor struct {
+	pending string // 尚未结束的行
+	offset  int    // pending在原文中的位置
+	line    int
+	block   *CodeBlock
+	fence   string
+	lines   []string
+}
+
+// Do 输入一段内容, 返回其中已结束的代码块
+func (self *CodeBlockExtractor) Do(value string) []CodeBlock {
+	self.pending += value
+
+	var blocks []CodeBlock
+	for {
+		end := strings.IndexByte(self.pending, '\n')
+		if end < 0 {
+			return blocks
+		}
+		if block, ok := self.readLine(self.pending[:end]); ok {
+			blocks = append(blocks, block)
+		}
+		self.pending = self.pending[end+1:]
+		self.offset += end + 1
+	}
+}
+
+// Flush 处理最后一行并重置状态, 返回剩余的代码块, 包括未闭合的
+func (self *CodeBlockExtractor) Flush() []CodeBlock {
+	var blocks []CodeBlock
+	if self.pending != "" {
+		if block, ok := self.readLine(self.pending); ok {
+			blocks = append(blocks, block)
+		}
+	}
+	if self.block != nil {
+		self.block.End = self.offset + len(self.pending)
+		blocks = append(blocks, self.finish(false))
+	}
+	*self = CodeBlockExtractor{}
+
+	return blocks
+}
+
+func (self *CodeBlockExtractor) readLine(line string) (CodeBlock, bool) {
+	self.line++
+	line = strings.TrimSuffix(line, "\r")
+	rest := strings.TrimLeft(line, " \t")
+
+	if self.block == nil {
+		if isFence(rest) {
+			self.fence = rest[:len(rest)-len(strings.TrimLeft(rest, rest[:1]))]
+			info := strings.TrimSpace(rest[len(self.fence):])
+			language, _, _ := strings.Cut(info, " ")
+			self.block = &CodeBlock{Language: language, Info: info, Line: self.line, Start: self.offset}
+		}
+		return CodeBlock{}, false
+	}
+
+	// 结束标记与开始标记的字符相同且不短于开始标记, 其后不能有其他内容
+	if trimmed := strings.TrimSpace(rest); len(trimmed) >= len(self.fence) && strings.Trim(trimmed, self.fence[:1]) == "" {
+		self.block.End = self.offset + len(line)
+		return self.finish(true), true
+	}
+	self.lines = append(self.lines, line)
+
+	return CodeBlock{}, false
+}
+
+func (self *CodeBlockExtractor) finish(closed bool) CodeBlock {
+	block := *self.block
+	block.Content = strings.Join(self.lines, "\n")
+	block.Closed = closed
+	block.Filename = filenameHint(&block)
+	self.block, self.lines = nil, nil
+
+	return block
+}
+
+// filenameHint 依次从信息中的title=、filename=、语言后的:与首行注释中识别文件名, 如```go title=main.go、```go:main.go与// main.go
+func filenameHint(block *CodeBlock) string {
+	fields := strings.Fields(block.Info)
+	if len(fields) > 0 {
+		if language, name, found := strings.Cut(fields[0], ":"); found && isFilename(name) {
+			block.Language = language
+			return name
+		}
+		// 只写了文件名, 如```main.go
+		if isFilename(fields[0]) {
+			block.Language = strings.TrimPrefix(filepath.Ext(fields[0]), ".")
+			return fields[0]
+		}
+	}
+	for _, field := range fields[min(len(fields), 1):] {
+		key, value, found := strings.Cut(field, "=")
+		value = strings.Trim(value, `"'`)
+		switch strings.ToLower(key) {
+		case "title", "file", "filename", "name", "path":
+			if found && isFilename(value) {
+				return value
+			}
+		}
+	}
+
+	first, _, _ := strings.Cut(block.Content, "\n")
+	first = strings.TrimSpace(first)
+	for _, prefix := range []string{"//", "#", "--", "/*", "<!--", ";"} {
+		if strings.HasPrefix(first, prefix) {
+			comment := strings.TrimSpace(strings.TrimPrefix(first, prefix))
+			comment = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(comment, "*/"), "-->"))
+			for _, label := range []string{"file:", "filename:", "文件:", "文件名:", "文件：", "文件名："} {
+				if len(comment) >= len(label) && strings.EqualFold(comment[:len(label)], label) {
+					comment = strings.TrimSpace(comment[len(label):])
+				}
+			}
+			if isFilename(comment) {
+				return comment
+			}
+			break
+		}
+	}
+
+	return ""
+}
+
+// isFilename 带扩展名且不含空白, 如main.go或cmd/app/main.go
+func isFilename(value string) bool {
+	ext := filepath.Ext(value)
+	if len(ext) < 2 || len(ext) > 11 || strings.ContainsAny(value, " \t\"'`<>|*?") {
+		return false
+	}
+	for _, c := range ext[1:] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+
+	return !strings.HasPrefix(value, ".") || len(value) > len(ext)
+}
+
+// FirstCodeBlock 返回第一个指定语言的代码块, 同一语言的别名如go与golang视为相同, language为空时返回第一个代码块
+func FirstCodeBlock(blocks []CodeBlock, language string) (CodeBlock, bool) {
+	for _, block := range blocks {
+		if language == "" || sameLanguage(block.Language, language) {
+			return block, true
+		}
+	}
+
+	return CodeBlock{}, false
+}
+
+func sameLanguage(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	language := codeLanguages[a]
+
+	return language != nil && language == codeLanguages[b]
+}
+
+// WriteCodeBlocks 将有文件名的代码块写入dir, 返回写入的文件路径
+// 文件名不能是绝对路径或通过..跳出dir, 同名的代码块以后出现的为准
+func WriteCodeBlocks(dir string, blocks []CodeBlock) ([]string, error) {
+	var paths []string
+	for _, block := range blocks {
+		if block.Filename == "" {
+			continue
+		}
+		name := filepath.FromSlash(block.Filename)
+		if !filepath.IsLocal(name) {
+			return paths, fmt.Errorf("文件名%q不合法, 不能写入目录之外", block.Filename)
+		}
+
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return paths, fmt.Errorf("创建目录失败, 原因: %w", err)
+		}
+		content := block.Content
+		if content != "" {
+			content += "\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return paths, fmt.Errorf("写入文件失败, 原因: %w", err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
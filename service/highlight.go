@@ -0,0 +1,201 @@
+package service
+
+import (
+	"strings"
+)
+
+const (
+	highlightKeyword = "\x1b[35m"
+	highlightString  = "\x1b[32m"
+	highlightNumber  = "\x1b[33m"
+	highlightComment = "\x1b[90m"
+	highlightReset   = "\x1b[39m"
+)
+
+// codeLanguage 高亮所需的语法, 只区分关键字、字符串、数字与注释
+type codeLanguage struct {
+	keywords     map[string]bool
+	ignoreCase   bool     // 关键字不区分大小写, 如SQL
+	lineComments []string // 单行注释
+	blockComment [2]string
+	quotes       []string // 字符串的引号, 较长的放在前面
+	multiline    []string // 可以跨行的字符串, 如Go的`与Python的"""
+}
+
+func newCodeLanguage(keywords string, lineComments []string, blockComment [2]string, quotes, multiline []string) *codeLanguage {
+	language := &codeLanguage{
+		keywords:     make(map[string]bool),
+		lineComments: lineComments,
+		blockComment: blockComment,
+		quotes:       quotes,
+		multiline:    multiline,
+	}
+	for _, keyword := range strings.Fields(keywords) {
+		language.keywords[keyword] = true
+	}
+
+	return language
+}
+
+var (
+	cStyleComment = [2]string{"/*", "*/"}
+
+	langGo = newCodeLanguage("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var true false nil iota",
+		[]string{"//"}, cStyleComment, []string{`"`, "'", "`"}, []string{"`"})
+	langPython = newCodeLanguage("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield True False None self",
+		[]string{"#"}, [2]string{}, []string{`"""`, "'''", `"`, "'"}, []string{`"""`, "'''"})
+	langJavaScript = newCodeLanguage("async await break case catch class const continue debugger default delete do else export extends finally for from function if import in instanceof interface let new of return static super switch this throw try type typeof var void while yield true false null undefined",
+		[]string{"//"}, cStyleComment, []string{`"`, "'", "`"}, []string{"`"})
+	langJava = newCodeLanguage("abstract boolean break byte case catch char class continue default do double else enum extends final finally float for if implements import instanceof int interface long new package private protected public return short static super switch synchronized this throw throws try void volatile while true false null var",
+		[]string{"//"}, cStyleComment, []string{`"`, "'"}, nil)
+	langC = newCodeLanguage("auto bool break case char class const constexpr continue default delete do double else enum explicit extern false float for friend if inline int long namespace new nullptr operator private protected public return short signed sizeof static struct switch template this throw true try typedef typename union unsigned using virtual void volatile while #include #define",
+		[]string{"//"}, cStyleComment, []string{`"`, "'"}, nil)
+	langRust = newCodeLanguage("as async await break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while",
+		[]string{"//"}, cStyleComment, []string{`"`}, nil)
+	langShell = newCodeLanguage("if then else elif fi case esac for while until do done in function return export local echo exit",
+		[]string{"#"}, [2]string{}, []string{`"`, "'"}, nil)
+	langSQL = newCodeLanguage("select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit offset as distinct null is in like between union all primary key",
+		[]string{"--"}, cStyleComment, []string{"'", `"`}, nil).caseInsensitive()
+	langJSON = newCodeLanguage("true false null", nil, [2]string{}, []string{`"`}, nil)
+
+	codeLanguages = map[string]*codeLanguage{
+		"go": langGo, "golang": langGo,
+		"python": langPython, "py": langPython,
+		"javascript": langJavaScript, "js": langJavaScript, "typescript": langJavaScript, "ts": langJavaScript, "jsx": langJavaScript, "tsx": langJavaScript,
+		"java": langJava, "kotlin": langJava,
+		"c": langC, "cpp": langC, "c++": langC, "h": langC,
+		"rust": langRust, "rs": langRust,
+		"bash": langShell, "sh": langShell, "shell": langShell, "zsh": langShell,
+		"sql": langSQL, "mysql": langSQL,
+		"json": langJSON,
+	}
+)
+
+func (self *codeLanguage) caseInsensitive() *codeLanguage {
+	self.ignoreCase = true
+
+	return self
+}
+
+// codeHighlighter 逐行高亮代码, 记录跨行的块注释与字符串
+type codeHighlighter struct {
+	language *codeLanguage
+	closing  string // 未结束的块注释或字符串的结束标记
+	color    string
+}
+
+// newCodeHighlighter 不支持的语言原样输出
+func newCodeHighlighter(language string) *codeHighlighter {
+	return &codeHighlighter{language: codeLanguages[strings.ToLower(language)]}
+}
+
+func (self *codeHighlighter) line(value string) string {
+	if self.language == nil {
+		return value
+	}
+
+	var builder strings.Builder
+	paint := func(color, text string) {
+		if text != "" {
+			builder.WriteString(color + text + highlightReset)
+		}
+	}
+
+	for i := 0; i < len(value); {
+		if self.closing != "" {
+			end := self.findClosing(value, i)
+			paint(self.color, value[i:end])
+			i = end
+			continue
+		}
+
+		rest := value[i:]
+		if comment := self.language.blockComment[0]; comment != "" && strings.HasPrefix(rest, comment) {
+			self.closing, self.color = self.language.blockComment[1], highlightComment
+			paint(self.color, comment)
+			i += len(comment)
+			continue
+		}
+		if hasAnyPrefix(rest, self.language.lineComments) {
+			paint(highlightComment, rest)
+			break
+		}
+		if quote := firstPrefix(rest, self.language.quotes); quote != "" {
+			self.closing, self.color = quote, highlightString
+			end := self.findClosing(value, i+len(quote))
+			paint(self.color, value[i:end])
+			i = end
+			// 普通字符串不跨行
+			if self.closing != "" && !hasAnyPrefix(quote, self.language.multiline) {
+				self.closing = ""
+			}
+			continue
+		}
+
+		c := value[i]
+		switch {
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentByte(value[i-1])):
+			end := i
+			for end < len(value) && (isIdentByte(value[end]) || value[end] == '.') {
+				end++
+			}
+			paint(highlightNumber, value[i:end])
+			i = end
+		case isIdentByte(c) || c == '#':
+			end := i + 1
+			for end < len(value) && isIdentByte(value[end]) {
+				end++
+			}
+			word := value[i:end]
+			if self.language.ignoreCase {
+				word = strings.ToLower(word)
+			}
+			if self.language.keywords[word] {
+				paint(highlightKeyword, value[i:end])
+			} else {
+				builder.WriteString(value[i:end])
+			}
+			i = end
+		default:
+			builder.WriteByte(c)
+			i++
+		}
+	}
+
+	return builder.String()
+}
+
+// findClosing 返回结束标记之后的位置, 本行未结束时返回行尾
+func (self *codeHighlighter) findClosing(value string, start int) int {
+	for i := start; i < len(value); i++ {
+		if value[i] == '\\' && self.color == highlightString && self.closing != "`" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(value[i:], self.closing) {
+			end := i + len(self.closing)
+			self.closing = ""
+			return end
+		}
+	}
+
+	return len(value)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	return firstPrefix(value, prefixes) != ""
+}
+
+func firstPrefix(value string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return prefix
+		}
+	}
+
+	return ""
+}
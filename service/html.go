@@ -0,0 +1,572 @@
+package service
+
+import (
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HTMLRenderer 将markdown逐段渲染为可以直接插入网页的HTML, 所有文字都会转义, 只保留白名单中的标签与安全的链接
+// 已输出的内容不会再修改, 标签也不会被截断; 流式展示时在已输出的内容后拼接ClosingTags即可得到完整的HTML
+type HTMLRenderer struct {
+	parser *markdownParser
+	sink   *htmlSink
+}
+
+// RenderHTML 将完整的markdown渲染为HTML
+func RenderHTML(value string) string {
+	renderer := new(HTMLRenderer)
+
+	return renderer.Do(value) + renderer.Flush()
+}
+
+// Do 输入一段内容, 返回可以追加到页面中的HTML片段
+func (self *HTMLRenderer) Do(value string) string {
+	if self.parser == nil {
+		self.sink = new(htmlSink)
+		self.parser = &markdownParser{sink: self.sink}
+	}
+
+	return self.parser.write(value)
+}
+
+// ClosingTags 返回闭合当前未结束元素的标签, 不影响后续的输出
+func (self *HTMLRenderer) ClosingTags() string {
+	if self.sink == nil {
+		return ""
+	}
+
+	return self.sink.closingTags()
+}
+
+// Flush 输出剩余的内容并闭合所有元素, 然后重置状态
+func (self *HTMLRenderer) Flush() string {
+	result := self.Do("") + self.parser.flush()
+	self.parser, self.sink = nil, nil
+
+	return result
+}
+
+var (
+	// htmlAllowedTags markdown中可以保留的行内HTML标签, 属性一律去掉
+	htmlAllowedTags = map[string]bool{
+		"b": true, "strong": true, "i": true, "em": true, "u": true, "s": true, "del": true, "ins": true,
+		"mark": true, "sub": true, "sup": true, "small": true, "kbd": true, "code": true, "br": true, "wbr": true,
+	}
+	htmlVoidTags = map[string]bool{"br": true, "wbr": true}
+
+	// htmlContainers 开始标签后换行的元素
+	htmlContainers = map[string]bool{"blockquote": true, "ul": true, "ol": true, "table": true, "thead": true, "tbody": true}
+	// htmlLineBreaks 结束标签后换行的元素
+	htmlLineBreaks = map[string]bool{
+		"blockquote": true, "ul": true, "ol": true, "li": true, "table": true, "thead": true, "tbody": true, "tr": true,
+		"p": true, "pre": true, "div": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	}
+
+	htmlEmphasisTags = map[string][]string{
+		"*": {"em"}, "_": {"em"}, "**": {"strong"}, "__": {"strong"}, "***": {"strong", "em"}, "___": {"strong", "em"}, "~~": {"del"},
+	}
+)
+
+// 行的类型, 决定行首需要关闭哪些块
+const (
+	htmlText = iota
+	htmlList
+	htmlTable
+	htmlBlock // 标题、分隔线与代码块
+)
+
+// htmlElement 一个未结束的元素
+type htmlElement struct {
+	name    string
+	open    string // 开始标签, 为空时不输出, 如不安全的链接
+	key     string // 行内元素对应的markdown标记
+	indent  int    // 列表的缩进
+	inline  bool
+	written bool // 行内元素在其中出现文字时才输出开始标签
+}
+
+type htmlSink struct {
+	output strings.Builder
+	open   []htmlElement // 从外到内, 最外层是引用
+
+	started bool // 当前行已确定所属的块
+	quotes  int  // 当前行的引用层数
+	depth   int  // 已打开的引用层数
+	blank   bool // 上一行是空行
+
+	cellPending bool // 表格中下一个单元格尚未打开
+	inMath      bool // 在$$公式块中
+
+	alt *strings.Builder // 图片的替代文字
+	src string
+}
+
+func (self *htmlSink) top() string {
+	if len(self.open) == 0 {
+		return ""
+	}
+
+	return self.open[len(self.open)-1].name
+}
+
+func (self *htmlSink) lastIndex(match func(element htmlElement) bool) int {
+	for i := len(self.open) - 1; i >= 0; i-- {
+		if match(self.open[i]) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (self *htmlSink) pushBlock(name, open string, indent int) {
+	self.output.WriteString(open)
+	if htmlContainers[name] {
+		self.output.WriteByte('\n')
+	}
+	self.open = append(self.open, htmlElement{name: name, open: open, indent: indent, written: true})
+}
+
+func (self *htmlSink) pushInline(name, open, key string) {
+	self.open = append(self.open, htmlElement{name: name, open: open, key: key, inline: true})
+}
+
+// closeTo 从内向外关闭元素, 直到只剩前size个
+func (self *htmlSink) closeTo(size int) {
+	for len(self.open) > size {
+		element := self.open[len(self.open)-1]
+		self.open = self.open[:len(self.open)-1]
+		if element.written && element.open != "" {
+			self.output.WriteString("</" + element.name + ">")
+			if htmlLineBreaks[element.name] {
+				self.output.WriteByte('\n')
+			}
+		}
+	}
+}
+
+// closeAt 关闭第i个元素, 其内部仍然生效的行内元素在之后重新打开
+func (self *htmlSink) closeAt(i int) {
+	reopen := slices.Clone(self.open[i+1:])
+	self.closeTo(i)
+	for _, element := range reopen {
+		element.written = false
+		self.open = append(self.open, element)
+	}
+}
+
+func (self *htmlSink) closeInline() {
+	for len(self.open) > 0 && self.open[len(self.open)-1].inline {
+		self.closeTo(len(self.open) - 1)
+	}
+}
+
+// listLevel 最内层列表项之内的元素个数, 不在列表中时为引用的层数
+func (self *htmlSink) listLevel() int {
+	if i := self.lastIndex(func(element htmlElement) bool { return element.name == "li" }); i >= 0 {
+		return i + 1
+	}
+
+	return self.depth
+}
+
+// enterQuotes 按当前行的引用层数打开或关闭blockquote, 引用总是在最外层
+func (self *htmlSink) enterQuotes() {
+	if self.quotes == self.depth {
+		return
+	}
+	self.depth = min(self.depth, self.quotes)
+	self.closeTo(self.depth)
+	for ; self.depth < self.quotes; self.depth++ {
+		self.pushBlock("blockquote", "<blockquote>", 0)
+	}
+}
+
+// begin 每行输出第一个内容前调用, 按该行的类型关闭之前的块
+func (self *htmlSink) begin(kind int) {
+	if self.started {
+		return
+	}
+	self.started = true
+	self.enterQuotes()
+
+	top := self.top()
+	switch {
+	case kind == htmlText && !self.blank && (top == "p" || top == "li"):
+		// 没有空行隔开的文字属于同一段落或列表项
+		self.output.WriteByte('\n')
+	case kind == htmlText:
+		self.closeTo(self.depth)
+		self.pushBlock("p", "<p>", 0)
+	case kind == htmlList:
+		self.closeTo(self.listLevel())
+	case kind == htmlTable && (top == "thead" || top == "tbody"):
+	default:
+		self.closeTo(self.depth)
+	}
+	self.blank = false
+}
+
+// endLine 整行已由块级标记处理完, 如分隔线与代码块标记
+func (self *htmlSink) endLine() {
+	self.started, self.quotes, self.cellPending = false, 0, false
+}
+
+// prepare 输出行内内容前调用, 打开尚未打开的单元格
+func (self *htmlSink) prepare() {
+	self.begin(htmlText)
+	if !self.cellPending {
+		return
+	}
+	self.cellPending = false
+	if self.lastIndex(func(element htmlElement) bool { return element.name == "thead" }) >= 0 {
+		self.pushBlock("th", "<th>", 0)
+	} else {
+		self.pushBlock("td", "<td>", 0)
+	}
+}
+
+// write 输出已转义的内容, 尚未输出的行内开始标签放在开头的空白之后
+func (self *htmlSink) write(value string) {
+	text := strings.TrimLeft(value, " \t")
+	self.output.WriteString(value[:len(value)-len(text)])
+	if text == "" {
+		return
+	}
+	for i := range self.open {
+		if !self.open[i].written {
+			self.open[i].written = true
+			self.output.WriteString(self.open[i].open)
+		}
+	}
+	self.output.WriteString(text)
+}
+
+func (self *htmlSink) text(value string) {
+	if self.alt != nil {
+		self.alt.WriteString(value)
+		return
+	}
+	if self.cellPending && strings.TrimSpace(value) == "" {
+		return // 单元格开头的空白
+	}
+	self.prepare()
+	self.write(html.EscapeString(value))
+}
+
+func (self *htmlSink) code(value string) {
+	if self.alt != nil {
+		self.alt.WriteString(value)
+		return
+	}
+	self.prepare()
+	self.write("<code>" + html.EscapeString(value) + "</code>")
+}
+
+// math 公式原样保留$分隔符, 由页面中的KaTeX或MathJax渲染
+func (self *htmlSink) math(value string, display bool) {
+	if self.alt != nil {
+		self.alt.WriteString(value)
+		return
+	}
+	self.prepare()
+	class := "math math-inline"
+	if display {
+		class = "math math-display"
+	}
+	self.write(`<span class="` + class + `">` + html.EscapeString(value) + "</span>")
+}
+
+// html 白名单之外的标签按文字输出, 白名单中的标签去掉所有属性
+func (self *htmlSink) html(tag string) {
+	if self.alt != nil {
+		return
+	}
+	self.prepare()
+
+	closing := strings.HasPrefix(tag, "</")
+	name := strings.TrimLeft(tag, "</")
+	if end := strings.IndexAny(name, " \t\r/>"); end >= 0 {
+		name = name[:end]
+	}
+	name = strings.ToLower(name)
+	switch {
+	case !htmlAllowedTags[name]:
+		self.write(html.EscapeString(tag))
+	case htmlVoidTags[name]:
+		if !closing {
+			self.write("<" + name + ">")
+		}
+	case closing:
+		// 没有对应开始标签的结束标签直接丢弃
+		if i := self.lastIndex(func(element htmlElement) bool { return element.inline && element.key == "<"+name }); i >= 0 {
+			self.closeAt(i)
+		}
+	default:
+		self.pushInline(name, "<"+name+">", "<"+name)
+	}
+}
+
+func (self *htmlSink) style(marker string, on bool) {
+	if self.alt != nil {
+		return
+	}
+	if on {
+		self.prepare()
+		for _, name := range htmlEmphasisTags[marker] {
+			self.pushInline(name, "<"+name+">", marker)
+		}
+		return
+	}
+
+	for range htmlEmphasisTags[marker] {
+		if i := self.lastIndex(func(element htmlElement) bool { return element.inline && element.key == marker }); i >= 0 {
+			self.closeAt(i)
+		}
+	}
+}
+
+func (self *htmlSink) link(url string, image, on bool) {
+	switch {
+	case image && on:
+		self.prepare()
+		self.src, _ = safeURL(url, true)
+		self.alt = new(strings.Builder)
+	case image:
+		self.image()
+	case self.alt != nil:
+		// 图片的替代文字中不再嵌套链接
+	case on:
+		self.prepare()
+		open := ""
+		if href, ok := safeURL(url, false); ok {
+			open = `<a href="` + href + `" rel="nofollow noopener noreferrer">`
+		}
+		self.pushInline("a", open, "link")
+	default:
+		if i := self.lastIndex(func(element htmlElement) bool { return element.inline && element.key == "link" }); i >= 0 {
+			self.closeAt(i)
+		}
+	}
+}
+
+// image 输出图片, 地址不安全时只保留替代文字
+func (self *htmlSink) image() {
+	if self.alt == nil {
+		return
+	}
+	alt := self.alt.String()
+	self.alt = nil
+	// 图片前的空白留在图片外
+	text := strings.TrimLeft(alt, " \t")
+	if self.src == "" {
+		self.write(html.EscapeString(alt))
+		return
+	}
+	self.write(alt[:len(alt)-len(text)] + `<img src="` + self.src + `" alt="` + html.EscapeString(text) + `">`)
+}
+
+func (self *htmlSink) heading(level int) {
+	self.begin(htmlBlock)
+	name := "h" + strconv.Itoa(level)
+	self.pushBlock(name, "<"+name+">", 0)
+}
+
+func (self *htmlSink) listItem(indent int) {
+	self.item(indent, "ul", "<ul>")
+}
+
+func (self *htmlSink) orderedItem(indent int, number string) bool {
+	open := "<ol>"
+	if start, _ := strconv.Atoi(number); start != 1 {
+		open = `<ol start="` + strconv.Itoa(start) + `">`
+	}
+	self.item(indent, "ol", open)
+
+	return true
+}
+
+// item 缩进更多的列表项嵌套在上一个列表项中, 缩进相同但类型不同时开始新的列表
+func (self *htmlSink) item(indent int, name, open string) {
+	self.begin(htmlList)
+	for size := len(self.open); size >= 2 && self.open[size-1].name == "li"; size = len(self.open) {
+		list := self.open[size-2]
+		if list.indent < indent {
+			break
+		}
+		if list.indent == indent && list.name == name {
+			self.closeTo(size - 1)
+			self.pushBlock("li", "<li>", indent)
+			return
+		}
+		self.closeTo(size - 2)
+	}
+	self.pushBlock(name, open, indent)
+	self.pushBlock("li", "<li>", indent)
+}
+
+func (self *htmlSink) task(done bool) {
+	if done {
+		self.output.WriteString(`<input type="checkbox" checked disabled> `)
+	} else {
+		self.output.WriteString(`<input type="checkbox" disabled> `)
+	}
+}
+
+func (self *htmlSink) quote() {
+	if !self.started {
+		self.quotes++
+	}
+}
+
+func (self *htmlSink) rule(newline bool) {
+	self.begin(htmlBlock)
+	self.output.WriteString("<hr>\n")
+	if newline {
+		self.endLine()
+	}
+}
+
+func (self *htmlSink) tableRow() {
+	self.begin(htmlTable)
+	switch self.top() {
+	case "thead":
+		// 第二行起是表格的内容
+		self.closeTo(len(self.open) - 1)
+		self.pushBlock("tbody", "<tbody>", 0)
+	case "tbody":
+	default:
+		self.pushBlock("table", "<table>", 0)
+		self.pushBlock("thead", "<thead>", 0)
+	}
+	self.pushBlock("tr", "<tr>", 0)
+	self.cellPending = true
+}
+
+// tableCell 单元格在出现内容时才打开, 行尾的|不会产生多余的单元格
+func (self *htmlSink) tableCell() {
+	self.image()
+	if self.cellPending {
+		self.prepare()
+	}
+	self.closeTo(self.lastIndex(func(element htmlElement) bool { return element.name == "tr" }) + 1)
+	self.cellPending = true
+}
+
+func (self *htmlSink) codeStart(language string, newline bool) {
+	self.begin(htmlBlock)
+	switch language = codeClass(language); language {
+	case "math":
+		self.pushBlock("div", `<div class="math math-display">`, 0)
+		self.output.WriteString("$$\n")
+		self.inMath = true
+	case "":
+		self.pushBlock("pre", "<pre>", 0)
+		self.pushBlock("code", "<code>", 0)
+	default:
+		self.pushBlock("pre", "<pre>", 0)
+		self.pushBlock("code", `<code class="language-`+language+`">`, 0)
+	}
+	if newline {
+		self.endLine()
+	}
+}
+
+func (self *htmlSink) codeText(value string, newline bool) {
+	self.output.WriteString(html.EscapeString(value))
+	if newline {
+		self.output.WriteByte('\n')
+	}
+}
+
+func (self *htmlSink) codeEnd() {
+	if self.inMath {
+		self.output.WriteString("$$")
+		self.inMath = false
+	}
+	self.closeTo(self.depth)
+	self.endLine()
+}
+
+func (self *htmlSink) newline() {
+	self.image()
+	self.closeInline()
+	if !self.started {
+		// 空行结束段落与表格, 列表可以继续
+		self.enterQuotes()
+		self.closeTo(self.listLevel())
+		self.blank = true
+	} else if i := self.lastIndex(func(element htmlElement) bool { return element.name == "tr" }); i >= 0 {
+		self.closeTo(i)
+	} else if name := self.top(); len(name) == 2 && name[0] == 'h' {
+		self.closeTo(len(self.open) - 1)
+	}
+	self.endLine()
+}
+
+func (self *htmlSink) finish() {
+	self.image()
+	self.inMath = false
+	self.closeTo(0)
+}
+
+func (self *htmlSink) take() string {
+	result := self.output.String()
+	self.output.Reset()
+
+	return result
+}
+
+func (self *htmlSink) closingTags() string {
+	var builder strings.Builder
+	for i := len(self.open) - 1; i >= 0; i-- {
+		if element := self.open[i]; element.written && element.open != "" {
+			builder.WriteString("</" + element.name + ">")
+		}
+	}
+
+	return builder.String()
+}
+
+// safeURL 只允许http、https与相对地址, 链接还允许mailto, 返回转义后可以放入属性的地址
+func safeURL(value string, image bool) (string, bool) {
+	// 去掉链接的标题, 如[a](url "title")
+	value, _, _ = strings.Cut(strings.TrimSpace(value), " ")
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+	// 浏览器会忽略地址中的控制字符, 如java\tscript:
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "", false
+	}
+
+	if i := strings.IndexAny(value, ":/?#"); i >= 0 && value[i] == ':' {
+		switch strings.ToLower(value[:i]) {
+		case "http", "https":
+		case "mailto":
+			if image {
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+
+	return html.EscapeString(value), true
+}
+
+// codeClass 代码块的语言只保留字母、数字与+#.-_
+func codeClass(language string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x80 && (isLetter(byte(r)) || r >= '0' && r <= '9' || strings.ContainsRune("+#.-_", r)) {
+			return r
+		}
+		return -1
+	}, strings.ToLower(language))
+}
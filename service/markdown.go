@@ -1,72 +1,115 @@
 package service
 
 import (
-	"regexp"
 	"strings"
 )
 
+// CodeBlockMode 代码块的处理方式
+type CodeBlockMode int
+
+const (
+	CodeBlockDrop        CodeBlockMode = iota // 删除整个代码块
+	CodeBlockKeep                             // 保留代码, 去除```标记
+	CodeBlockPlaceholder                      // 替换为Placeholder
+)
+
+const defaultCodePlaceholder = "(代码略)"
+
+// MarkdownProcessor 将markdown转为纯文本, 去除语法标记并保留其中的文字
+// 可逐段输入StreamChat的回复, 跨片段的语法会等到能确定时再输出, 全部输入后需调用Flush取出剩余内容
 type MarkdownProcessor struct {
-	inCodeBlock bool
+	CodeBlock   CodeBlockMode
+	Placeholder string // CodeBlockPlaceholder时代码块替换成的文字, 默认为"(代码略)"
+
+	parser *markdownParser
+}
+
+// StripMarkdown 将完整的markdown文本转为纯文本
+func StripMarkdown(value string, mode CodeBlockMode) string {
+	processor := &MarkdownProcessor{CodeBlock: mode}
+
+	return processor.Do(value) + processor.Flush()
 }
 
+// Do 输入一段内容, 返回已能确定的纯文本
 func (self *MarkdownProcessor) Do(value string) string {
-	lines := strings.Split(value, "\n")
-	var result []string
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-
-		if self.inCodeBlock {
-			if strings.HasPrefix(trimmedLine, "```") {
-				self.inCodeBlock = false
-			}
-			continue
-		}
-
-		if strings.HasPrefix(trimmedLine, "```") {
-			self.inCodeBlock = true
-			continue
-		}
-
-		if self.isMarkdown(trimmedLine) {
-			continue
-		}
-
-		processedLine := self.removeLineCode(trimmedLine)
-		if processedLine != "" {
-			result = append(result, processedLine)
-		}
+	if self.parser == nil {
+		self.parser = &markdownParser{sink: &plainSink{mode: self.CodeBlock, placeholder: self.Placeholder}}
 	}
 
-	return strings.Join(result, "\n")
+	return self.parser.write(value)
 }
 
-// 判断是否为markdown语法
-func (self *MarkdownProcessor) isMarkdown(value string) bool {
-	for _, pattern := range self.getPatterns() {
-		re := regexp.MustCompile(pattern)
-		if re.MatchString(value) {
-			return true
-		}
-	}
+// Flush 输出剩余的内容并重置状态, 以便处理下一段回复
+func (self *MarkdownProcessor) Flush() string {
+	result := self.Do("") + self.parser.flush()
+	self.parser = nil
 
-	return false
+	return result
 }
 
-// 去除行内代码,包括markdown内容
-func (self *MarkdownProcessor) removeLineCode(value string) string {
-	re := regexp.MustCompile("`[^`]*`")
-	return strings.TrimSpace(re.ReplaceAllString(value, ""))
+// plainSink 只输出文字
+type plainSink struct {
+	mode        CodeBlockMode
+	placeholder string
+	output      strings.Builder
+}
+
+func (self *plainSink) text(value string)                          { self.output.WriteString(value) }
+func (self *plainSink) code(value string)                          { self.output.WriteString(value) }
+func (self *plainSink) math(value string, display bool)            { self.output.WriteString(value) }
+func (self *plainSink) html(tag string)                            { self.output.WriteString(tag) }
+func (self *plainSink) style(marker string, on bool)               {}
+func (self *plainSink) link(url string, image, on bool)            {}
+func (self *plainSink) heading(level int)                          {}
+func (self *plainSink) listItem(indent int)                        {}
+func (self *plainSink) orderedItem(indent int, number string) bool { return false }
+func (self *plainSink) task(done bool)                             {}
+func (self *plainSink) quote()                                     {}
+func (self *plainSink) rule(newline bool)                          {}
+func (self *plainSink) tableRow()                                  {}
+func (self *plainSink) tableCell()                                 {}
+func (self *plainSink) codeEnd()                                   {}
+func (self *plainSink) newline()                                   { self.output.WriteByte('\n') }
+func (self *plainSink) finish()                                    {}
+
+func (self *plainSink) codeStart(language string, newline bool) {
+	if self.mode != CodeBlockPlaceholder {
+		return
+	}
+
+	placeholder := self.placeholder
+	if placeholder == "" {
+		placeholder = defaultCodePlaceholder
+	}
+	self.output.WriteString(placeholder)
+	if newline {
+		self.output.WriteByte('\n')
+	}
 }
 
-// 正则匹配的规则
-func (self *MarkdownProcessor) getPatterns() []string {
-	return []string{
-		"^#{1,6}\\s",           // 标题
-		"^\\s*[-+*]\\s+",       // 无序列表
-		"^\\d+\\.\\s+",         // 有序列表
-		"^>\\s+",               // 引用
-		"^!\\[.*?\\]\\(.*?\\)", // 图片
-		"^\\[.*?\\]\\(.*?\\)",  // 链接
+func (self *plainSink) codeText(value string, newline bool) {
+	if self.mode != CodeBlockKeep {
+		return
+	}
+
+	self.output.WriteString(value)
+	if newline {
+		self.output.WriteByte('\n')
 	}
 }
+
+func (self *plainSink) take() string {
+	result := self.output.String()
+	self.output.Reset()
+
+	return result
+}
+
+// ExtractCodeBlock 提取第一个代码块的内容, 不存在代码块时返回false
+// 代码块未闭合时(如回复被截断)同样返回已有内容
+func (self *MarkdownProcessor) ExtractCodeBlock(value string) (string, bool) {
+	block, ok := FirstCodeBlock(ExtractCodeBlocks(value), "")
+
+	return block.Content, ok
+}
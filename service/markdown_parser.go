@@ -0,0 +1,740 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxLookahead 最多向后查找的字节数, 超过仍无法确定的语法按普通文字输出, 避免长时间不输出
+const maxLookahead = 1024
+
+// markdownSink 接收markdownParser解析出的内容, 由纯文本、终端与HTML渲染分别实现
+type markdownSink interface {
+	text(value string)                          // 文字, 包括文字之间的空白
+	code(value string)                          // 行内代码
+	math(value string, display bool)            // 行内公式, value包含$或$$
+	html(tag string)                            // 行内的HTML标签, 原样给出
+	style(marker string, on bool)               // 强调的开始与结束, marker为*、**、***、_、__、___或~~
+	link(url string, image, on bool)            // 链接或图片文字的开始与结束
+	heading(level int)                          // 标题, 到行尾结束
+	listItem(indent int)                        // 无序列表项
+	orderedItem(indent int, number string) bool // 有序列表项, 返回false时标记按文字输出
+	task(done bool)                             // 任务列表的勾选框
+	quote()                                     // 引用, 嵌套时多次调用
+	rule(newline bool)                          // 分隔线
+	tableRow()                                  // 表格行的开始, 到行尾结束
+	tableCell()                                 // 表格的单元格分隔
+	codeStart(language string, newline bool)    // 代码块开始
+	codeText(value string, newline bool)        // 代码块中的内容, 一行可能分多次给出
+	codeEnd()                                   // 代码块结束
+	newline()                                   // 换行
+	finish()                                    // 输入结束
+	take() string                               // 取出已输出的内容
+}
+
+type markdownSkip struct {
+	size   int
+	marker string // 为空时是链接的](url), 为!时是图片的](url)
+}
+
+// markdownParser 逐段解析markdown, 跨片段的语法会等到能确定时再交给sink
+type markdownParser struct {
+	sink      markdownSink
+	pending   string               // 尚无法确定如何输出的内容
+	inLine    bool                 // 行首的标题、列表、引用等标记已处理完
+	inList    bool                 // 刚处理完列表标记, 其后可能是任务列表的[ ]
+	inCode    bool                 // 在代码块中
+	codeText  bool                 // 当前代码行已确定不是结束标记
+	fence     string               // 代码块的开始标记
+	table     bool                 // 当前行是表格行
+	hasText   bool                 // 当前行已输出文字
+	spaces    string               // 暂存的空白, 后面还有文字时才输出
+	cellBreak bool                 // 刚遇到表格的|, 单元格之间只保留一个空格
+	prev      string               // 最近输出的几个字节, 用于判断_是否在单词中间
+	offset    int                  // 已处理的字节数
+	skips     map[int]markdownSkip // 当前行中待删除的结束标记
+}
+
+func (self *markdownParser) write(value string) string {
+	self.pending += value
+	self.process(false)
+
+	return self.sink.take()
+}
+
+func (self *markdownParser) flush() string {
+	self.process(true)
+	self.sink.finish()
+
+	return self.sink.take()
+}
+
+func (self *markdownParser) consume(size int) {
+	self.pending = self.pending[size:]
+	self.offset += size
+}
+
+// skipAt 标记pending中index处的size个字节在处理到时删除, 并结束marker对应的强调或链接
+func (self *markdownParser) skipAt(index, size int, marker string) {
+	if self.skips == nil {
+		self.skips = make(map[int]markdownSkip)
+	}
+	self.skips[self.offset+index] = markdownSkip{size: size, marker: marker}
+}
+
+// process final为true时视为输入已结束, 不再等待后续内容
+func (self *markdownParser) process(final bool) {
+	for self.pending != "" {
+		var done bool
+		switch {
+		case self.inCode:
+			done = self.codeLine(final)
+		case !self.inLine:
+			done = self.lineStart(final)
+		default:
+			done = self.inline(final)
+		}
+		if !done {
+			return
+		}
+	}
+}
+
+// currentLine 返回当前行剩余的内容, 最多maxLookahead个字节
+// complete表示不需要再等待后续内容, truncated表示该行超长, 只返回了前面一部分
+func (self *markdownParser) currentLine(final bool) (line string, complete, truncated bool) {
+	line = self.pending
+	if len(line) > maxLookahead {
+		line, truncated = line[:maxLookahead], true
+	}
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		return line[:i], true, false
+	}
+
+	return line, final || truncated, truncated
+}
+
+// skipLine 跳过当前行, 返回该行是否以换行结束
+func (self *markdownParser) skipLine(line string) bool {
+	self.consume(len(line))
+	if strings.HasPrefix(self.pending, "\n") {
+		self.consume(1)
+		return true
+	}
+
+	return false
+}
+
+func (self *markdownParser) codeLine(final bool) bool {
+	line, complete, truncated := self.currentLine(final)
+	if !self.codeText {
+		// 只有代码块标记与空白的行可能是结束标记, 需要整行才能判断
+		maybeFence := strings.Trim(line, self.fence[:1]+" \t\r") == ""
+		if maybeFence && !complete {
+			return false
+		}
+		if maybeFence && !truncated {
+			if trimmed := strings.TrimSpace(line); len(trimmed) >= len(self.fence) {
+				self.inCode = false
+				self.skipLine(line)
+				self.sink.codeEnd()
+				return true
+			}
+		}
+		self.codeText = true
+	}
+
+	// 代码行边收到边输出
+	newline := self.skipLine(line)
+	self.sink.codeText(line, newline)
+	if newline {
+		self.codeText = false
+	}
+
+	return true
+}
+
+// lineStart 处理行首的代码块、分隔线、标题、引用、列表与表格标记
+func (self *markdownParser) lineStart(final bool) bool {
+	line, complete, truncated := self.currentLine(final)
+	rest := strings.TrimLeft(line, " \t")
+	indent := len(line) - len(rest)
+	if !complete && self.undecided(rest) {
+		return false
+	}
+
+	// 超长的行不作为代码块标记、分隔线与表格的分隔行
+	switch {
+	case !truncated && isFence(rest):
+		self.inCode = true
+		self.fence = rest[:len(rest)-len(strings.TrimLeft(rest, rest[:1]))]
+		language, _, _ := strings.Cut(strings.TrimSpace(rest[len(self.fence):]), " ")
+		self.sink.codeStart(language, self.skipLine(line))
+		self.resetLine()
+		return true
+	case !truncated && isMathFence(rest):
+		// $$公式块与```math一样按语言为math的代码块处理
+		self.inCode = true
+		self.fence = "$$"
+		self.sink.codeStart("math", self.skipLine(line))
+		self.resetLine()
+		return true
+	case !truncated && isRule(rest):
+		self.sink.rule(self.skipLine(line))
+		self.resetLine()
+		return true
+	case !truncated && isTableDelimiter(rest):
+		self.skipLine(line)
+		self.resetLine()
+		return true
+	case self.inList && isTaskMark(rest):
+		self.sink.task(rest[1] != ' ')
+		self.consume(indent + 4)
+		self.inList = false
+		return true
+	}
+	self.inList = false
+
+	if heading := len(rest) - len(strings.TrimLeft(rest, "#")); heading > 0 && heading <= 6 &&
+		(heading == len(rest) || rest[heading] == ' ' || rest[heading] == '\t') {
+		self.sink.heading(heading)
+		self.consume(indent + heading)
+		self.inLine = true
+		return true
+	}
+
+	switch {
+	case strings.HasPrefix(rest, ">"):
+		self.sink.quote()
+		self.consume(indent + 1)
+	case len(rest) > 1 && strings.IndexByte("-+*", rest[0]) >= 0 && (rest[1] == ' ' || rest[1] == '\t'):
+		self.sink.listItem(indent)
+		self.consume(indent + 2)
+		self.inList = true
+	case strings.HasPrefix(rest, "|"):
+		self.sink.tableRow()
+		self.consume(indent + 1)
+		self.table = true
+		self.inLine = true
+	default:
+		if size := orderedMarker(rest); size > 0 && self.sink.orderedItem(indent, rest[:size-1]) {
+			self.consume(indent + size)
+			self.inList = true
+			return true
+		}
+		self.consume(indent)
+		self.inLine = true
+	}
+
+	return true
+}
+
+// undecided 行首内容不足以判断是哪种语法
+func (self *markdownParser) undecided(rest string) bool {
+	switch {
+	case rest == "", rest == "+", strings.Trim(rest, "#") == "":
+		return true
+	case rest[0] == '$':
+		// 可能是公式块的$$, 需要整行才能判断
+		return strings.Trim(rest, "$ \t\r") == "" && len(strings.TrimRight(rest, " \t\r")) <= 2
+	case rest[0] >= '0' && rest[0] <= '9':
+		// 可能是有序列表的1.或1)
+		digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+		return digits <= 9 && (digits == len(rest) || digits+1 == len(rest) && (rest[digits] == '.' || rest[digits] == ')'))
+	case strings.Trim(rest, "-*_= \t") == "":
+		return true // 可能是分隔线
+	case rest[0] == '|' && strings.Trim(rest, "|-: \t") == "":
+		return true // 可能是表格的分隔行
+	case rest[0] == '`' || rest[0] == '~':
+		// 代码块标记需要整行才能判断
+		return len(rest) < 3 && strings.Trim(rest, rest[:1]) == "" || isFence(rest)
+	case self.inList && len(rest) < 4:
+		for _, mark := range []string{"[ ] ", "[x] ", "[X] "} {
+			if strings.HasPrefix(mark, rest) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isFence(rest string) bool {
+	if !strings.HasPrefix(rest, "```") && !strings.HasPrefix(rest, "~~~") {
+		return false
+	}
+
+	// ```后的语言标识中不能再有`, 否则是行内代码
+	return rest[0] == '~' || !strings.Contains(strings.TrimLeft(rest, "`"), "`")
+}
+
+func isMathFence(rest string) bool {
+	return strings.TrimRight(rest, " \t\r") == "$$"
+}
+
+// orderedMarker 返回有序列表标记如1.的长度, 不是有序列表时返回0
+func orderedMarker(rest string) int {
+	digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+	if digits == 0 || digits > 9 || digits+1 >= len(rest) || rest[digits] != '.' && rest[digits] != ')' {
+		return 0
+	}
+	if c := rest[digits+1]; c != ' ' && c != '\t' {
+		return 0
+	}
+
+	return digits + 1
+}
+
+func isRule(rest string) bool {
+	value := strings.NewReplacer(" ", "", "\t", "").Replace(rest)
+
+	return len(value) >= 3 && strings.IndexByte("-*_=", value[0]) >= 0 && strings.Trim(value, value[:1]) == ""
+}
+
+func isTableDelimiter(rest string) bool {
+	return strings.HasPrefix(rest, "|") && strings.Contains(rest, "-") && strings.Trim(rest, "|-: \t") == ""
+}
+
+func isTaskMark(rest string) bool {
+	return strings.HasPrefix(rest, "[ ] ") || strings.HasPrefix(rest, "[x] ") || strings.HasPrefix(rest, "[X] ")
+}
+
+func (self *markdownParser) resetLine() {
+	self.inLine, self.inList, self.table, self.hasText, self.cellBreak = false, false, false, false, false
+	self.spaces, self.prev = "", ""
+	clear(self.skips)
+}
+
+// inline 处理行内的强调、代码、链接与图片
+func (self *markdownParser) inline(final bool) bool {
+	if skip, ok := self.skips[self.offset]; ok {
+		delete(self.skips, self.offset)
+		self.consume(skip.size)
+		switch skip.marker {
+		case "", "!":
+			self.sink.link("", skip.marker == "!", false)
+		default:
+			self.sink.style(skip.marker, false)
+		}
+		return true
+	}
+
+	switch c := self.pending[0]; c {
+	case '\n':
+		self.consume(1)
+		self.sink.newline()
+		self.resetLine()
+	case ' ', '\t', '\r':
+		if !self.cellBreak {
+			self.spaces += string(c)
+		}
+		self.consume(1)
+		self.prev = " "
+	case '|':
+		if self.table {
+			self.sink.tableCell()
+			self.spaces, self.cellBreak = " ", true
+			self.consume(1)
+			self.prev = " "
+			return true
+		}
+		self.emitLiteral(1)
+	case '\\':
+		if len(self.pending) < 2 {
+			if !final {
+				return false
+			}
+			self.emitLiteral(1)
+		} else if strings.IndexByte("\\`*_{}[]()#+-.!|~<>", self.pending[1]) >= 0 {
+			self.emit(self.pending[1:2])
+			self.consume(2)
+		} else {
+			self.emitLiteral(1)
+		}
+	case '`':
+		return self.codeSpan(final)
+	case '!':
+		if len(self.pending) < 2 && !final {
+			return false
+		}
+		if len(self.pending) >= 2 && self.pending[1] == '[' {
+			return self.link(1, final)
+		}
+		self.emitLiteral(1)
+	case '[':
+		return self.link(0, final)
+	case '<':
+		return self.autolink(final)
+	case '*', '_', '~':
+		return self.emphasis(final)
+	case '$':
+		return self.mathSpan(final)
+	default:
+		end := 1
+		for end < len(self.pending) && strings.IndexByte("\n \t\r|\\`![]<*_~$", self.pending[end]) < 0 {
+			end++
+		}
+		self.emitLiteral(end)
+	}
+
+	return true
+}
+
+func (self *markdownParser) emit(text string) {
+	self.emitWith(text, self.sink.text)
+}
+
+// emitWith 先输出暂存的空白再输出text, 行首的空白直接丢弃
+func (self *markdownParser) emitWith(text string, write func(string)) {
+	if text == "" {
+		return
+	}
+	if self.hasText && self.spaces != "" {
+		self.sink.text(self.spaces)
+	}
+	write(text)
+	self.spaces, self.hasText, self.cellBreak = "", true, false
+	// 保留最后一个完整的字符, 片段可能在多字节字符中间结束
+	self.prev += text
+	if len(self.prev) > utf8.UTFMax {
+		self.prev = self.prev[len(self.prev)-utf8.UTFMax:]
+	}
+}
+
+// emitLiteral 原样输出pending的前size个字节
+func (self *markdownParser) emitLiteral(size int) {
+	self.emit(self.pending[:size])
+	self.consume(size)
+}
+
+// codeSpan 行内代码保留其中的内容
+func (self *markdownParser) codeSpan(final bool) bool {
+	line, complete, _ := self.currentLine(final)
+	size := runLength(line, 0)
+	end, found := matchRun(line, size, size, complete)
+	switch {
+	case !found && !complete:
+		return false
+	case !found:
+		self.emitLiteral(size)
+		return true
+	}
+
+	content := line[size:end]
+	if len(content) >= 2 && content[0] == ' ' && content[len(content)-1] == ' ' && strings.Trim(content, " ") != "" {
+		content = content[1 : len(content)-1]
+	}
+	self.emitWith(content, self.sink.code)
+	self.consume(end + size)
+
+	return true
+}
+
+// link 链接与图片只保留文字, offset为1时是图片
+func (self *markdownParser) link(offset int, final bool) bool {
+	line, complete, _ := self.currentLine(final)
+	textEnd := matchBracket(line, offset, '[', ']')
+	if textEnd >= 0 && textEnd+1 < len(line) && line[textEnd+1] == '(' {
+		if urlEnd := matchBracket(line, textEnd+1, '(', ')'); urlEnd >= 0 {
+			// 只保留文字, 处理到]时删除](url)
+			marker := ""
+			if offset == 1 {
+				marker = "!"
+			}
+			self.sink.link(strings.TrimSpace(line[textEnd+2:urlEnd]), offset == 1, true)
+			self.skipAt(textEnd, urlEnd+1-textEnd, marker)
+			self.consume(offset + 1)
+			return true
+		}
+	}
+	if !complete && (textEnd < 0 || textEnd+1 >= len(line) || line[textEnd+1] == '(') {
+		return false
+	}
+
+	// 如[1]这样的引用标记原样保留
+	self.emitLiteral(offset + 1)
+
+	return true
+}
+
+// autolink <https://...>形式的链接只保留地址, 其余的HTML标签交给sink处理
+func (self *markdownParser) autolink(final bool) bool {
+	line, complete, _ := self.currentLine(final)
+	end := strings.IndexByte(line, '>')
+	inner := line[1:]
+	if end >= 0 {
+		inner = line[1:end]
+	}
+
+	isLink := !strings.ContainsAny(inner, " \t<")
+	if isLink {
+		isLink = false
+		for _, scheme := range []string{"http://", "https://", "mailto:"} {
+			if strings.HasPrefix(inner, scheme) || (end < 0 && strings.HasPrefix(scheme, inner)) {
+				isLink = true
+			}
+		}
+	}
+	switch {
+	case isLink && end >= 0:
+		self.sink.link(inner, false, true)
+		self.emit(inner)
+		self.sink.link("", false, false)
+		self.consume(end + 1)
+	case isLink && !complete:
+		return false
+	default:
+		size := htmlTag(line, complete)
+		switch {
+		case size < 0:
+			return false
+		case size > 0:
+			self.emitWith(line[:size], self.sink.html)
+			self.consume(size)
+		default:
+			self.emitLiteral(1)
+		}
+	}
+
+	return true
+}
+
+// htmlTag 返回line开头的HTML标签的长度, 不是标签时返回0, 内容不完整且仍可能是标签时返回-1
+func htmlTag(line string, complete bool) int {
+	i := 1
+	if i < len(line) && line[i] == '/' {
+		i++
+	}
+	start := i
+	for i < len(line) && (isLetter(line[i]) || i > start && (line[i] >= '0' && line[i] <= '9' || line[i] == '-')) {
+		i++
+	}
+	switch {
+	case i == len(line) && !complete:
+		return -1
+	case i == start || i < len(line) && !isSpace(line[i]) && line[i] != '/' && line[i] != '>':
+		return 0
+	}
+
+	// 属性值中的>不作为标签的结束
+	var quote byte
+	for ; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '<':
+			return 0
+		case c == '>':
+			return i + 1
+		}
+	}
+	if !complete {
+		return -1
+	}
+
+	return 0
+}
+
+// mathSpan $...$与$$...$$中的公式原样保留, 不处理其中的强调等标记, 如$5与$10这样的金额不作为公式
+func (self *markdownParser) mathSpan(final bool) bool {
+	line, complete, _ := self.currentLine(final)
+	size := runLength(line, 0)
+	if size == len(line) && !complete {
+		return false
+	}
+	if size > 2 || size == len(line) || isSpace(line[size]) {
+		self.emitLiteral(size)
+		return true
+	}
+
+	end, found := findMathCloser(line, size, complete)
+	switch {
+	case !found && !complete:
+		return false
+	case !found:
+		self.emitLiteral(size)
+		return true
+	}
+
+	self.emitWith(line[:end+size], func(value string) {
+		self.sink.math(value, size == 2)
+	})
+	self.consume(end + size)
+
+	return true
+}
+
+// findMathCloser 结束的$前不能是空白, 单个$后面不能紧跟数字
+func findMathCloser(line string, size int, complete bool) (int, bool) {
+	for i := size; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '$':
+			run := runLength(line, i)
+			if i+run == len(line) && !complete {
+				return 0, false
+			}
+			if run == size && !isSpace(line[i-1]) && (size == 2 || i+1 == len(line) || line[i+1] < '0' || line[i+1] > '9') {
+				return i, true
+			}
+			i += run - 1
+		}
+	}
+
+	return 0, false
+}
+
+// emphasis 去除成对的*、_与~~, 单独出现的(如2 * 3)原样保留
+func (self *markdownParser) emphasis(final bool) bool {
+	line, complete, _ := self.currentLine(final)
+	marker := line[0]
+	size := runLength(line, 0)
+	if size == len(line) && !complete {
+		return false
+	}
+
+	opener := size < len(line) && !isSpace(line[size])
+	switch {
+	case marker == '~':
+		opener = opener && size == 2
+	case marker == '_':
+		// snake_case中的_不是强调标记
+		last, _ := utf8.DecodeLastRuneInString(self.prev)
+		opener = opener && size <= 3 && !isWord(last)
+	default:
+		opener = opener && size <= 3
+	}
+	if !opener {
+		self.emitLiteral(size)
+		return true
+	}
+
+	closer, found := self.findCloser(line, size, complete)
+	switch {
+	case !found && !complete:
+		return false
+	case !found:
+		self.emitLiteral(size)
+	default:
+		self.sink.style(line[:size], true)
+		self.skipAt(closer, size, line[:size])
+		self.consume(size)
+	}
+
+	return true
+}
+
+// findCloser 在当前行中查找与开始标记等长的结束标记, 跳过转义符与行内代码
+func (self *markdownParser) findCloser(line string, size int, complete bool) (int, bool) {
+	marker := line[0]
+	for i := size; i < len(line); {
+		switch line[i] {
+		case '\\':
+			i += 2
+		case '`':
+			run := runLength(line, i)
+			end, found := matchRun(line, i+run, run, complete)
+			if !found {
+				if !complete {
+					return 0, false
+				}
+				i += run
+				continue
+			}
+			i = end + run
+		case marker:
+			if skip, ok := self.skips[self.offset+i]; ok {
+				i += skip.size
+				continue
+			}
+			run := runLength(line, i)
+			if i+run == len(line) && !complete {
+				return 0, false
+			}
+			closing := run == size && !isSpace(line[i-1])
+			if marker == '_' && i+run < len(line) {
+				if !utf8.FullRuneInString(line[i+run:]) && !complete {
+					return 0, false
+				}
+				next, _ := utf8.DecodeRuneInString(line[i+run:])
+				closing = closing && !isWord(next)
+			}
+			if closing {
+				return i, true
+			}
+			i += run
+		default:
+			i++
+		}
+	}
+
+	return 0, false
+}
+
+// runLength 从start开始连续相同字符的个数
+func runLength(line string, start int) int {
+	end := start
+	for end < len(line) && line[end] == line[start] {
+		end++
+	}
+
+	return end - start
+}
+
+// matchRun 从start开始查找恰好size个`的位置, 未完整的行中位于末尾的`可能还会变长
+func matchRun(line string, start, size int, complete bool) (int, bool) {
+	for i := start; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+		run := runLength(line, i)
+		if i+run == len(line) && !complete {
+			return 0, false
+		}
+		if run == size {
+			return i, true
+		}
+		i += run
+	}
+
+	return 0, false
+}
+
+// matchBracket 返回与start处的括号配对的位置, 不存在时返回-1
+func matchBracket(line string, start int, open, close byte) int {
+	depth := 0
+	for i := start; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case open:
+			depth++
+		case close:
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func isSpace(c byte) bool {
+	return c == 0 || c == ' ' || c == '\t' || c == '\r'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isWord(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
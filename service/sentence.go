@@ -0,0 +1,11 @@
+package service
+
+import "github.com/soryetong/go-easy-llm/utils"
+
+// SentenceSegmenter 见utils.SentenceSegmenter, 保留在service中以兼容已有代码
+type SentenceSegmenter = utils.SentenceSegmenter
+
+// SplitSentences 见utils.SplitSentences
+func SplitSentences(value string) []string {
+	return utils.SplitSentences(value)
+}
@@ -0,0 +1,504 @@
+package service
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const defaultTerminalWidth = 80
+
+// TerminalRenderer 将markdown逐段渲染为带ANSI样式的终端文本, 已输出的内容不会再重绘
+// 表格需要收到整张表后才能计算列宽, 代码需要整行才能高亮, 其余内容收到即输出
+type TerminalRenderer struct {
+	Width int  // 终端宽度, 用于表格与分隔线
+	Color bool // 为false时按纯文本输出, 如输出被重定向到文件
+
+	parser *markdownParser
+}
+
+// NewTerminalRenderer file不是终端或设置了NO_COLOR时输出纯文本
+// 宽度优先取终端的实际大小, 其次取COLUMNS环境变量, 都没有时为80
+func NewTerminalRenderer(file *os.File) *TerminalRenderer {
+	width := 0
+	if IsTerminal(file) {
+		width = terminalWidth(file)
+	}
+	if width <= 0 {
+		width, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+	}
+
+	return &TerminalRenderer{
+		Width: width,
+		Color: IsTerminal(file) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb",
+	}
+}
+
+// IsTerminal file是否为终端
+func IsTerminal(file *os.File) bool {
+	if file == nil {
+		return false
+	}
+	stat, err := file.Stat()
+
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Do 输入一段内容, 返回可以立即打印的部分
+func (self *TerminalRenderer) Do(value string) string {
+	if self.parser == nil {
+		var sink markdownSink = &plainSink{mode: CodeBlockKeep}
+		if self.Color {
+			width := self.Width
+			if width <= 0 {
+				width = defaultTerminalWidth
+			}
+			sink = &ansiSink{width: width}
+		}
+		self.parser = &markdownParser{sink: sink}
+	}
+
+	return self.parser.write(value)
+}
+
+// Flush 输出剩余的内容并重置状态
+func (self *TerminalRenderer) Flush() string {
+	result := self.Do("") + self.parser.flush()
+	self.parser = nil
+
+	return result
+}
+
+const (
+	ansiReset    = "\x1b[0m"
+	osc8Start    = "\x1b]8;;"
+	osc8Finish   = "\x1b\\"
+	tableBorders = "┌┬┐├┼┤└┴┘"
+)
+
+// ansiStyle 一个生效中的样式, key用于结束时找到对应的样式
+type ansiStyle struct {
+	key  string
+	code string
+}
+
+type ansiSink struct {
+	width       int
+	output      strings.Builder
+	styles      []ansiStyle
+	applied     string // 终端当前的样式
+	pendingLink string // 等待输出的OSC 8链接, 在链接文字前才输出
+	linked      bool   // 已输出OSC 8链接的开始
+
+	bullet string // 列表项的标记, 等确定是否为任务列表后再输出
+
+	table [][]string // 尚未输出的表格
+	inRow bool
+
+	highlighter *codeHighlighter
+	codeLine    strings.Builder
+}
+
+var emphasisCodes = map[string]string{
+	"*": "3", "_": "3", "**": "1", "__": "1", "***": "1;3", "___": "1;3", "~~": "9",
+}
+
+func (self *ansiSink) push(key, code string) {
+	self.styles = append(self.styles, ansiStyle{key: key, code: code})
+}
+
+func (self *ansiSink) pop(key string) {
+	for i := len(self.styles) - 1; i >= 0; i-- {
+		if self.styles[i].key == key {
+			self.styles = append(self.styles[:i], self.styles[i+1:]...)
+			return
+		}
+	}
+}
+
+func (self *ansiSink) wantedStyles() string {
+	codes := make([]string, 0, len(self.styles))
+	for _, style := range self.styles {
+		codes = append(codes, style.code)
+	}
+
+	return strings.Join(codes, ";")
+}
+
+// applyStyles 在输出文字前才切换样式, 避免样式作用到文字前的空白上
+func (self *ansiSink) applyStyles() {
+	wanted := self.wantedStyles()
+	if wanted == self.applied {
+		return
+	}
+
+	if self.applied != "" {
+		self.output.WriteString(ansiReset)
+	}
+	if wanted != "" {
+		self.output.WriteString("\x1b[" + wanted + "m")
+	}
+	self.applied = wanted
+}
+
+func (self *ansiSink) write(value string) {
+	self.flushTable()
+	if self.bullet != "" {
+		self.output.WriteString(self.bullet)
+		self.bullet = ""
+	}
+	// 样式从第一个非空白字符开始, 已结束的样式不作用到其后的空白上
+	text := strings.TrimLeft(value, " \t\n\r\v\f")
+	if len(text) < len(value) {
+		if self.applied != "" && self.applied != self.wantedStyles() {
+			self.output.WriteString(ansiReset)
+			self.applied = ""
+		}
+		self.output.WriteString(value[:len(value)-len(text)])
+	}
+	if text != "" {
+		self.applyStyles()
+		if self.pendingLink != "" {
+			self.output.WriteString(osc8Start + self.pendingLink + osc8Finish)
+			self.pendingLink = ""
+			self.linked = true
+		}
+		self.output.WriteString(text)
+	}
+}
+
+func (self *ansiSink) text(value string) {
+	if self.inRow {
+		self.table[len(self.table)-1][len(self.table[len(self.table)-1])-1] += value
+		return
+	}
+	self.write(value)
+}
+
+func (self *ansiSink) code(value string) {
+	if self.inRow {
+		self.text(value)
+		return
+	}
+	self.push("code", "36")
+	self.write(value)
+	self.pop("code")
+}
+
+func (self *ansiSink) style(marker string, on bool) {
+	if on {
+		self.push(marker, emphasisCodes[marker])
+	} else {
+		self.pop(marker)
+	}
+}
+
+func (self *ansiSink) math(value string, display bool) {
+	self.text(value)
+}
+
+func (self *ansiSink) html(tag string) {
+	self.text(tag)
+}
+
+func (self *ansiSink) link(url string, image, on bool) {
+	if self.inRow {
+		return
+	}
+	self.flushTable()
+	if on {
+		self.push("link", "4;34")
+		self.pendingLink = url
+		return
+	}
+	self.closeLink()
+}
+
+func (self *ansiSink) closeLink() {
+	self.pop("link")
+	self.pendingLink = ""
+	if self.linked {
+		self.output.WriteString(osc8Start + osc8Finish)
+		self.linked = false
+	}
+}
+
+func (self *ansiSink) heading(level int) {
+	switch level {
+	case 1:
+		self.push("heading", "1;4;35")
+	case 2:
+		self.push("heading", "1;35")
+	default:
+		self.push("heading", "1")
+	}
+}
+
+func (self *ansiSink) listItem(indent int) {
+	self.bullet = strings.Repeat("  ", indent/2) + "• "
+}
+
+// orderedItem 有序列表保留原来的序号
+func (self *ansiSink) orderedItem(indent int, number string) bool {
+	return false
+}
+
+func (self *ansiSink) task(done bool) {
+	indent := strings.TrimSuffix(self.bullet, "• ")
+	if done {
+		self.bullet = indent + "☑ "
+	} else {
+		self.bullet = indent + "☐ "
+	}
+}
+
+func (self *ansiSink) quote() {
+	self.push("quote", "2")
+	self.write("│ ")
+	self.pop("quote")
+}
+
+func (self *ansiSink) rule(newline bool) {
+	self.push("rule", "2")
+	self.write(strings.Repeat("─", self.width))
+	self.pop("rule")
+	if newline {
+		self.newline()
+	}
+}
+
+func (self *ansiSink) tableRow() {
+	self.table = append(self.table, []string{""})
+	self.inRow = true
+}
+
+func (self *ansiSink) tableCell() {
+	row := self.table[len(self.table)-1]
+	self.table[len(self.table)-1] = append(row, "")
+}
+
+func (self *ansiSink) codeStart(language string, newline bool) {
+	self.flushTable()
+	self.highlighter = newCodeHighlighter(language)
+	if language != "" {
+		self.push("language", "2")
+		self.write(language)
+		self.pop("language")
+	}
+	if newline && language != "" {
+		self.newline()
+	}
+}
+
+func (self *ansiSink) codeText(value string, newline bool) {
+	self.codeLine.WriteString(value)
+	if newline {
+		self.writeCodeLine()
+		self.output.WriteByte('\n')
+	}
+}
+
+func (self *ansiSink) writeCodeLine() {
+	if self.codeLine.Len() == 0 {
+		return
+	}
+	self.applyStyles()
+	self.output.WriteString(self.highlighter.line(self.codeLine.String()))
+	self.codeLine.Reset()
+}
+
+func (self *ansiSink) codeEnd() {
+	self.writeCodeLine()
+	self.highlighter = nil
+}
+
+func (self *ansiSink) newline() {
+	if self.inRow {
+		// 去掉行尾|产生的空单元格
+		row := self.table[len(self.table)-1]
+		if len(row) > 1 && strings.TrimSpace(row[len(row)-1]) == "" {
+			self.table[len(self.table)-1] = row[:len(row)-1]
+		}
+		self.inRow = false
+		self.styles = self.styles[:0]
+		return
+	}
+
+	self.closeLink()
+	self.styles = self.styles[:0]
+	self.applyStyles()
+	self.write("\n")
+}
+
+func (self *ansiSink) finish() {
+	if self.inRow {
+		self.newline()
+	}
+	if self.highlighter != nil {
+		self.codeEnd()
+	}
+	self.closeLink()
+	self.styles = self.styles[:0]
+	self.flushTable()
+	self.applyStyles()
+}
+
+func (self *ansiSink) take() string {
+	result := self.output.String()
+	self.output.Reset()
+
+	return result
+}
+
+// flushTable 表格结束后按终端宽度输出整张表
+func (self *ansiSink) flushTable() {
+	if self.inRow || len(self.table) == 0 {
+		return
+	}
+
+	rows := self.table
+	self.table = nil
+	self.output.WriteString(renderTable(rows, self.width))
+}
+
+// renderTable 列宽超过终端宽度时收窄最宽的列, 单元格内容自动换行, 第一行作为表头
+func renderTable(rows [][]string, width int) string {
+	columns := 0
+	for i, row := range rows {
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
+		columns = max(columns, len(row))
+		rows[i] = row
+	}
+
+	widths := make([]int, columns)
+	for _, row := range rows {
+		for j, cell := range row {
+			widths[j] = max(widths[j], displayWidth(cell), 1)
+		}
+	}
+	// 每列左右各一个空格加一条竖线
+	available := max(width-3*columns-1, columns)
+	for total := totalWidth(widths); total > available; total-- {
+		widest := 0
+		for j := range widths {
+			if widths[j] > widths[widest] {
+				widest = j
+			}
+		}
+		if widths[widest] == 1 {
+			break
+		}
+		widths[widest]--
+	}
+
+	var builder strings.Builder
+	border := func(left, middle, right string) {
+		builder.WriteString(left)
+		for j, w := range widths {
+			if j > 0 {
+				builder.WriteString(middle)
+			}
+			builder.WriteString(strings.Repeat("─", w+2))
+		}
+		builder.WriteString(right + "\n")
+	}
+	corner := func(i int) string {
+		return string([]rune(tableBorders)[i])
+	}
+
+	border(corner(0), corner(1), corner(2))
+	for i, row := range rows {
+		lines := make([][]string, columns)
+		height := 1
+		for j := range lines {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			lines[j] = wrapText(cell, widths[j])
+			height = max(height, len(lines[j]))
+		}
+
+		for line := 0; line < height; line++ {
+			builder.WriteString("│")
+			for j := range lines {
+				text := ""
+				if line < len(lines[j]) {
+					text = lines[j][line]
+				}
+				padding := strings.Repeat(" ", widths[j]-displayWidth(text))
+				if i == 0 && text != "" {
+					text = "\x1b[1m" + text + "\x1b[22m"
+				}
+				builder.WriteString(" " + text + padding + " │")
+			}
+			builder.WriteString("\n")
+		}
+		if i == 0 && len(rows) > 1 {
+			border(corner(3), corner(4), corner(5))
+		}
+	}
+	border(corner(6), corner(7), corner(8))
+
+	return builder.String()
+}
+
+func totalWidth(values []int) int {
+	total := 0
+	for _, value := range values {
+		total += value
+	}
+
+	return total
+}
+
+// wrapText 按显示宽度切分文字
+func wrapText(value string, width int) []string {
+	var lines []string
+	var line strings.Builder
+	lineWidth := 0
+	for _, r := range value {
+		w := runeWidth(r)
+		if lineWidth+w > width && lineWidth > 0 {
+			lines = append(lines, line.String())
+			line.Reset()
+			lineWidth = 0
+		}
+		line.WriteRune(r)
+		lineWidth += w
+	}
+
+	return append(lines, line.String())
+}
+
+func displayWidth(value string) int {
+	width := 0
+	for _, r := range value {
+		width += runeWidth(r)
+	}
+
+	return width
+}
+
+// wideRanges 终端中占两列的字符, 包括中日韩文字、全角符号与常见的emoji
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x2E80, 0x303E}, {0x3041, 0x33FF}, {0x3400, 0x4DBF}, {0x4E00, 0x9FFF},
+	{0xA000, 0xA4CF}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF}, {0xFE30, 0xFE4F}, {0xFF00, 0xFF60},
+	{0xFFE0, 0xFFE6}, {0x1F300, 0x1F64F}, {0x1F900, 0x1F9FF}, {0x20000, 0x3FFFD},
+}
+
+func runeWidth(r rune) int {
+	if unicode.Is(unicode.Mn, r) || unicode.IsControl(r) {
+		return 0
+	}
+	for _, item := range wideRanges {
+		if r >= item[0] && r <= item[1] {
+			return 2
+		}
+	}
+
+	return 1
+}
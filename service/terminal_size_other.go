@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package service
+
+import "os"
+
+// terminalWidth 当前平台不支持获取终端大小
+func terminalWidth(file *os.File) int {
+	return 0
+}
@@ -0,0 +1,15 @@
+package easyllm
+
+import (
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+)
+
+// NewSpeechClient 根据配置创建语音合成与识别客户端, 目前仅支持通义(DashScope)
+func NewSpeechClient(config *easyai.ClientConfig) (easyai.SpeechClient, error) {
+	if config.Types == easyai.ChatTypeQWen {
+		return &easyai.QWenSpeech{Config: config}, nil
+	}
+
+	return nil, fmt.Errorf("%w: 获取SpeechClient异常, 暂不支持的LLM配置 { %s }", easyai.ErrInvalidRequest, config.Types)
+}
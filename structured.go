@@ -0,0 +1,95 @@
+package easyllm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"github.com/soryetong/go-easy-llm/service"
+	"strings"
+)
+
+const defaultJSONRepairAttempts = 2
+
+// ErrInvalidJSON 修复次数用尽后大模型的回复仍无法解析或不符合Schema
+var ErrInvalidJSON = errors.New("大模型返回的JSON不合法")
+
+// ChatJSON 要求大模型按T的结构返回JSON并解析, 校验失败时带上错误原因重新提问, 最多修复2次
+func ChatJSON[T any](ctx context.Context, client ChatHandler, request *easyai.ChatRequest) (T, error) {
+	return ChatJSONWithRepair[T](ctx, client, request, defaultJSONRepairAttempts)
+}
+
+// ChatJSONWithRepair 同ChatJSON, maxRepairs为校验失败后重新提问的次数
+func ChatJSONWithRepair[T any](ctx context.Context, client ChatHandler, request *easyai.ChatRequest, maxRepairs int) (T, error) {
+	var zero T
+	if request == nil {
+		return zero, fmt.Errorf("%w: request不能为空", easyai.ErrInvalidRequest)
+	}
+
+	schema := SchemaOf[T]()
+	tips := "请只返回符合以下JSON Schema的JSON, 不要包含解释或其他内容:\n" + schema.String()
+	if request.Tips != nil && request.Tips.Content != "" {
+		tips = request.Tips.Content + "\n\n" + tips
+	}
+
+	current := cloneRequest(request)
+	current.Stream = false
+	current.JSONMode = true
+	current.Tips = &easyai.ChatMessage{Role: easyai.IdSystem, Content: tips}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRepairs; attempt++ {
+		resp, _, err := client.NormalChat(ctx, current)
+		if err != nil {
+			return zero, err
+		}
+
+		var result T
+		if lastErr = decodeJSONReply(resp.Content, schema, &result); lastErr == nil {
+			return result, nil
+		}
+
+		// 带上一次的回答与错误原因重新提问
+		repair := *current
+		repair.Message = fmt.Sprintf("%s\n\n你上一次的回答:\n%s\n\n存在以下问题: %s\n请修正后只返回JSON。",
+			request.Message, resp.Content, lastErr)
+		current = &repair
+	}
+
+	return zero, fmt.Errorf("%w: %v", ErrInvalidJSON, lastErr)
+}
+
+// decodeJSONReply 去除代码块标记与多余的说明文字后按Schema校验并解析
+func decodeJSONReply(content string, schema *JSONSchema, result interface{}) error {
+	content = extractJSON(content)
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return fmt.Errorf("不是合法的JSON: %v", err)
+	}
+	if err := schema.Validate(value); err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(content), result)
+}
+
+func extractJSON(content string) string {
+	if code, ok := new(service.MarkdownProcessor).ExtractCodeBlock(content); ok {
+		content = code
+	}
+	content = strings.TrimSpace(content)
+	if json.Valid([]byte(content)) {
+		return content
+	}
+
+	// 截取第一个{或[到最后一个}或]之间的内容
+	start := strings.IndexAny(content, "{[")
+	end := strings.LastIndexAny(content, "}]")
+	if start >= 0 && end > start {
+		return content[start : end+1]
+	}
+
+	return content
+}
@@ -0,0 +1,212 @@
+package unitest
+
+import (
+	"context"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func collectStream(stream <-chan *easyai.ChatResponse, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []string
+	for resp := range stream {
+		chunks = append(chunks, resp.Content)
+	}
+
+	return chunks, nil
+}
+
+func TestCacheMiddlewareNormalChat(t *testing.T) {
+	fake := &fakeChat{name: "qwen"}
+	handler := easyllm.Chain(fake, easyllm.CacheMiddleware(easyllm.NewMemoryCacheStore(10), time.Minute))
+	request := &easyai.ChatRequest{Model: easyai.ChatModelQWenTurbo, Message: "介绍一下你自己,请尽量详细一些"}
+
+	first, _, err := handler.NormalChat(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := handler.NormalChat(context.Background(), request)
+	if err != nil || second.Content != first.Content || fake.calls != 1 {
+		t.Fatalf("second call should hit the cache: %v %d", err, fake.calls)
+	}
+
+	// 命中的结果以分片形式回放
+	chunks, err := collectStream(handler.StreamChat(context.Background(), request))
+	if err != nil || len(chunks) < 2 || strings.Join(chunks, "") != first.Content || fake.calls != 1 {
+		t.Fatalf("unexpected replay: %q %d", chunks, fake.calls)
+	}
+
+	// 参数不同则不命中
+	if _, _, err = handler.NormalChat(context.Background(), &easyai.ChatRequest{Model: "qwen-max", Message: request.Message}); err != nil || fake.calls != 2 {
+		t.Fatalf("different model should miss the cache: %d", fake.calls)
+	}
+}
+
+func TestCacheMiddlewareStreamReplay(t *testing.T) {
+	fake := &fakeChat{name: "qwen"}
+	handler := easyllm.Chain(fake, easyllm.CacheMiddleware(easyllm.NewMemoryCacheStore(10), time.Minute))
+	request := &easyai.ChatRequest{Message: "hi"}
+
+	original, _ := collectStream(handler.StreamChat(context.Background(), request))
+	replayed, _ := collectStream(handler.StreamChat(context.Background(), request))
+	if len(original) == 0 || strings.Join(original, "|") != strings.Join(replayed, "|") || fake.calls != 1 {
+		t.Fatalf("replay should match the original chunks: %q %q %d", original, replayed, fake.calls)
+	}
+
+	resp, _, err := handler.NormalChat(context.Background(), request)
+	if err != nil || resp.Content != strings.Join(original, "") || fake.calls != 1 {
+		t.Fatalf("normal chat should hit the stream cache: %v %v %d", resp, err, fake.calls)
+	}
+}
+
+func TestCacheKeyScope(t *testing.T) {
+	calls := 0
+	store := easyllm.NewMemoryCacheStore(10)
+	newClient := func(types easyai.LLMType, params interface{}) *easyllm.ChatClient {
+		config := easyllm.DefaultConfig("sk-test", types)
+		if types == easyai.ChatTypeHunYuan {
+			config = easyllm.DefaultConfigWithSecret("secret-id", "secret-key", types)
+		}
+		config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			qwenStubHandler()(w, r)
+		})
+		client := easyllm.NewChatClient(config).Use(easyllm.CacheMiddleware(store, time.Minute))
+		if params != nil {
+			client.SetGlobalParams(params)
+		}
+
+		return client
+	}
+
+	// 请求完全相同, 但服务商或全局参数不同的客户端共用存储时不能互相命中
+	request := &easyai.ChatRequest{Model: easyai.ChatModelQWenTurbo, Message: "hi"}
+	clients := []*easyllm.ChatClient{
+		newClient(easyai.ChatTypeQWen, nil),
+		newClient(easyai.ChatTypeQWen, map[string]interface{}{"parameters": map[string]interface{}{"temperature": 0.1}}),
+		newClient(easyai.ChatTypeQWen, map[string]interface{}{"parameters": map[string]interface{}{"temperature": 0.9}}),
+		newClient(easyai.ChatTypeHunYuan, nil),
+	}
+	for _, client := range clients {
+		_, _, _ = client.NormalChat(context.Background(), request)
+	}
+	if calls != len(clients) {
+		t.Fatalf("cache key collided across clients, got %d calls", calls)
+	}
+
+	// 配置相同的客户端仍然命中
+	if _, _, err := newClient(easyai.ChatTypeQWen, nil).NormalChat(context.Background(), request); err != nil || calls != len(clients) {
+		t.Fatalf("same client config should hit the cache: %v %d", err, calls)
+	}
+}
+
+func TestFileCacheStoreReply(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-test", easyai.ChatTypeQWen)
+	calls := 0
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		qwenStubHandler()(w, r)
+	})
+	store, err := easyllm.NewFileCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := easyllm.NewChatClient(config).Use(easyllm.CacheMiddleware(store, time.Minute))
+
+	// 命中文件缓存时原始返回的类型与内容与直接调用一致
+	for i := 0; i < 2; i++ {
+		_, reply, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.(*easyai.QWenResponse).RequestId != "r-200" {
+			t.Fatalf("unexpected reply: %+v", reply)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("second call should hit the file cache, got %d calls", calls)
+	}
+}
+
+// truncatedChat 流式调用只返回一个分片就提前关闭, 模拟内层超时或服务中途出错
+func truncatedChat(calls *int) easyllm.ChatHandler {
+	return easyllm.HandlerFuncs(nil, func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+		*calls++
+		messageChan := make(chan *easyai.ChatResponse)
+		go func() {
+			defer close(messageChan)
+			select {
+			case messageChan <- &easyai.ChatResponse{Role: easyai.IdBot, Content: "回答了一半"}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-ctx.Done():
+			}
+		}()
+
+		return messageChan, nil
+	})
+}
+
+func TestCacheMiddlewareTruncatedStream(t *testing.T) {
+	calls := 0
+	for _, handler := range []easyllm.ChatHandler{
+		easyllm.Chain(truncatedChat(&calls), easyllm.CacheMiddleware(easyllm.NewMemoryCacheStore(10), time.Minute)),
+		easyllm.Chain(truncatedChat(&calls), easyllm.CacheMiddleware(easyllm.NewMemoryCacheStore(10), time.Minute), easyllm.TimeoutMiddleware(5*time.Millisecond)),
+	} {
+		calls = 0
+		for i := 0; i < 2; i++ {
+			if _, err := collectStream(handler.StreamChat(context.Background(), &easyai.ChatRequest{Message: "hi"})); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if calls != 2 {
+			t.Fatalf("truncated stream should not be cached, got %d calls", calls)
+		}
+	}
+}
+
+func TestMemoryCacheStoreLRU(t *testing.T) {
+	ctx := context.Background()
+	store := easyllm.NewMemoryCacheStore(2)
+	for _, key := range []string{"a", "b"} {
+		_ = store.Set(ctx, key, &easyllm.CacheEntry{Response: &easyai.ChatResponse{Content: key}})
+	}
+	_, _ = store.Get(ctx, "a")
+	_ = store.Set(ctx, "c", &easyllm.CacheEntry{Response: &easyai.ChatResponse{Content: "c"}})
+
+	if entry, _ := store.Get(ctx, "b"); entry != nil {
+		t.Fatal("least recently used entry should be evicted")
+	}
+	if entry, _ := store.Get(ctx, "a"); entry == nil || store.Len() != 2 {
+		t.Fatal("recently used entry should be kept")
+	}
+}
+
+func TestFileCacheStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := easyllm.NewFileCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = store.Set(ctx, "fresh", &easyllm.CacheEntry{Response: &easyai.ChatResponse{Content: "ok"}, Chunks: []string{"o", "k"}})
+	_ = store.Set(ctx, "stale", &easyllm.CacheEntry{Response: &easyai.ChatResponse{Content: "old"}, ExpireAt: time.Now().Add(-time.Second)})
+
+	entry, err := store.Get(ctx, "fresh")
+	if err != nil || entry == nil || entry.Response.Content != "ok" || len(entry.Chunks) != 2 {
+		t.Fatalf("unexpected entry: %+v %v", entry, err)
+	}
+	if entry, _ = store.Get(ctx, "stale"); entry != nil {
+		t.Fatal("expired entry should miss")
+	}
+}
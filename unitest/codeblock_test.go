@@ -0,0 +1,86 @@
+package unitest
+
+import (
+	"github.com/soryetong/go-easy-llm/service"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const codeBlockSample = "示例:\n```go title=cmd/main.go\npackage main\n```\n说明\n~~~python\n# 文件: app.py\nprint(\"```\")\n~~~\n```golang\nfmt.Println(1)\n"
+
+func TestExtractCodeBlocks(t *testing.T) {
+	blocks := service.ExtractCodeBlocks(codeBlockSample)
+	if len(blocks) != 3 {
+		t.Fatalf("unexpected blocks: %+v", blocks)
+	}
+
+	first := blocks[0]
+	if first.Language != "go" || first.Filename != "cmd/main.go" || first.Content != "package main" || !first.Closed || first.Line != 2 {
+		t.Fatalf("unexpected first block: %+v", first)
+	}
+	if got := codeBlockSample[first.Start:first.End]; got != "```go title=cmd/main.go\npackage main\n```" {
+		t.Fatalf("unexpected position: %q", got)
+	}
+	if blocks[1].Filename != "app.py" || blocks[1].Content != "# 文件: app.py\nprint(\"```\")" {
+		t.Fatalf("unexpected second block: %+v", blocks[1])
+	}
+	if blocks[2].Closed || blocks[2].End != len(codeBlockSample) || blocks[2].Filename != "" {
+		t.Fatalf("unexpected unclosed block: %+v", blocks[2])
+	}
+
+	if block, ok := service.FirstCodeBlock(blocks, "Go"); !ok || block.Start != first.Start {
+		t.Fatalf("unexpected go block: %+v", block)
+	}
+	if block, ok := service.FirstCodeBlock(blocks[1:], "go"); !ok || block.Language != "golang" {
+		t.Fatalf("golang should match go: %+v", block)
+	}
+	if _, ok := service.FirstCodeBlock(blocks, "rust"); ok {
+		t.Fatal("unexpected rust block")
+	}
+}
+
+func TestCodeBlockExtractorStream(t *testing.T) {
+	extractor := new(service.CodeBlockExtractor)
+	var blocks []service.CodeBlock
+	for i, r := range codeBlockSample {
+		found := extractor.Do(string(r))
+		// 结束标记所在行收到换行后立即返回
+		if len(found) > 0 && codeBlockSample[i] != '\n' {
+			t.Fatalf("block returned before its closing line ended at %d", i)
+		}
+		blocks = append(blocks, found...)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 closed blocks, got %+v", blocks)
+	}
+	blocks = append(blocks, extractor.Flush()...)
+
+	want := service.ExtractCodeBlocks(codeBlockSample)
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Fatalf("block %d differs: %+v, %+v", i, blocks[i], want[i])
+		}
+	}
+}
+
+func TestWriteCodeBlocks(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := service.WriteCodeBlocks(dir, service.ExtractCodeBlocks(codeBlockSample+"```\n\n```main.go\npackage main\n```"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, "cmd", "main.go"))
+	if string(content) != "package main\n" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	_, err = service.WriteCodeBlocks(dir, service.ExtractCodeBlocks("```sh\n# ../evil.sh\nrm -rf /\n```"))
+	if err == nil || !strings.Contains(err.Error(), "evil.sh") {
+		t.Fatalf("expected error for unsafe filename, got %v", err)
+	}
+}
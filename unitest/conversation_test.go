@@ -0,0 +1,273 @@
+package unitest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestConversationSend(t *testing.T) {
+	store := easyllm.NewInMemoryStore()
+	conversation := easyllm.NewConversation(&fakeChat{name: "a"}, store)
+	conversation.System = "你是助手"
+	conversation.Metadata["user"] = "u1"
+
+	for _, message := range []string{"你好", "再见"} {
+		if _, err := conversation.Send(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := conversation.History()
+	if len(history) != 4 || history[0].Role != easyai.IdUser || history[1].Content != "a:你好" || history[3].Content != "a:再见" {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	for _, item := range history {
+		if item.CreateTime == 0 {
+			t.Fatalf("CreateTime not set: %+v", item)
+		}
+	}
+
+	session, err := store.Load(context.Background(), conversation.ID)
+	if err != nil || session == nil {
+		t.Fatalf("session not saved: %v", err)
+	}
+	if session.Version != 2 || len(session.History) != 4 || session.System != "你是助手" || session.Metadata["user"] != "u1" {
+		t.Fatalf("unexpected session: %+v", session)
+	}
+}
+
+func TestConversationStream(t *testing.T) {
+	store := easyllm.NewInMemoryStore()
+	conversation := easyllm.NewConversation(&fakeChat{name: "a"}, store)
+
+	stream, err := conversation.Stream(context.Background(), "你好")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range stream {
+	}
+	if err = conversation.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	history := conversation.History()
+	if len(history) != 2 || history[1].Content != "a:你好" {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+}
+
+func TestConversationStreamTruncated(t *testing.T) {
+	calls := 0
+	store := easyllm.NewInMemoryStore()
+	conversation := easyllm.NewConversation(truncatedChat(&calls), store)
+
+	stream, err := conversation.Stream(context.Background(), "你好")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range stream {
+	}
+	if err = conversation.Err(); !errors.Is(err, easyllm.ErrReplyTruncated) {
+		t.Fatalf("expected ErrReplyTruncated, got %v", err)
+	}
+	if history := conversation.History(); len(history) != 0 {
+		t.Fatalf("truncated reply should not be committed: %+v", history)
+	}
+	if session, _ := store.Load(context.Background(), conversation.ID); session != nil {
+		t.Fatalf("truncated reply should not be saved: %+v", session)
+	}
+}
+
+func TestConversationStreamErrReset(t *testing.T) {
+	calls, truncate := 0, true
+	handler := easyllm.HandlerFuncs(nil, func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+		if truncate {
+			return truncatedChat(&calls).StreamChat(ctx, request)
+		}
+		return (&fakeChat{name: "a"}).StreamChat(ctx, request)
+	})
+	conversation := easyllm.NewConversation(handler, easyllm.NewInMemoryStore())
+
+	for _, want := range []error{easyllm.ErrReplyTruncated, nil} {
+		stream, err := conversation.Stream(context.Background(), "你好")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range stream {
+		}
+		if err = conversation.Err(); !errors.Is(err, want) {
+			t.Fatalf("expected %v, got %v", want, err)
+		}
+		truncate = false
+	}
+}
+
+func TestConversationFileStore(t *testing.T) {
+	store, err := easyllm.NewJSONFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	conversation, err := easyllm.LoadConversation(ctx, &fakeChat{name: "a"}, store, "user/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conversation.Send(ctx, "你好"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新加载后继续对话, 请求中带上之前的历史记录
+	chat := &historyChat{}
+	conversation, err = easyllm.LoadConversation(ctx, chat, store, "user/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conversation.Send(ctx, "再见"); err != nil {
+		t.Fatal(err)
+	}
+	if chat.history != 2 {
+		t.Fatalf("request history = %d, want 2", chat.history)
+	}
+
+	session, err := store.Load(ctx, "user/1")
+	if err != nil || session == nil || session.Version != 2 || len(session.History) != 4 {
+		t.Fatalf("unexpected session: %+v, %v", session, err)
+	}
+
+	if err = store.Delete(ctx, "user/1"); err != nil {
+		t.Fatal(err)
+	}
+	if session, _ = store.Load(ctx, "user/1"); session != nil {
+		t.Fatalf("session not deleted: %+v", session)
+	}
+}
+
+func TestConversationConcurrent(t *testing.T) {
+	store := easyllm.NewInMemoryStore()
+	ctx := context.Background()
+
+	// 同一会话的多个请求同时进行, 每一轮都不能丢失
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		conversation, err := easyllm.LoadConversation(ctx, &fakeChat{name: "a"}, store, "shared")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(message string) {
+			defer wg.Done()
+			if _, err := conversation.Send(ctx, message); err != nil {
+				t.Error(err)
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+
+	session, _ := store.Load(ctx, "shared")
+	if session == nil || len(session.History) != 16 || session.Version != 8 {
+		t.Fatalf("unexpected session: %+v", session)
+	}
+	for i := 0; i < len(session.History); i += 2 {
+		if session.History[i].Role != easyai.IdUser || session.History[i+1].Content != "a:"+session.History[i].Content {
+			t.Fatalf("turns interleaved: %+v", session.History)
+		}
+	}
+}
+
+func TestConversationConflictKeepsSettings(t *testing.T) {
+	store := easyllm.NewInMemoryStore()
+	ctx := context.Background()
+
+	stale, _ := easyllm.LoadConversation(ctx, &fakeChat{name: "a"}, store, "s")
+	other, _ := easyllm.LoadConversation(ctx, &fakeChat{name: "b"}, store, "s")
+	other.System, other.Metadata["user"] = "新的提示词", "u2"
+	if err := other.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 冲突重试时只追加本轮对话, 不覆盖其他请求保存的提示词与自定义信息
+	if _, err := stale.Send(ctx, "你好"); err != nil {
+		t.Fatal(err)
+	}
+	session, _ := store.Load(ctx, "s")
+	if session == nil || session.System != "新的提示词" || session.Metadata["user"] != "u2" || len(session.History) != 2 {
+		t.Fatalf("unexpected session: %+v", session)
+	}
+	if stale.System != "新的提示词" {
+		t.Fatalf("conversation should follow the latest session: %q", stale.System)
+	}
+}
+
+func TestMemoryStoreConflict(t *testing.T) {
+	store := easyllm.NewInMemoryStore()
+	ctx := context.Background()
+
+	if err := store.Save(ctx, &easyllm.Session{ID: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	stale := &easyllm.Session{ID: "s"}
+	if err := store.Save(ctx, stale); !errors.Is(err, easyllm.ErrSessionConflict) {
+		t.Fatalf("err = %v, want ErrSessionConflict", err)
+	}
+}
+
+// historyChat 记录请求中历史记录的条数
+type historyChat struct {
+	history int
+}
+
+func (self *historyChat) NormalChat(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+	self.history = len(request.History)
+
+	return &easyai.ChatResponse{Role: easyai.IdBot, Content: "ok"}, nil, nil
+}
+
+func (self *historyChat) StreamChat(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestQWenMessageOrder(t *testing.T) {
+	var roles []string
+	config := easyllm.DefaultConfigWithCredentials(easyai.NewCredentialPool(easyai.BalanceRoundRobin, &easyai.Credential{Token: "sk-test"}), easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input struct {
+				Messages []*easyai.ChatMessage `json:"messages"`
+			} `json:"input"`
+		}
+		content, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(content, &body)
+		for _, message := range body.Input.Messages {
+			roles = append(roles, string(message.Role)+":"+message.Content)
+		}
+		qwenStubHandler()(w, r)
+	})
+
+	conversation := easyllm.NewConversation(easyllm.NewChatClient(config), nil)
+	conversation.System = "提示"
+	if _, err := conversation.Send(context.Background(), "一"); err != nil {
+		t.Fatal(err)
+	}
+	roles = nil
+	if _, err := conversation.Send(context.Background(), "二"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"system:提示", "user:一", "assistant:sk-test", "user:二"}
+	if len(roles) != len(want) {
+		t.Fatalf("messages = %v, want %v", roles, want)
+	}
+	for i := range want {
+		if roles[i] != want[i] {
+			t.Fatalf("messages = %v, want %v", roles, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package unitest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func qwenStubHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "sk-revoked-key-0000" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":"InvalidApiKey","message":"Invalid API-key provided.","request_id":"r-401"}`))
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, `{"output":{"choices":[{"message":{"role":"assistant","content":"%s"},"finish_reason":"stop"}]},"request_id":"r-200"}`, token)
+	}
+}
+
+func TestCredentialPoolRoundRobin(t *testing.T) {
+	pool := easyai.NewCredentialPool(easyai.BalanceRoundRobin,
+		&easyai.Credential{Token: "sk-first-key-1111"},
+		&easyai.Credential{Token: "sk-second-key-2222"},
+	)
+	config := easyllm.DefaultConfigWithCredentials(pool, easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, qwenStubHandler())
+	client := easyllm.NewChatClient(config)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, stats := range pool.Stats() {
+		if stats.Requests != 5 || stats.InFlight != 0 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+	}
+}
+
+func TestCredentialPoolEviction(t *testing.T) {
+	pool := easyai.NewCredentialPool(easyai.BalanceWeighted,
+		&easyai.Credential{Token: "sk-revoked-key-0000", Weight: 5},
+		&easyai.Credential{Token: "sk-healthy-key-3333", Weight: 1},
+	)
+	config := easyllm.DefaultConfigWithCredentials(pool, easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, qwenStubHandler())
+	client := easyllm.NewChatClient(config)
+
+	// 失效的密钥被剔除后自动换下一个密钥重试, 调用方不会感知到失败
+	for i := 0; i < 6; i++ {
+		resp, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+		if err != nil {
+			t.Fatalf("rotation should be invisible to callers: %v", err)
+		}
+		if resp.Content != "sk-healthy-key-3333" {
+			t.Fatalf("unexpected key used: %s", resp.Content)
+		}
+	}
+
+	stats := pool.Stats()
+	if stats[0].Evictions != 1 || stats[0].EvictedUntil.IsZero() || stats[0].Key != "sk-r****0000" {
+		t.Fatalf("unexpected stats: %+v", stats[0])
+	}
+
+	// 所有密钥都失效时返回最后一个密钥的错误
+	pool = easyai.NewCredentialPool(easyai.BalanceRoundRobin,
+		&easyai.Credential{Token: "sk-revoked-key-0000"},
+		&easyai.Credential{Token: "sk-revoked-key-0000"},
+	)
+	config = easyllm.DefaultConfigWithCredentials(pool, easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, qwenStubHandler())
+	if _, err := easyllm.NewChatClient(config).StreamChat(context.Background(), &easyai.ChatRequest{Message: "hi"}); !errors.Is(err, easyai.ErrAuth) {
+		t.Fatalf("expected ErrAuth, got %v", err)
+	}
+	for _, stats := range pool.Stats() {
+		if stats.Requests != 1 || stats.Evictions != 1 || stats.InFlight != 0 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package unitest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/dataset"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHistory(role easyai.RoleType, content string, createTime int64) *easyai.ChatHistory {
+	return &easyai.ChatHistory{ChatMessage: easyai.ChatMessage{Role: role, Content: content}, CreateTime: createTime}
+}
+
+func TestExporterBuild(t *testing.T) {
+	sessions := []*easyllm.Session{
+		{ID: "a", System: "你是客服", History: []*easyai.ChatHistory{
+			newHistory(easyai.IdBot, "欢迎", 100),
+			newHistory(easyai.IdUser, "你好", 101),
+			newHistory(easyai.IdUser, "在吗", 102),
+			newHistory(easyai.IdBot, "在的", 103),
+			newHistory(easyai.IdUser, "没有回复的问题", 104),
+		}},
+		{ID: "b", System: "你是客服", History: []*easyai.ChatHistory{
+			newHistory(easyai.IdUser, "你好\n\n在吗", 200),
+			newHistory(easyai.IdBot, "在的", 201),
+		}},
+		{ID: "c", History: []*easyai.ChatHistory{newHistory(easyai.IdUser, "只有提问", 300)}},
+	}
+
+	exporter := dataset.NewExporter(dataset.FormatDashScope)
+	result := exporter.Build(sessions)
+	if len(result.Train) != 1 || result.Stats.Duplicates != 1 || result.Stats.Filtered != 1 || result.Stats.Sessions != 3 {
+		t.Fatalf("unexpected stats: %+v", result.Stats)
+	}
+
+	sample := result.Train[0]
+	want := []easyai.ChatMessage{{Role: easyai.IdSystem, Content: "你是客服"}, {Role: easyai.IdUser, Content: "你好\n\n在吗"}, {Role: easyai.IdBot, Content: "在的"}}
+	if fmt.Sprint(sample.Messages) != fmt.Sprint(want) || sample.Turns != 1 {
+		t.Fatalf("unexpected sample: %+v", sample)
+	}
+	if sample.Tokens != sample.PromptTokens+sample.CompletionTokens || sample.CompletionTokens != 2 {
+		t.Fatalf("unexpected tokens: %+v", sample)
+	}
+
+	// 去掉system并只保留时间范围内的消息
+	exporter.Filter = dataset.Filter{Roles: []easyai.RoleType{easyai.IdUser, easyai.IdBot}, Since: time.Unix(200, 0), Until: time.Unix(300, 0)}
+	result = exporter.Build(sessions)
+	if len(result.Train) != 1 || result.Train[0].ID != "b" || result.Train[0].Messages[0].Role != easyai.IdUser {
+		t.Fatalf("unexpected filter result: %+v", result.Train)
+	}
+
+	exporter.Filter = dataset.Filter{MinTurns: 2}
+	if result = exporter.Build(sessions); len(result.Train) != 0 || result.Stats.Filtered != 3 {
+		t.Fatalf("MinTurns not applied: %+v", result.Stats)
+	}
+}
+
+func TestExporterSplit(t *testing.T) {
+	var sessions []*easyllm.Session
+	for i := 0; i < 200; i++ {
+		sessions = append(sessions, &easyllm.Session{ID: fmt.Sprint(i), History: []*easyai.ChatHistory{
+			newHistory(easyai.IdUser, fmt.Sprintf("问题%d", i), 0),
+			newHistory(easyai.IdBot, strings.Repeat("答", i%10+1), 0),
+		}})
+	}
+
+	exporter := dataset.NewExporter(dataset.FormatDashScope)
+	exporter.Validation = 0.2
+	result := exporter.Build(sessions)
+	if result.Stats.Validation < 20 || result.Stats.Validation > 60 || result.Stats.Train+result.Stats.Validation != 200 {
+		t.Fatalf("unexpected split: %+v", result.Stats)
+	}
+	if result.Stats.MinTokens <= 0 || result.Stats.MaxTokens < result.Stats.MinTokens || result.Stats.AvgTokens <= 0 {
+		t.Fatalf("unexpected token stats: %+v", result.Stats)
+	}
+
+	// 多次导出的划分相同
+	again := exporter.Build(sessions)
+	for i := range result.Validation {
+		if again.Validation[i].ID != result.Validation[i].ID {
+			t.Fatal("split is not stable")
+		}
+	}
+}
+
+func TestExporterFormats(t *testing.T) {
+	samples := []*dataset.Sample{{Messages: []easyai.ChatMessage{
+		{Role: easyai.IdSystem, Content: "系统<提示>"},
+		{Role: easyai.IdUser, Content: "问"},
+		{Role: easyai.IdBot, Content: "答"},
+	}}}
+
+	cases := map[dataset.Format]string{
+		dataset.FormatDashScope: `{"messages":[{"role":"system","content":"系统<提示>"},{"role":"user","content":"问"},{"role":"assistant","content":"答"}]}`,
+		dataset.FormatOpenAI:    `{"messages":[{"role":"system","content":"系统<提示>"},{"role":"user","content":"问"},{"role":"assistant","content":"答","weight":1}]}`,
+		dataset.FormatShareGPT:  `{"system":"系统<提示>","conversations":[{"from":"human","value":"问"},{"from":"gpt","value":"答"}]}`,
+	}
+	for format, want := range cases {
+		var buffer bytes.Buffer
+		if err := dataset.Encode(&buffer, format, samples); err != nil {
+			t.Fatal(err)
+		}
+		if buffer.String() != want+"\n" {
+			t.Errorf("%s = %s, want %s", format, buffer.String(), want)
+		}
+	}
+
+	if err := dataset.Encode(&bytes.Buffer{}, "alpaca", samples); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
+
+func TestExporterExport(t *testing.T) {
+	store := easyllm.NewInMemoryStore()
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		conversation := easyllm.NewConversation(&fakeChat{name: "a"}, store)
+		if _, err := conversation.Send(ctx, fmt.Sprint("问题", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessions, err := dataset.LoadSessions(ctx, store)
+	if err != nil || len(sessions) != 20 {
+		t.Fatalf("LoadSessions = %d, %v", len(sessions), err)
+	}
+
+	dir := t.TempDir()
+	exporter := dataset.NewExporter(dataset.FormatShareGPT)
+	exporter.Validation = 0.5
+	result, err := exporter.Export(sessions, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	train, _ := os.ReadFile(filepath.Join(dir, "train.jsonl"))
+	validation, _ := os.ReadFile(filepath.Join(dir, "validation.jsonl"))
+	if bytes.Count(train, []byte("\n")) != result.Stats.Train || bytes.Count(validation, []byte("\n")) != result.Stats.Validation {
+		t.Fatalf("unexpected files: %s %s", train, validation)
+	}
+}
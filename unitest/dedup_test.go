@@ -0,0 +1,123 @@
+package unitest
+
+import (
+	"context"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupMiddlewareNormalChat(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	upstream := easyllm.HandlerFuncs(func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+		calls.Add(1)
+		<-release
+
+		return &easyai.ChatResponse{Role: easyai.IdBot, Content: "answer:" + request.Message}, nil, nil
+	}, nil)
+	handler := easyllm.Chain(upstream, easyllm.DedupMiddleware())
+
+	var wg sync.WaitGroup
+	results := make([]string, 100)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _, err := handler.NormalChat(context.Background(), &easyai.ChatRequest{Message: "viral"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = resp.Content
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single upstream call, got %d", calls.Load())
+	}
+	for _, result := range results {
+		if result != "answer:viral" {
+			t.Fatalf("unexpected result: %s", result)
+		}
+	}
+}
+
+func TestDedupMiddlewareStreamLateJoin(t *testing.T) {
+	var calls atomic.Int32
+	upstream := easyllm.HandlerFuncs(nil, func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+		calls.Add(1)
+		messageChan := make(chan *easyai.ChatResponse)
+		go func() {
+			defer close(messageChan)
+			for _, content := range []string{"一", "二", "三", "四", "五"} {
+				time.Sleep(20 * time.Millisecond)
+				messageChan <- &easyai.ChatResponse{Role: easyai.IdBot, Content: content}
+			}
+		}()
+
+		return messageChan, nil
+	})
+	handler := easyllm.Chain(upstream, easyllm.DedupMiddleware())
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 后加入的调用方同样从第一个分片开始接收
+			time.Sleep(time.Duration(i) * 5 * time.Millisecond)
+			chunks, err := collectStream(handler.StreamChat(context.Background(), &easyai.ChatRequest{Message: "viral"}))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = strings.Join(chunks, "")
+		}()
+	}
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single upstream call, got %d", calls.Load())
+	}
+	for _, result := range results {
+		if result != "一二三四五" {
+			t.Fatalf("unexpected result: %s", result)
+		}
+	}
+}
+
+func TestDedupMiddlewareCancel(t *testing.T) {
+	upstream := easyllm.HandlerFuncs(func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+		select {
+		case <-time.After(time.Second):
+			return &easyai.ChatResponse{Content: "late"}, nil, nil
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}, nil)
+	handler := easyllm.Chain(upstream, easyllm.DedupMiddleware())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := handler.NormalChat(ctx, &easyai.ChatRequest{Message: "hi"}); err == nil {
+		t.Fatal("expected cancellation")
+	}
+
+	// 之前的调用方全部离开后, 新的请求会重新发起调用
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel2()
+	start := time.Now()
+	_, _, _ = handler.NormalChat(ctx2, &easyai.ChatRequest{Message: "hi"})
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("cancelled flight should not be reused")
+	}
+}
@@ -0,0 +1,115 @@
+package unitest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"math"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func newEmbeddingClient(t *testing.T, config *easyai.ClientConfig) easyai.EmbeddingClient {
+	client, err := easyllm.NewEmbeddingClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestEmbeddingClientInvalidConfig(t *testing.T) {
+	for _, config := range []*easyai.ClientConfig{
+		easyllm.DefaultConfig("sk-test", easyai.LLMType("unknown")),
+		easyllm.DefaultConfig("sk-test", easyai.ChatTypeHunYuan),
+	} {
+		if _, err := easyllm.NewEmbeddingClient(config); !errors.Is(err, easyai.ErrInvalidRequest) {
+			t.Fatalf("expected ErrInvalidRequest, got %v", err)
+		}
+	}
+}
+
+func TestQWenEmbeddingBatch(t *testing.T) {
+	var requests atomic.Int32
+	config := easyllm.DefaultConfig("sk-embedding-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var params easyai.QWenEmbeddingParameters
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		if len(params.Input.Texts) > 25 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":"InvalidParameter","message":"batch size is invalid","request_id":"r-400"}`))
+			return
+		}
+
+		// 倒序返回, 向量为未归一化的[长度, 0]
+		var items []string
+		for i := len(params.Input.Texts) - 1; i >= 0; i-- {
+			items = append(items, fmt.Sprintf(`{"text_index":%d,"embedding":[%d,0]}`, i, len(params.Input.Texts[i])))
+		}
+		_, _ = fmt.Fprintf(w, `{"output":{"embeddings":[%s]},"usage":{"total_tokens":%d},"request_id":"r-200"}`,
+			strings.Join(items, ","), len(params.Input.Texts))
+	})
+
+	texts := make([]string, 30)
+	for i := range texts {
+		texts[i] = strings.Repeat("a", i+1)
+	}
+	resp, err := newEmbeddingClient(t, config).Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests.Load() != 2 {
+		t.Fatalf("expected 2 batches, got %d", requests.Load())
+	}
+	if len(resp.Embeddings) != len(texts) || resp.Usage.TotalTokens != 30 || resp.Model != easyai.EmbeddingModelQWenV2 {
+		t.Fatalf("unexpected response: %d %+v %s", len(resp.Embeddings), resp.Usage, resp.Model)
+	}
+	for _, embedding := range resp.Embeddings {
+		if math.Abs(embedding[0]-1) > 1e-9 {
+			t.Fatalf("embedding is not normalized: %v", embedding)
+		}
+	}
+}
+
+func TestQWenEmbeddingError(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-revoked-key-0000", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, qwenStubHandler())
+
+	_, err := newEmbeddingClient(t, config).Embed(context.Background(), []string{"hi"})
+	if !errors.Is(err, easyai.ErrAuth) {
+		t.Fatalf("expected ErrAuth, got %v", err)
+	}
+}
+
+func TestHunYuanEmbedding(t *testing.T) {
+	config := easyllm.DefaultConfigWithSecret("secret-id", "secret-key", easyai.ChatTypeHunYuan)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-TC-Action") != easyai.HunYuanEmbeddingAction ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "TC3-HMAC-SHA256 Credential=secret-id/") {
+			_, _ = w.Write([]byte(`{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"签名错误"},"RequestId":"r-auth"}}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"Response":{"Data":[{"Embedding":[0,2],"Index":1},{"Embedding":[3,4],"Index":0}],` +
+			`"Usage":{"PromptTokens":4,"TotalTokens":4},"RequestId":"r-200"}}`))
+	})
+
+	resp, err := newEmbeddingClient(t, config).Embed(context.Background(), []string{"你好", "世界"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Embeddings[0][0] != 0.6 || resp.Embeddings[0][1] != 0.8 || resp.Embeddings[1][1] != 1 {
+		t.Fatalf("unexpected embeddings: %v", resp.Embeddings)
+	}
+	if resp.Usage.TotalTokens != 4 {
+		t.Fatalf("unexpected usage: %+v", resp.Usage)
+	}
+}
@@ -0,0 +1,139 @@
+package unitest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newEncryptedStore(t *testing.T, store easyllm.MemoryStore) (*easyllm.EncryptedStore, *easyllm.KeyRing) {
+	keys, err := easyllm.NewKeyRing("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := easyllm.NewEncryptedStore(store, keys, bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encrypted, keys
+}
+
+func TestEncryptedStore(t *testing.T) {
+	dir := t.TempDir()
+	files, err := easyllm.NewJSONFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, _ := newEncryptedStore(t, files)
+	ctx := context.Background()
+
+	conversation := easyllm.NewConversation(&fakeChat{name: "a"}, store)
+	conversation.Metadata["phone"] = "13800000000"
+	if _, err = conversation.Send(ctx, "我的身份证号是110101"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 底层存储中只有索引与密文
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != store.Index(conversation.ID)+".json" {
+		t.Fatalf("unexpected files: %v", entries)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	for _, word := range []string{"110101", "13800000000", conversation.ID} {
+		if bytes.Contains(content, []byte(word)) {
+			t.Fatalf("plaintext %q found in %s", word, content)
+		}
+	}
+
+	session, err := store.Load(ctx, conversation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Version != 1 || len(session.History) != 2 || session.History[0].Content != "我的身份证号是110101" ||
+		session.Metadata["phone"] != "13800000000" {
+		t.Fatalf("unexpected session: %+v", session)
+	}
+
+	if session, err = store.Load(ctx, "missing"); err != nil || session != nil {
+		t.Fatalf("missing session = %+v, %v", session, err)
+	}
+
+	if err = store.Save(ctx, &easyllm.Session{ID: conversation.ID}); !errors.Is(err, easyllm.ErrSessionConflict) {
+		t.Fatalf("err = %v, want ErrSessionConflict", err)
+	}
+}
+
+func TestEncryptedStoreRotate(t *testing.T) {
+	memory := easyllm.NewInMemoryStore()
+	store, keys := newEncryptedStore(t, memory)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b"} {
+		session := &easyllm.Session{ID: id, History: []*easyai.ChatHistory{{ChatMessage: easyai.ChatMessage{Role: easyai.IdUser, Content: id}}}}
+		if err := store.Save(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := keys.Add("k2", bytes.Repeat([]byte{2}, 16)); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetPrimary("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Remove("k2"); err == nil {
+		t.Fatal("primary key removed")
+	}
+
+	count, err := store.Rotate(ctx)
+	if err != nil || count != 2 {
+		t.Fatalf("Rotate = %d, %v", count, err)
+	}
+	if count, err = store.Rotate(ctx); err != nil || count != 0 {
+		t.Fatalf("second Rotate = %d, %v", count, err)
+	}
+
+	// 移除旧密钥后仍可读取
+	if err = keys.Remove("k1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		session, err := store.Load(ctx, id)
+		if err != nil || session.History[0].Content != id || session.Version != 2 {
+			t.Fatalf("Load(%q) = %+v, %v", id, session, err)
+		}
+	}
+}
+
+func TestEncryptedStoreTamper(t *testing.T) {
+	memory := easyllm.NewInMemoryStore()
+	store, _ := newEncryptedStore(t, memory)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b"} {
+		if err := store.Save(ctx, &easyllm.Session{ID: id, System: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 将a的密文替换为b的, 解密时需要发现
+	a, _ := memory.Load(ctx, store.Index("a"))
+	b, _ := memory.Load(ctx, store.Index("b"))
+	a.Metadata = b.Metadata
+	if err := memory.Save(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, "a"); err == nil {
+		t.Fatal("swapped ciphertext accepted")
+	}
+
+	if _, err := easyllm.NewKeyRing("k", []byte("short")); err == nil {
+		t.Fatal("invalid key length accepted")
+	}
+}
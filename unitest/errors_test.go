@@ -0,0 +1,113 @@
+package unitest
+
+import (
+	"context"
+	"errors"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"net/http"
+	"testing"
+)
+
+func TestQWenAPIError(t *testing.T) {
+	cases := []struct {
+		status   int
+		body     string
+		category error
+	}{
+		{http.StatusTooManyRequests, `{"code":"Throttling.RateQuota","message":"Requests rate limit exceeded","request_id":"r-1"}`, easyai.ErrRateLimited},
+		{http.StatusUnauthorized, `{"code":"InvalidApiKey","message":"Invalid API-key provided.","request_id":"r-2"}`, easyai.ErrAuth},
+		{http.StatusBadRequest, `{"code":"DataInspectionFailed","message":"Input data may contain inappropriate content.","request_id":"r-3"}`, easyai.ErrContentFiltered},
+		{http.StatusBadRequest, `{"code":"InvalidParameter","message":"Range of input length should be [1, 6000]","request_id":"r-4"}`, easyai.ErrContextLength},
+		{http.StatusBadRequest, `{"code":"InvalidParameter","message":"Temperature should be in [0, 2]","request_id":"r-5"}`, easyai.ErrInvalidRequest},
+	}
+
+	for _, item := range cases {
+		config := easyllm.DefaultConfig("your-token", easyai.ChatTypeQWen)
+		config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(item.status)
+			_, _ = w.Write([]byte(item.body))
+		})
+		client := easyllm.NewChatClient(config)
+
+		_, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+		if !errors.Is(err, item.category) {
+			t.Fatalf("expected %v, got %v", item.category, err)
+		}
+
+		var apiErr *easyai.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != item.status || apiErr.RequestId == "" || apiErr.Provider != easyai.ChatTypeQWen {
+			t.Fatalf("unexpected api error: %+v", apiErr)
+		}
+	}
+}
+
+func TestQWenNonJSONError(t *testing.T) {
+	cases := []struct {
+		status   int
+		body     string
+		category error
+	}{
+		{http.StatusTooManyRequests, "<html><body>429 Too Many Requests</body></html>", easyai.ErrRateLimited},
+		{http.StatusBadGateway, "<html><body>502 Bad Gateway</body></html>", nil},
+	}
+
+	for _, item := range cases {
+		config := easyllm.DefaultConfig("your-token", easyai.ChatTypeQWen)
+		config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(item.status)
+			_, _ = w.Write([]byte(item.body))
+		})
+		client := easyllm.NewChatClient(config)
+
+		for _, stream := range []bool{false, true} {
+			var err error
+			if stream {
+				_, err = client.StreamChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+			} else {
+				_, _, err = client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+			}
+
+			var apiErr *easyai.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != item.status || apiErr.Message != item.body || apiErr.Detail == "" {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if item.category != nil && !errors.Is(err, item.category) {
+				t.Fatalf("expected %v, got %v", item.category, err)
+			}
+			if item.category == nil && !easyai.IsTransient(err) {
+				t.Fatalf("expected transient error, got %v", err)
+			}
+		}
+	}
+}
+
+func TestHunYuanAPIError(t *testing.T) {
+	config := easyllm.DefaultConfigWithSecret("your-secretId", "your-secretKey", easyai.ChatTypeHunYuan)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"The provided credentials could not be validated."},"RequestId":"hy-1"}}`))
+	})
+	client := easyllm.NewChatClient(config)
+
+	_, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+	var apiErr *easyai.APIError
+	if !errors.Is(err, easyai.ErrAuth) || !errors.As(err, &apiErr) || apiErr.Code != "AuthFailure.SignatureFailure" || apiErr.RequestId != "hy-1" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 流式请求失败时返回普通JSON, 需要同步返回错误
+	if _, err = client.StreamChat(context.Background(), &easyai.ChatRequest{Message: "hi"}); !errors.Is(err, easyai.ErrAuth) {
+		t.Fatalf("unexpected stream error: %v", err)
+	}
+}
+
+func TestInvalidRequestError(t *testing.T) {
+	client := easyllm.NewChatClient(easyllm.DefaultConfig("your-token", easyai.ChatTypeQWen))
+
+	_, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{})
+	if !errors.Is(err, easyai.ErrInvalidRequest) || easyai.IsTransient(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
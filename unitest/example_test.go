@@ -0,0 +1,127 @@
+package unitest
+
+import (
+	"context"
+	"encoding/json"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var chatExamples = []*easyai.ChatExample{
+	{Input: "把苹果翻译为英文", Output: "apple"},
+	{Input: "今天天气怎么样", Output: "晴天"},
+	{Input: "把香蕉翻译为英文", Output: "banana"},
+}
+
+func TestSelectExamples(t *testing.T) {
+	if selected := easyai.SelectExamples("把橙子翻译为英文", chatExamples, 0); len(selected) != 3 {
+		t.Fatalf("budget 0 should keep all examples: %v", selected)
+	}
+
+	// 预算只够两个示例时选取最相近的, 并保持原有的顺序
+	selected := easyai.SelectExamples("把橙子翻译为英文", chatExamples, 20)
+	if !reflect.DeepEqual(selected, []*easyai.ChatExample{chatExamples[0], chatExamples[2]}) {
+		t.Fatalf("unexpected selection: %+v", selected)
+	}
+	if selected = easyai.SelectExamples("今天天气", chatExamples, 10); len(selected) != 1 || selected[0] != chatExamples[1] {
+		t.Fatalf("unexpected selection: %+v", selected)
+	}
+}
+
+// captureMessages 记录请求中的消息, 以role:content的形式返回
+func captureMessages(t *testing.T, types easyai.LLMType, request *easyai.ChatRequest) []string {
+	var messages []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input struct {
+				Messages []*easyai.ChatMessage `json:"messages"`
+			} `json:"input"`
+			Messages []*easyai.ChatMessageUpper `json:"Messages"`
+		}
+		content, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(content, &body)
+		for _, message := range body.Input.Messages {
+			messages = append(messages, string(message.Role)+":"+message.Content)
+		}
+		for _, message := range body.Messages {
+			messages = append(messages, string(message.Role)+":"+message.Content)
+		}
+		_, _ = w.Write([]byte(`{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"签名错误"},"RequestId":"r-1"}}`))
+	}
+
+	config := easyllm.DefaultConfig("sk-test", types)
+	if types == easyai.ChatTypeHunYuan {
+		config = easyllm.DefaultConfigWithSecret("secret-id", "secret-key", types)
+	}
+	config.HttpClient = newStubClient(t, handler)
+	_, _, _ = easyllm.NewChatClient(config).NormalChat(context.Background(), request)
+
+	return messages
+}
+
+func TestChatExamples(t *testing.T) {
+	history := []*easyai.ChatHistory{newHistory(easyai.IdUser, "你好", 0), newHistory(easyai.IdBot, "你好!", 0)}
+	request := &easyai.ChatRequest{
+		Message:  "把橙子翻译为英文",
+		Tips:     &easyai.ChatMessage{Role: easyai.IdSystem, Content: "你是翻译"},
+		History:  history,
+		Examples: chatExamples[:1],
+	}
+
+	want := []string{"system:你是翻译", "user:把苹果翻译为英文", "assistant:apple", "user:你好", "assistant:你好!", "user:把橙子翻译为英文"}
+	for _, types := range []easyai.LLMType{easyai.ChatTypeQWen, easyai.ChatTypeHunYuan} {
+		if got := captureMessages(t, types, request); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s messages = %v, want %v", types, got, want)
+		}
+	}
+
+	// 写入系统提示词
+	request.ExampleMode = easyai.ExampleSystem
+	got := captureMessages(t, easyai.ChatTypeQWen, request)
+	if len(got) != 4 || got[0] != "system:你是翻译\n\n参考示例:\n\n输入: 把苹果翻译为英文\n输出: apple" {
+		t.Fatalf("unexpected messages: %v", got)
+	}
+}
+
+func TestChatTipsRole(t *testing.T) {
+	// 通义千问保留调用方指定的提示词角色, 混元的提示词固定为system
+	request := &easyai.ChatRequest{
+		Message: "你好",
+		Tips:    &easyai.ChatMessage{Role: easyai.IdUser, Content: "请用英文回答"},
+	}
+	if got := captureMessages(t, easyai.ChatTypeQWen, request); !reflect.DeepEqual(got, []string{"user:请用英文回答", "user:你好"}) {
+		t.Fatalf("unexpected qwen messages: %v", got)
+	}
+	if got := captureMessages(t, easyai.ChatTypeHunYuan, request); len(got) != 2 || got[0] != "system:请用英文回答" {
+		t.Fatalf("unexpected hunyuan messages: %v", got)
+	}
+
+	request.Examples, request.ExampleMode = chatExamples[:1], easyai.ExampleSystem
+	if got := captureMessages(t, easyai.ChatTypeQWen, request); len(got) != 2 || !strings.HasPrefix(got[0], "user:请用英文回答\n\n参考示例:") {
+		t.Fatalf("unexpected qwen messages: %v", got)
+	}
+}
+
+func TestChatExamplesAlternate(t *testing.T) {
+	// 历史记录以assistant开头时, 混元不允许在其之前插入一问一答, 示例改为写入系统提示词
+	request := &easyai.ChatRequest{
+		Message:  "把橙子翻译为英文",
+		History:  []*easyai.ChatHistory{newHistory(easyai.IdBot, "欢迎使用", 0)},
+		Examples: chatExamples[:1],
+	}
+
+	got := captureMessages(t, easyai.ChatTypeHunYuan, request)
+	if len(got) != 3 || !strings.HasPrefix(got[0], "system:参考示例:") || got[1] != "assistant:欢迎使用" {
+		t.Fatalf("unexpected hunyuan messages: %v", got)
+	}
+
+	got = captureMessages(t, easyai.ChatTypeQWen, request)
+	if len(got) != 4 || got[0] != "user:把苹果翻译为英文" {
+		t.Fatalf("unexpected qwen messages: %v", got)
+	}
+}
@@ -0,0 +1,179 @@
+package unitest
+
+import (
+	"context"
+	"errors"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"testing"
+	"time"
+)
+
+type fakeChat struct {
+	name   string
+	err    error
+	delay  time.Duration
+	calls  int
+	models []string
+}
+
+func (self *fakeChat) SetCustomParams(params interface{}) {}
+
+func (self *fakeChat) NormalChat(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+	self.calls++
+	self.models = append(self.models, request.Model)
+	if self.delay > 0 {
+		select {
+		case <-time.After(self.delay):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	if self.err != nil {
+		return nil, nil, self.err
+	}
+
+	return &easyai.ChatResponse{Role: easyai.IdBot, Content: self.name + ":" + request.Message, Provider: self.name}, nil, nil
+}
+
+func (self *fakeChat) StreamChat(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+	self.calls++
+	self.models = append(self.models, request.Model)
+	if self.err != nil {
+		return nil, self.err
+	}
+
+	messageChan := make(chan *easyai.ChatResponse)
+	go func() {
+		defer close(messageChan)
+		if self.delay > 0 {
+			select {
+			case <-time.After(self.delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+		contents := []string{self.name, ":", request.Message}
+		for i, content := range contents {
+			resp := &easyai.ChatResponse{Role: easyai.IdBot, Content: content}
+			if i == len(contents)-1 {
+				resp.FinishReason = "stop"
+			}
+			select {
+			case messageChan <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messageChan, nil
+}
+
+func TestFallbackNormalChat(t *testing.T) {
+	first := &fakeChat{name: "qwen-max", err: errors.New("503")}
+	second := &fakeChat{name: "hunyuan-pro"}
+	client := easyllm.NewFallbackClient(
+		&easyllm.FallbackHop{Name: "qwen", Client: first},
+		&easyllm.FallbackHop{Name: "hunyuan", Client: second, Model: easyai.ChatModelHunYuanPro},
+	)
+
+	resp, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Model: "qwen-max", Message: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Provider != "hunyuan" || resp.Content != "hunyuan-pro:hi" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if second.models[0] != easyai.ChatModelHunYuanPro {
+		t.Fatalf("model not remapped: %v", second.models)
+	}
+}
+
+func TestFallbackTimeout(t *testing.T) {
+	slow := &fakeChat{name: "slow", delay: 100 * time.Millisecond}
+	fast := &fakeChat{name: "fast"}
+	client := easyllm.NewFallbackClient(
+		&easyllm.FallbackHop{Name: "slow", Client: slow, Timeout: 20 * time.Millisecond},
+		&easyllm.FallbackHop{Name: "fast", Client: fast},
+	)
+
+	resp, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+	if err != nil || resp.Provider != "fast" {
+		t.Fatalf("unexpected result: %+v, %v", resp, err)
+	}
+
+	stream, err := client.StreamChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := ""
+	for chunk := range stream {
+		if chunk.Provider != "fast" {
+			t.Fatalf("unexpected provider: %s", chunk.Provider)
+		}
+		content += chunk.Content
+	}
+	if content != "fast:hi" {
+		t.Fatalf("unexpected content: %s", content)
+	}
+}
+
+func TestFallbackCircuitBreaker(t *testing.T) {
+	broken := &fakeChat{name: "broken", err: errors.New("503")}
+	healthy := &fakeChat{name: "healthy"}
+	client := easyllm.NewFallbackClient(
+		&easyllm.FallbackHop{Name: "broken", Client: broken},
+		&easyllm.FallbackHop{Name: "healthy", Client: healthy},
+	)
+	client.FailureThreshold = 2
+	client.Cooldown = time.Hour
+
+	for i := 0; i < 5; i++ {
+		if _, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if broken.calls != 2 {
+		t.Fatalf("breaker should skip the broken provider after 2 failures, got %d calls", broken.calls)
+	}
+}
+
+func TestFallbackCancelNotCounted(t *testing.T) {
+	slow := &fakeChat{name: "slow", delay: 100 * time.Millisecond}
+	client := easyllm.NewFallbackClient(&easyllm.FallbackHop{Name: "slow", Client: slow})
+	client.FailureThreshold = 2
+	client.Cooldown = time.Hour
+
+	// 调用方多次取消或超时, 服务本身并没有故障
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if _, _, err := client.NormalChat(ctx, &easyai.ChatRequest{Message: "hi"}); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := client.StreamChat(ctx, &easyai.ChatRequest{Message: "hi"}); err == nil {
+			t.Fatal("expected error")
+		}
+		cancel()
+	}
+	if slow.calls != 10 {
+		t.Fatalf("breaker opened by caller cancellations, got %d calls", slow.calls)
+	}
+
+	if _, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"}); err != nil {
+		t.Fatalf("hop should stay closed: %v", err)
+	}
+}
+
+func TestFallbackAllFailed(t *testing.T) {
+	client := easyllm.NewFallbackClient(
+		&easyllm.FallbackHop{Name: "a", Client: &fakeChat{err: errors.New("a down")}},
+		&easyllm.FallbackHop{Name: "b", Client: &fakeChat{err: errors.New("b down")}},
+	)
+
+	_, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	t.Log(err)
+}
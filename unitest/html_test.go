@@ -0,0 +1,154 @@
+package unitest
+
+import (
+	"github.com/soryetong/go-easy-llm/service"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	htmlTagPattern  = regexp.MustCompile(`<(/?)([a-z0-9]+)((?: [a-z]+(?:="[^"<>]*")?)*)>`)
+	htmlAttrPattern = regexp.MustCompile(` ([a-z]+)(?:="([^"]*)")?`)
+	htmlVoidTags    = map[string]bool{"br": true, "wbr": true, "hr": true, "img": true, "input": true}
+	htmlOutputTags  = "p h1 h2 h3 h4 h5 h6 ul ol li blockquote table thead tbody tr th td pre code div span hr img input a " +
+		"b strong i em u s del ins mark sub sup small kbd br wbr"
+	htmlOutputAttrs = "href rel src alt class type checked disabled start"
+)
+
+// checkHTML 检查输出中只有允许的标签与属性, 链接地址安全, 且标签成对出现
+func checkHTML(t *testing.T, value string) {
+	t.Helper()
+	if strings.Count(value, "<") != len(htmlTagPattern.FindAllString(value, -1)) {
+		t.Fatalf("unescaped < in %q", value)
+	}
+
+	var stack []string
+	for _, match := range htmlTagPattern.FindAllStringSubmatch(value, -1) {
+		name := match[2]
+		if !strings.Contains(" "+htmlOutputTags+" ", " "+name+" ") {
+			t.Fatalf("unexpected tag %q in %q", match[0], value)
+		}
+		for _, attr := range htmlAttrPattern.FindAllStringSubmatch(match[3], -1) {
+			if !strings.Contains(" "+htmlOutputAttrs+" ", " "+attr[1]+" ") {
+				t.Fatalf("unexpected attribute %q in %q", attr[0], value)
+			}
+			if scheme, _, found := strings.Cut(attr[2], ":"); (attr[1] == "href" || attr[1] == "src") && found &&
+				!strings.ContainsAny(scheme, "/?#") && scheme != "http" && scheme != "https" && scheme != "mailto" {
+				t.Fatalf("unsafe url %q in %q", attr[0], value)
+			}
+		}
+
+		switch {
+		case htmlVoidTags[name]:
+		case match[1] == "":
+			stack = append(stack, name)
+		case len(stack) == 0 || stack[len(stack)-1] != name:
+			t.Fatalf("unbalanced %q in %q", match[0], value)
+		default:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		t.Fatalf("unclosed %v in %q", stack, value)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"## 标题\n这是**重点**与`code`\n第二行", "<h2>标题</h2>\n<p>这是<strong>重点</strong>与<code>code</code>\n第二行</p>\n"},
+		{"见[文档](https://example.com \"标题\")与![图](a.png)", `<p>见<a href="https://example.com" rel="nofollow noopener noreferrer">文档</a>与<img src="a.png" alt="图"></p>` + "\n"},
+		{"- 一\n  - 二\n- [x] 三\n\n3. 四\n4. 五", "<ul>\n<li>一<ul>\n<li>二</li>\n</ul>\n</li>\n<li><input type=\"checkbox\" checked disabled> 三</li>\n</ul>\n<ol start=\"3\">\n<li>四</li>\n<li>五</li>\n</ol>\n"},
+		{"| 名称 | 价格 |\n|:---|---:|\n| 苹果 | |", "<table>\n<thead>\n<tr><th>名称</th><th>价格</th></tr>\n</thead>\n<tbody>\n<tr><td>苹果</td><td></td></tr>\n</tbody>\n</table>\n"},
+		{"```Go\nif a < b {}\n```", "<pre><code class=\"language-go\">if a &lt; b {}\n</code></pre>\n"},
+		{"> 引用\n>> 嵌套\n\n***", "<blockquote>\n<p>引用</p>\n<blockquote>\n<p>嵌套</p>\n</blockquote>\n</blockquote>\n<hr>\n"},
+		{"公式$a_1*b_2*c$, 价格$5与$10", `<p>公式<span class="math math-inline">$a_1*b_2*c$</span>, 价格$5与$10</p>` + "\n"},
+		{"$$\nx_1 < y\n$$", "<div class=\"math math-display\">$$\nx_1 &lt; y\n$$</div>\n"},
+		{"<b class=\"x\">粗</b>与<i>斜<br/>体", "<p><b>粗</b>与<i>斜<br>体</i></p>\n"},
+	}
+
+	for _, item := range cases {
+		got := service.RenderHTML(item.input)
+		if got != item.want {
+			t.Errorf("RenderHTML(%q) = %q, want %q", item.input, got, item.want)
+		}
+		checkHTML(t, got)
+	}
+}
+
+func TestRenderHTMLSanitize(t *testing.T) {
+	for _, input := range []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"<a href=\"javascript:alert(1)\">x</a>",
+		"[x](javascript:alert(1)) [y](JavaScript:alert(1)) [z](java\tscript:alert(1))",
+		"[x](vbscript:msgbox) [y](data:text/html;base64,PHNjcmlwdD4=) ![z](mailto:a@b.c)",
+		"[x](http://a.com\" onmouseover=\"alert(1))",
+		"![x\" onerror=\"alert(1)](a.png)",
+		"<b onclick=alert(1)>粗</b><svg onload=alert(1)>",
+		"```js\" onmouseover=\"alert(1)\nx\n```",
+		"| <iframe src=x> | `<script>` |\n|---|---|",
+	} {
+		output := service.RenderHTML(input)
+		checkHTML(t, output)
+		// 白名单外的内容只能以转义后的文字出现
+		for _, word := range []string{"<script", "<iframe", "<svg", "<img src=x", "<a href=\"java", "\" onerror=\"", "\" onmouseover=\""} {
+			if strings.Contains(output, word) {
+				t.Errorf("RenderHTML(%q) = %q contains %q", input, output, word)
+			}
+		}
+	}
+
+	if output := service.RenderHTML("[邮件](mailto:a@b.c)"); !strings.Contains(output, `href="mailto:a@b.c"`) {
+		t.Errorf("mailto link should be kept: %q", output)
+	}
+}
+
+func TestHTMLRendererStream(t *testing.T) {
+	want := service.RenderHTML(terminalSample)
+
+	// 逐字输入, 每次输出后拼接ClosingTags都是完整的HTML
+	renderer := new(service.HTMLRenderer)
+	var builder strings.Builder
+	for _, r := range terminalSample {
+		builder.WriteString(renderer.Do(string(r)))
+		checkHTML(t, builder.String()+renderer.ClosingTags())
+	}
+	builder.WriteString(renderer.Flush())
+
+	if builder.String() != want {
+		t.Fatalf("chunked output differs:\n%q\n%q", builder.String(), want)
+	}
+}
+
+func FuzzHTMLRenderer(f *testing.F) {
+	f.Add("# 标题\n- **列表** `代码` [链接](http://a.com)\n| a | b |\n|---|---|\n```go\nx := 1\n```\n结束", []byte{3, 1, 4, 1, 5})
+	f.Add("*a* _b_ <b>c</b> ~~d~~ $x_1$ ![图](p.png) 1. [ ] e\n> f\n>> g\n$$\nh\n$$", []byte{1, 1, 1, 1})
+	f.Add("<i>**a</i>b** [x](javascript:y) <a href=x>", []byte{7, 2})
+
+	f.Fuzz(func(t *testing.T, input string, cuts []byte) {
+		want := service.RenderHTML(input)
+		checkHTML(t, want)
+
+		renderer := new(service.HTMLRenderer)
+		var builder strings.Builder
+		for offset, i := 0, 0; offset < len(input); i++ {
+			end := offset + 1
+			if i < len(cuts) {
+				end = offset + int(cuts[i])%16 + 1
+			}
+			end = min(end, len(input))
+			builder.WriteString(renderer.Do(input[offset:end]))
+			checkHTML(t, builder.String()+renderer.ClosingTags())
+			offset = end
+		}
+		builder.WriteString(renderer.Flush())
+
+		if builder.String() != want {
+			t.Fatalf("chunked %q, whole %q", builder.String(), want)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package unitest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newImageClient(t *testing.T, config *easyai.ClientConfig) easyai.ImageClient {
+	client, err := easyllm.NewImageClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestImageClientInvalidConfig(t *testing.T) {
+	for _, config := range []*easyai.ClientConfig{
+		easyllm.DefaultConfig("sk-test", easyai.LLMType("unknown")),
+		easyllm.DefaultConfig("sk-test", easyai.ChatTypeHunYuan),
+	} {
+		if _, err := easyllm.NewImageClient(config); !errors.Is(err, easyai.ErrInvalidRequest) {
+			t.Fatalf("expected ErrInvalidRequest, got %v", err)
+		}
+	}
+}
+
+func TestQWenImageWait(t *testing.T) {
+	var polls atomic.Int32
+	config := easyllm.DefaultConfig("sk-image-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var params easyai.QWenImageParameters
+			_ = json.NewDecoder(r.Body).Decode(&params)
+			if r.Header.Get("X-DashScope-Async") != "enable" || params.Parameters["size"] != "1024*768" || params.Parameters["n"] != 2.0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"code":"InvalidParameter","message":"bad request","request_id":"r-400"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"output":{"task_id":"task-1","task_status":"PENDING"},"request_id":"r-submit"}`))
+			return
+		}
+
+		if !strings.HasSuffix(r.URL.Path, "/tasks/task-1") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if polls.Add(1) < 3 {
+			_, _ = w.Write([]byte(`{"output":{"task_id":"task-1","task_status":"RUNNING"},"request_id":"r-poll"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"output":{"task_id":"task-1","task_status":"SUCCEEDED",` +
+			`"results":[{"url":"https://example.com/1.png"},{"url":"https://example.com/2.png"}]},"request_id":"r-poll"}`))
+	})
+
+	task, err := newImageClient(t, config).SubmitImage(context.Background(), &easyai.ImageRequest{
+		Prompt: "一只猫", NegativePrompt: "模糊", Size: "1024x768", Count: 2, Style: "<auto>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.PollInterval = 10 * time.Millisecond
+
+	result, err := task.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != easyai.ImageTaskSucceeded || len(result.URLs) != 2 || result.Model != easyai.ImageModelWanXV1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if polls.Load() != 3 {
+		t.Fatalf("expected 3 polls, got %d", polls.Load())
+	}
+}
+
+func TestImageTaskCredential(t *testing.T) {
+	config := easyllm.DefaultConfig("", easyai.ChatTypeQWen)
+	config.Credentials = easyai.NewCredentialPool(easyai.BalanceRoundRobin, &easyai.Credential{Token: "sk-image-key"})
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			_, _ = w.Write([]byte(`{"output":{"task_id":"task-1","task_status":"PENDING"},"request_id":"r-submit"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer sk-image-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"output":{"task_id":"task-1","task_status":"RUNNING"},"request_id":"r-poll"}`))
+	})
+
+	task, err := newImageClient(t, config).SubmitImage(context.Background(), &easyai.ImageRequest{Prompt: "一只猫"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if result, err := task.Query(context.Background()); err != nil || result.Status != easyai.ImageTaskRunning {
+			t.Fatalf("unexpected query result: %+v, %v", result, err)
+		}
+	}
+
+	// 每次查询都使用提交时的密钥并计入统计, 查询结束后归还
+	stats := config.Credentials.Stats()[0]
+	if stats.Requests != 3 || stats.InFlight != 0 {
+		t.Fatalf("unexpected credential stats: %+v", stats)
+	}
+}
+
+func TestHunYuanImageFailed(t *testing.T) {
+	config := easyllm.DefaultConfigWithSecret("secret-id", "secret-key", easyai.ChatTypeHunYuan)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-TC-Action") {
+		case easyai.HunYuanImageSubmitAction:
+			_, _ = w.Write([]byte(`{"Response":{"JobId":"job-1","RequestId":"r-submit"}}`))
+		case easyai.HunYuanImageQueryAction:
+			_, _ = w.Write([]byte(`{"Response":{"JobStatusCode":"4","JobStatusMsg":"处理失败",` +
+				`"JobErrorCode":"OperationDenied.TextIllegalDetected","JobErrorMsg":"文本内容含有违法违规信息","RequestId":"r-query"}}`))
+		}
+	})
+
+	client := newImageClient(t, config)
+	task, err := client.SubmitImage(context.Background(), &easyai.ImageRequest{Prompt: "违规内容"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := task.Query(context.Background())
+	if !errors.Is(err, easyai.ErrContentFiltered) {
+		t.Fatalf("expected ErrContentFiltered, got %v", err)
+	}
+	if result.Status != easyai.ImageTaskFailed || result.TaskId != "job-1" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestGenerateImageCancel(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-image-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"output":{"task_id":"task-1","task_status":"PENDING"},"request_id":"r-200"}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := easyai.GenerateImage(ctx, newImageClient(t, config), &easyai.ImageRequest{Prompt: "一只猫"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package unitest
+
+import (
+	"bytes"
+	"context"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestStructuredLogging(t *testing.T) {
+	logs := new(bytes.Buffer)
+	config := easyllm.DefaultConfig("sk-logging-key-4444", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, qwenStubHandler())
+	config.Logger = slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	config.Debug = true
+	client := easyllm.NewChatClient(config)
+
+	if _, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "介绍一下你自己"}); err != nil {
+		t.Fatal(err)
+	}
+
+	output := logs.String()
+	for _, expected := range []string{
+		`"msg":"llm request completed"`, `"provider":"qwen"`, `"model":"qwen-turbo"`,
+		`"request_id":"r-200"`, `"status":200`, `"latency"`, `"msg":"llm request"`, `max_tokens`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("missing %s in logs: %s", expected, output)
+		}
+	}
+}
+
+func TestStructuredLoggingError(t *testing.T) {
+	logs := new(bytes.Buffer)
+	config := easyllm.DefaultConfig("sk-revoked-key-0000", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, qwenStubHandler())
+	config.Logger = slog.New(slog.NewJSONHandler(logs, nil))
+	client := easyllm.NewChatClient(config)
+
+	if _, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	output := logs.String()
+	if strings.Count(output, "\n") != 1 || !strings.Contains(output, `"level":"ERROR"`) ||
+		!strings.Contains(output, `"status":401`) || !strings.Contains(output, `"request_id":"r-401"`) {
+		t.Fatalf("unexpected logs: %s", output)
+	}
+}
@@ -0,0 +1,102 @@
+package unitest
+
+import (
+	"github.com/soryetong/go-easy-llm/service"
+	"strings"
+	"testing"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"- 第一点\n* 第二点\n1. 第三点", "第一点\n第二点\n1. 第三点"},
+		{"## 标题 \n> 引用的**重点**内容", "标题\n引用的重点内容"},
+		{"使用 `go get` 安装, 变量名为snake_case_name", "使用 go get 安装, 变量名为snake_case_name"},
+		{"查看[文档](https://example.com/a_(b))与![示意图](a.png), 参考[1]", "查看文档与示意图, 参考[1]"},
+		{"*斜体*、__粗体__、~~删除~~、***都有***, 2 * 3 = 6, 1~2天", "斜体、粗体、删除、都有, 2 * 3 = 6, 1~2天"},
+		{"| 名称 | 价格 |\n|:---|---:|\n| 苹果 | 5元 |", "名称 价格\n苹果 5元"},
+		{"- [x] 已完成\n- [ ] 未完成\n---\n结束", "已完成\n未完成\n结束"},
+		{"转义\\*号, 地址<https://example.com>, a < b", "转义*号, 地址https://example.com, a < b"},
+		{"代码:\n```go\nfmt.Println(1)\n```\n完毕", "代码:\n完毕"},
+		{"公式$a_1*b_2*c$不处理, 价格$5与*$10*", "公式$a_1*b_2*c$不处理, 价格$5与$10"},
+	}
+
+	for _, item := range cases {
+		if got := service.StripMarkdown(item.input, service.CodeBlockDrop); got != item.want {
+			t.Errorf("StripMarkdown(%q) = %q, want %q", item.input, got, item.want)
+		}
+	}
+
+	code := "代码:\n```go\nfmt.Println(1)\n```\n完毕"
+	if got := service.StripMarkdown(code, service.CodeBlockKeep); got != "代码:\nfmt.Println(1)\n完毕" {
+		t.Errorf("unexpected kept code block: %q", got)
+	}
+	processor := &service.MarkdownProcessor{CodeBlock: service.CodeBlockPlaceholder, Placeholder: "[代码]"}
+	if got := processor.Do(code) + processor.Flush(); got != "代码:\n[代码]\n完毕" {
+		t.Errorf("unexpected placeholder: %q", got)
+	}
+}
+
+func TestMarkdownProcessorStream(t *testing.T) {
+	processor := new(service.MarkdownProcessor)
+	var outputs []string
+	for _, chunk := range []string{"这是**重", "点**, 见[文", "档](http://a.com)。\n- ", "列表"} {
+		outputs = append(outputs, processor.Do(chunk))
+	}
+	outputs = append(outputs, processor.Flush())
+
+	if outputs[0] != "这是" || outputs[1] != "重点, 见" || strings.Join(outputs, "") != "这是重点, 见文档。\n列表" {
+		t.Fatalf("unexpected outputs: %q", outputs)
+	}
+}
+
+func FuzzMarkdownProcessor(f *testing.F) {
+	f.Add("# 标题\n- **列表** `代码` [链接](http://a.com)\n| a | b |\n|---|---|\n```go\nx := 1\n```\n结束", []byte{3, 1, 4, 1, 5})
+	f.Add("*a* _b_ snake_case ~~c~~ \\* <https://x.y> ![图](p.png) [1]", []byte{1, 1, 1, 1})
+	f.Add("- [ ] 任务\n> 引用 ***强调***\n***\n``a`b``", []byte{7, 2})
+
+	f.Fuzz(func(t *testing.T, input string, cuts []byte) {
+		for _, mode := range []service.CodeBlockMode{service.CodeBlockDrop, service.CodeBlockKeep, service.CodeBlockPlaceholder} {
+			want := service.StripMarkdown(input, mode)
+
+			// 按任意边界切分后逐段输入, 拼接结果应与整体输入一致
+			processor := &service.MarkdownProcessor{CodeBlock: mode}
+			var builder strings.Builder
+			for offset, i := 0, 0; offset < len(input); i++ {
+				size := 1
+				if i < len(cuts) {
+					size = int(cuts[i])%16 + 1
+				}
+				end := min(offset+size, len(input))
+				builder.WriteString(processor.Do(input[offset:end]))
+				offset = end
+			}
+			builder.WriteString(processor.Flush())
+
+			if builder.String() != want {
+				t.Fatalf("mode %d: chunked %q, whole %q", mode, builder.String(), want)
+			}
+		}
+
+		// 终端渲染同样与切分方式无关
+		whole := &service.TerminalRenderer{Width: 40, Color: true}
+		want := whole.Do(input) + whole.Flush()
+		renderer := &service.TerminalRenderer{Width: 40, Color: true}
+		var builder strings.Builder
+		for offset, i := 0, 0; offset < len(input); i++ {
+			end := offset + 1
+			if i < len(cuts) {
+				end = offset + int(cuts[i])%16 + 1
+			}
+			end = min(end, len(input))
+			builder.WriteString(renderer.Do(input[offset:end]))
+			offset = end
+		}
+		builder.WriteString(renderer.Flush())
+		if builder.String() != want {
+			t.Fatalf("terminal: chunked %q, whole %q", builder.String(), want)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package unitest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func traceMiddleware(name string, trace *[]string) easyllm.Middleware {
+	return func(next easyllm.ChatHandler) easyllm.ChatHandler {
+		normal := func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+			*trace = append(*trace, name+":before")
+			resp, reply, err := next.NormalChat(ctx, request)
+			*trace = append(*trace, name+":after")
+
+			return resp, reply, err
+		}
+		stream := func(ctx context.Context, request *easyai.ChatRequest) (<-chan *easyai.ChatResponse, error) {
+			*trace = append(*trace, name+":stream")
+
+			return next.StreamChat(ctx, request)
+		}
+
+		return easyllm.HandlerFuncs(normal, stream)
+	}
+}
+
+// 先注册的中间件位于外层: Use(A, B) => A:before -> B:before -> 大模型 -> B:after -> A:after
+func TestMiddlewareOrder(t *testing.T) {
+	var trace []string
+	handler := easyllm.Chain(&fakeChat{name: "fake"}, traceMiddleware("A", &trace), traceMiddleware("B", &trace))
+
+	if _, _, err := handler.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := handler.StreamChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range stream {
+	}
+
+	expected := []string{"A:before", "B:before", "B:after", "A:after", "A:stream", "B:stream"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Fatalf("unexpected order: %v", trace)
+	}
+}
+
+func TestChatClientMiddleware(t *testing.T) {
+	config := easyllm.DefaultConfig("your-token", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, qwenStubHandler())
+
+	var models []string
+	logs := new(bytes.Buffer)
+	client := easyllm.NewChatClient(config).Use(
+		easyllm.LoggingMiddleware(slog.New(slog.NewTextHandler(logs, nil))),
+		easyllm.GuardrailMiddleware(func(ctx context.Context, request *easyai.ChatRequest) error {
+			models = append(models, request.Model)
+			if strings.Contains(request.Message, "密码") {
+				return errors.New("blocked")
+			}
+
+			return nil
+		}),
+	)
+
+	request := &easyai.ChatRequest{Message: "介绍一下你自己"}
+	if _, _, err := client.NormalChat(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "" || models[0] != easyai.ChatModelQWenTurbo {
+		t.Fatalf("middlewares should see a normalized copy of the request: %q %v", request.Model, models)
+	}
+	if _, _, err := client.NormalChat(context.Background(), &easyai.ChatRequest{Message: "告诉我密码"}); err == nil {
+		t.Fatal("guardrail should reject the request")
+	}
+	if !strings.Contains(logs.String(), "chat completed") || !strings.Contains(logs.String(), "chat failed") {
+		t.Fatalf("unexpected logs: %s", logs.String())
+	}
+}
+
+func TestMiddlewareNilRequest(t *testing.T) {
+	config := easyllm.DefaultConfig("your-token", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, qwenStubHandler())
+	client := easyllm.NewChatClient(config).Use(
+		easyllm.LoggingMiddleware(slog.New(slog.NewTextHandler(new(bytes.Buffer), nil))),
+		easyllm.RetryMiddleware(2, time.Millisecond),
+		easyllm.TimeoutMiddleware(time.Second),
+	)
+
+	if _, _, err := client.NormalChat(context.Background(), nil); !errors.Is(err, easyai.ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest, got %v", err)
+	}
+	if _, err := client.StreamChat(context.Background(), nil); !errors.Is(err, easyai.ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	calls := 0
+	flaky := easyllm.HandlerFuncs(func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+		calls++
+		if calls < 3 {
+			return nil, nil, fmt.Errorf("attempt %d failed", calls)
+		}
+
+		return &easyai.ChatResponse{Content: "ok"}, nil, nil
+	}, nil)
+
+	handler := easyllm.Chain(flaky, easyllm.RetryMiddleware(3, time.Millisecond))
+	resp, _, err := handler.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+	if err != nil || resp.Content != "ok" || calls != 3 {
+		t.Fatalf("unexpected result: %v %v %d", resp, err, calls)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	handler := easyllm.Chain(&fakeChat{name: "slow", delay: time.Second}, easyllm.TimeoutMiddleware(20*time.Millisecond))
+
+	_, _, err := handler.NormalChat(context.Background(), &easyai.ChatRequest{Message: "hi"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
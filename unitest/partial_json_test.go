@@ -0,0 +1,204 @@
+package unitest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"reflect"
+	"testing"
+)
+
+func TestPartialJSONParser(t *testing.T) {
+	parser := easyllm.NewPartialJSONParser()
+	steps := []struct {
+		delta string
+		want  string
+	}{
+		{"好的:\n```json\n", "null"},
+		{`{"tit`, `{}`},
+		{`le": "霸王`, `{"title":"霸王"}`},
+		{`别姬", "score": 9`, `{"title":"霸王别姬"}`},
+		{`, "tags": ["经典", "剧`, `{"score":9,"tags":["经典","剧"],"title":"霸王别姬"}`},
+		{`情"], "hot": tr`, `{"score":9,"tags":["经典","剧情"],"title":"霸王别姬"}`},
+		{"ue, \"note\": \"\\u4e2", `{"hot":true,"note":"","score":9,"tags":["经典","剧情"],"title":"霸王别姬"}`},
+		{"d\\n\"}\n```", `{"hot":true,"note":"中\n","score":9,"tags":["经典","剧情"],"title":"霸王别姬"}`},
+	}
+
+	for i, step := range steps {
+		value, err := parser.Feed(step.delta)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		marshal, _ := json.Marshal(value)
+		if string(marshal) != step.want {
+			t.Fatalf("step %d: got %s, want %s", i, marshal, step.want)
+		}
+	}
+	if !parser.Complete() {
+		t.Fatal("parser should be complete")
+	}
+
+	if _, err := easyllm.NewPartialJSONParser().Feed(`{"a": @`); err == nil {
+		t.Fatal("expected error for invalid json")
+	}
+}
+
+func TestPartialDecoder(t *testing.T) {
+	decoder := easyllm.NewPartialDecoder[movieReview]()
+	review, err := decoder.Feed(`{"title": "活着", "score": "九`)
+	if err != nil || review.Title != "活着" || review.Score != 0 {
+		t.Fatalf("unexpected partial review: %+v %v", review, err)
+	}
+
+	review, err = decoder.Feed(`"}`)
+	if err != nil || review.Title != "活着" || !decoder.Complete() {
+		t.Fatalf("unexpected review: %+v %v", review, err)
+	}
+}
+
+func TestPartialDecoderIncremental(t *testing.T) {
+	decoder := easyllm.NewPartialDecoder[movieReview]()
+	first, _ := decoder.Feed(`{"title": "活着", "tags": ["经`)
+	review, err := decoder.Feed(`典", "剧情"], "score": 9}`)
+	if err != nil || review.Score != 9 || !reflect.DeepEqual(review.Tags, []string{"经典", "剧情"}) {
+		t.Fatalf("unexpected review: %+v %v", review, err)
+	}
+	// 之前返回的结果不受后续片段的影响
+	if !reflect.DeepEqual(first.Tags, []string{"经"}) || first.Score != 0 {
+		t.Fatalf("previous result changed: %+v", first)
+	}
+
+	// 顶层为数组或T为map时同样只解码有变化的部分, 逐段输入的结果与完整解码一致
+	reviews := longReviews(50)
+	array, _ := json.Marshal(reviews)
+	if got := feedPartial(t, easyllm.NewPartialDecoder[[]movieReview](), string(array), 7); !reflect.DeepEqual(got, reviews) {
+		t.Fatalf("got %+v, want %+v", got, reviews)
+	}
+
+	object, _ := json.Marshal(map[string]interface{}{"title": "活着", "tags": []string{"经典"}, "reviews": reviews[:3]})
+	var want map[string]interface{}
+	_ = json.Unmarshal(object, &want)
+	if got := feedPartial(t, easyllm.NewPartialDecoder[map[string]interface{}](), string(object), 5); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func longReviews(count int) []movieReview {
+	reviews := make([]movieReview, count)
+	for i := range reviews {
+		reviews[i] = movieReview{Title: fmt.Sprintf("电影%d \"续\"", i), Score: i % 10, Sentiment: "positive", Tags: []string{"经典", "剧情"}}
+	}
+
+	return reviews
+}
+
+// feedPartial 按固定长度切分后逐段输入, 返回最后的结果
+func feedPartial[T any](t testing.TB, decoder *easyllm.PartialDecoder[T], document string, size int) T {
+	var value T
+	var err error
+	for offset := 0; offset < len(document); offset += size {
+		if value, err = decoder.Feed(document[offset:min(offset+size, len(document))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !decoder.Complete() {
+		t.Fatal("decoder should be complete")
+	}
+
+	return value
+}
+
+func TestStreamJSON(t *testing.T) {
+	stream := make(chan *easyai.ChatResponse)
+	go func() {
+		defer close(stream)
+		for _, delta := range []string{"```json\n", `{"title": "霸`, `王别姬", "tags": ["经典"`, `]}`, "\n```"} {
+			stream <- &easyai.ChatResponse{Role: easyai.IdBot, Content: delta}
+		}
+	}()
+
+	var results []*easyllm.PartialResult[movieReview]
+	for result := range easyllm.StreamJSON[movieReview](context.Background(), stream) {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) != 4 || results[0].Value.Title != "霸" || results[0].Complete {
+		t.Fatalf("unexpected results: %d %+v", len(results), results[0])
+	}
+	last := results[len(results)-1]
+	if !last.Complete || last.Value.Title != "霸王别姬" || len(last.Value.Tags) != 1 {
+		t.Fatalf("unexpected final result: %+v", last)
+	}
+}
+
+func FuzzPartialJSON(f *testing.F) {
+	documents := []string{
+		`{"title":"霸王别姬","score":9.5,"tags":["经典","剧情"],"hot":true,"director":null}`,
+		`[1, -2.5e3, {"a": [true, false, null]}, "中😀\n\"x\""]`,
+		`{"nested": {"deep": {"list": [[], {}, [1, [2, [3]]]]}}, "empty": ""}`,
+	}
+	f.Add(uint8(0), []byte{1, 2, 3})
+	f.Add(uint8(1), []byte{7, 1, 13})
+	f.Add(uint8(2), []byte{0, 0, 255})
+
+	f.Fuzz(func(t *testing.T, index uint8, cuts []byte) {
+		document := documents[int(index)%len(documents)]
+		var want interface{}
+		if err := json.Unmarshal([]byte(document), &want); err != nil {
+			t.Fatal(err)
+		}
+
+		// 按任意边界切分文档后逐段输入
+		parser := easyllm.NewPartialJSONParser()
+		var value interface{}
+		for offset, i := 0, 0; offset < len(document); i++ {
+			size := 1
+			if i < len(cuts) {
+				size = int(cuts[i])%8 + 1
+			}
+			end := min(offset+size, len(document))
+			var err error
+			if value, err = parser.Feed(document[offset:end]); err != nil {
+				t.Fatalf("feed %q: %v", document[:end], err)
+			}
+			if _, err = json.Marshal(value); err != nil {
+				t.Fatalf("partial value should marshal: %v", err)
+			}
+			offset = end
+		}
+
+		if !parser.Complete() || !reflect.DeepEqual(value, want) {
+			t.Fatalf("got %#v, want %#v", value, want)
+		}
+
+		// 任意输入不应panic
+		_, _ = easyllm.NewPartialJSONParser().Feed(string(cuts))
+	})
+}
+
+// 长回复按小片段输入时, 每个片段只解析新的内容, 耗时应与长度成线性关系
+func BenchmarkPartialJSONParser(b *testing.B) {
+	document, _ := json.Marshal(map[string]interface{}{"reviews": longReviews(2000)})
+	b.SetBytes(int64(len(document)))
+	for i := 0; i < b.N; i++ {
+		parser := easyllm.NewPartialJSONParser()
+		for offset := 0; offset < len(document); offset += 8 {
+			if _, err := parser.Feed(string(document[offset:min(offset+8, len(document))])); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkPartialDecoder(b *testing.B) {
+	document, _ := json.Marshal(longReviews(2000))
+	b.SetBytes(int64(len(document)))
+	for i := 0; i < b.N; i++ {
+		feedPartial(b, easyllm.NewPartialDecoder[[]movieReview](), string(document), 8)
+	}
+}
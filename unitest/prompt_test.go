@@ -0,0 +1,137 @@
+package unitest
+
+import (
+	"errors"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"github.com/soryetong/go-easy-llm/prompt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+var promptFiles = fstest.MapFS{
+	"prompts/_tone.tmpl": {Data: []byte(`{{if .formal}}请使用正式的语气。{{else}}语气轻松即可。{{end}}`)},
+	"prompts/translate.tmpl": {Data: []byte(`---
+name: translate
+version: v1
+---
+把下面的内容翻译为英文: {{.text}}
+`)},
+	"prompts/translate_v2.tmpl": {Data: []byte(`---
+name: translate
+version: v2
+description: 支持指定语言与术语
+vars:
+  text: string, required
+  target: string, default=英文
+  formal: bool
+  terms: list
+  count: int, default=1
+---
+[system]
+你是专业的翻译, 将用户输入翻译为{{.target}}。{{template "tone" .}}
+{{- if .terms}}
+术语: {{join .terms "、"}}{{end}}
+
+[example.user]
+你好
+[example.assistant]
+Hello ({{.target}})
+
+[user]
+{{.text}}
+`)},
+	"prompts/sub/v10.tmpl": {Data: []byte("---\nname: translate\nversion: v10\nvars:\n  text: string, required\n---\n{{.text}}")},
+	"prompts/readme.md":    {Data: []byte("不是模板")},
+}
+
+func TestPromptRender(t *testing.T) {
+	registry, err := prompt.LoadFS(promptFiles, "prompts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions := registry.Versions("translate"); !reflect.DeepEqual(versions, []string{"v1", "v2", "v10"}) {
+		t.Fatalf("versions = %v", versions)
+	}
+
+	rendered, err := registry.Render("translate", "v2", map[string]interface{}{
+		"text": "早上好", "formal": "true", "terms": []string{"早安", "晨会"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.System != "你是专业的翻译, 将用户输入翻译为英文。请使用正式的语气。\n术语: 早安、晨会" || rendered.Message != "早上好" {
+		t.Fatalf("unexpected rendered: %+v", rendered)
+	}
+	if !reflect.DeepEqual(rendered.Examples, []prompt.Example{{Input: "你好", Output: "Hello (英文)"}}) {
+		t.Fatalf("unexpected examples: %+v", rendered.Examples)
+	}
+
+	request := rendered.Request()
+	if request.Tips.Role != easyai.IdSystem || request.Message != "早上好" || len(request.History) != 0 ||
+		len(request.Examples) != 1 || request.Examples[0].Output != "Hello (英文)" {
+		t.Fatalf("unexpected request: %+v", request)
+	}
+
+	// 不指定版本时使用最新的版本
+	rendered, err = registry.Render("translate", "", map[string]interface{}{"text": "晚安"})
+	if err != nil || rendered.Version != "v10" || rendered.Message != "晚安" || rendered.System != "" {
+		t.Fatalf("latest = %+v, %v", rendered, err)
+	}
+}
+
+func TestPromptValidate(t *testing.T) {
+	registry, err := prompt.LoadFS(promptFiles, "prompts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = registry.Render("translate", "v2", nil); !errors.Is(err, prompt.ErrMissingVariable) {
+		t.Fatalf("err = %v, want ErrMissingVariable", err)
+	}
+	if _, err = registry.Render("translate", "v2", map[string]interface{}{"text": "a", "count": "多"}); !errors.Is(err, prompt.ErrInvalidVariable) {
+		t.Fatalf("err = %v, want ErrInvalidVariable", err)
+	}
+	// 未声明变量的模板中引用了未传入的变量
+	if _, err = registry.Render("translate", "v1", nil); err == nil {
+		t.Fatal("missing key accepted")
+	}
+	if _, err = registry.Get("translate", "v3"); !errors.Is(err, prompt.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+
+	for _, content := range []string{
+		"---\nvars:\n  a: number\n---\n{{.a}}",
+		"---\nvars:\n  a: int, default=x\n---\n{{.a}}",
+		"---\nauthor: x\n---\n",
+		"[example.user]\n问\n[user]\n{{.a}}",
+		"前言\n[user]\n{{.a}}",
+		"{{.a",
+	} {
+		if err = prompt.NewRegistry().Parse("bad.tmpl", content); err == nil {
+			t.Errorf("Parse(%q) accepted", content)
+		}
+	}
+
+	registry = prompt.NewRegistry()
+	_ = registry.Parse("a.tmpl", "---\nversion: 1\n---\nx")
+	if err = registry.Parse("b.tmpl", "---\nname: a\nversion: 1\n---\ny"); err == nil {
+		t.Fatal("duplicate version accepted")
+	}
+}
+
+func TestPromptLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "summary.tmpl"), []byte("---\nvars:\n  words: int, default=100\n---\n[system]\n用{{.words}}字以内总结\n[user]\n{{.text}}"), 0o644)
+
+	registry, err := prompt.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := registry.Render("summary", "", map[string]interface{}{"text": "正文", "words": 50})
+	if err != nil || rendered.System != "用50字以内总结" || rendered.Message != "正文" {
+		t.Fatalf("unexpected rendered: %+v, %v", rendered, err)
+	}
+}
@@ -56,8 +56,9 @@ func TestQWenStreamChat(t *testing.T) {
 	for content := range resp {
 		t.Log("content: ", content)
 
-		if markdownFilterSrv.Do(content.Content) != "" {
-			t.Log("content.Content", content.Content)
+		if text := markdownFilterSrv.Do(content.Content); text != "" {
+			t.Log("content.Content", text)
 		}
 	}
+	t.Log("content.Content", markdownFilterSrv.Flush())
 }
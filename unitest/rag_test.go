@@ -0,0 +1,116 @@
+package unitest
+
+import (
+	"context"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"github.com/soryetong/go-easy-llm/rag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRAGLoaders(t *testing.T) {
+	md := rag.LoadMarkdown("guide.md", "# 安装指南\n\n- 执行 `go get` 安装\n- 查看[文档](https://example.com)\n\n```go\nfmt.Println(1)\n```\n**注意** snake_case_name 不变")
+	if md.Title != "安装指南" || strings.ContainsAny(md.Content, "#*`[]") || !strings.Contains(md.Content, "snake_case_name") {
+		t.Fatalf("unexpected markdown document: %+v", md)
+	}
+
+	page := rag.LoadHTML("page.html", "<html><head><title>首页 &amp; 介绍</title><style>p{}</style></head>"+
+		"<body><script>alert(1)</script><p>第一段</p><div>第二段&nbsp;内容</div></body></html>")
+	if page.Title != "首页 & 介绍" || page.Content != "第一段\n第二段 内容" {
+		t.Fatalf("unexpected html document: %q %q", page.Title, page.Content)
+	}
+}
+
+func TestRAGChunker(t *testing.T) {
+	doc := rag.LoadText("doc.txt", strings.Repeat("这是一个十个字的句子。", 20))
+	chunks := rag.NewChunker(50, 15).Split(doc)
+
+	if len(chunks) < 4 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.Tokens > 50 || chunk.DocumentId != doc.Id || chunk.Index != i {
+			t.Fatalf("unexpected chunk: %+v", chunk)
+		}
+		// 相邻片段之间有重叠的句子
+		if i > 0 && !strings.HasPrefix(chunk.Content, "这是一个十个字的句子。") {
+			t.Fatalf("chunk should overlap with the previous one: %s", chunk.Content)
+		}
+	}
+}
+
+func TestRAGChunkerLongSentence(t *testing.T) {
+	calls := 0
+	chunker := rag.NewChunker(500, 0)
+	chunker.CountTokens = func(text string) int {
+		calls++
+		return rag.EstimateTokens(text)
+	}
+
+	// 没有标点的长文本按token数硬切, 不能每个字都重新计算一次
+	content := strings.Repeat("字", 20000)
+	chunks := chunker.Split(rag.LoadText("long.txt", content))
+	if len(chunks) != 40 {
+		t.Fatalf("expected 40 chunks, got %d", len(chunks))
+	}
+	var joined strings.Builder
+	for _, chunk := range chunks {
+		if chunk.Tokens != 500 {
+			t.Fatalf("unexpected chunk tokens: %d", chunk.Tokens)
+		}
+		joined.WriteString(chunk.Content)
+	}
+	if joined.String() != content {
+		t.Fatal("chunks should cover the whole content")
+	}
+	if calls > 2000 {
+		t.Fatalf("too many token counts: %d", calls)
+	}
+}
+
+func TestRAGPipeline(t *testing.T) {
+	var prompt *easyai.ChatRequest
+	chat := easyllm.HandlerFuncs(func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+		prompt = request
+		return &easyai.ChatResponse{Role: easyai.IdBot, Content: "Go语言由谷歌开发[1]。它支持并发【1, 9】"}, nil, nil
+	}, nil)
+
+	pipeline := rag.NewPipeline(chat, &bigramEmbedder{})
+	pipeline.Retriever.TopK = 2
+	err := pipeline.Index(context.Background(),
+		rag.LoadText("go.txt", "Go语言是谷歌开发的编程语言。"),
+		rag.LoadText("weather.txt", "今天天气晴朗, 适合出游。"),
+		rag.LoadText("rust.txt", "Rust语言注重内存安全。"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := pipeline.Ask(context.Background(), "Go语言是谁开发的")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt.Message, "[1] 《Go语言是谷歌开发的编程语言。》") || prompt.Tips == nil {
+		t.Fatalf("unexpected prompt: %s", prompt.Message)
+	}
+	if len(answer.Citations) != 1 || answer.Citations[0].Chunk.Source != "go.txt" {
+		t.Fatalf("unexpected citations: %+v", answer.Citations)
+	}
+
+	// 持久化后重新加载
+	path := filepath.Join(t.TempDir(), "store.json")
+	store := pipeline.Store.(*rag.MemoryVectorStore)
+	if err = store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := rag.NewMemoryVectorStore(&bigramEmbedder{})
+	if err = loaded.Load(path); err != nil || loaded.Len() != 3 {
+		t.Fatalf("failed to load store: %v %d", err, loaded.Len())
+	}
+	results, err := loaded.Search(context.Background(), "Rust内存安全", 1)
+	if err != nil || results[0].Chunk.Source != "rust.txt" {
+		t.Fatalf("unexpected search result: %v %+v", err, results)
+	}
+}
@@ -0,0 +1,70 @@
+package unitest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"net/http"
+	"testing"
+)
+
+func TestRerankClientInvalidConfig(t *testing.T) {
+	config := easyllm.DefaultConfigWithSecret("secret-id", "secret-key", easyai.ChatTypeHunYuan)
+	if _, err := easyllm.NewRerankClient(config); !errors.Is(err, easyai.ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestQWenRerank(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-rerank-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var params easyai.QWenRerankParameters
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		if params.Model != easyai.RerankModelGte || params.Input.Query != "什么是文本排序" || params.Parameters["top_n"] != 2.0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":"InvalidParameter","message":"bad request","request_id":"r-400"}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"output":{"results":[{"index":2,"relevance_score":0.93},{"index":0,"relevance_score":0.34}]},` +
+			`"usage":{"total_tokens":79},"request_id":"r-200"}`))
+	})
+
+	documents := []string{"文本排序模型广泛用于搜索引擎", "量子计算是计算科学的一个前沿领域", "文本排序是对文档按相关性排序"}
+	reranker, err := easyllm.NewRerankClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := reranker.Rerank(context.Background(), "什么是文本排序", documents, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Results) != 2 || resp.Results[0].Index != 2 || resp.Results[0].Document != documents[2] || resp.Results[1].Index != 0 {
+		t.Fatalf("unexpected results: %+v", resp.Results)
+	}
+	if resp.Usage.TotalTokens != 79 {
+		t.Fatalf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestEmbeddingReranker(t *testing.T) {
+	reranker := &easyai.EmbeddingReranker{Embedder: &bigramEmbedder{}}
+	documents := []string{"今天天气不错", "如何学习Go语言", "Go语言入门教程"}
+
+	resp, err := reranker.Rerank(context.Background(), "Go语言教程", documents, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Results) != 3 || resp.Results[0].Index != 2 || resp.Results[2].Index != 0 {
+		t.Fatalf("unexpected order: %+v %+v %+v", resp.Results[0], resp.Results[1], resp.Results[2])
+	}
+	for i := 1; i < len(resp.Results); i++ {
+		if resp.Results[i].Score > resp.Results[i-1].Score {
+			t.Fatal("results should be sorted by score")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package unitest
+
+import (
+	"context"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"hash/fnv"
+	"net/http"
+	"testing"
+)
+
+// bigramEmbedder 按字及相邻两字做哈希分桶的简易向量化, 仅用于测试
+type bigramEmbedder struct {
+	calls int
+}
+
+func (self *bigramEmbedder) Embed(ctx context.Context, texts []string) (*easyai.EmbeddingResponse, error) {
+	self.calls++
+	resp := &easyai.EmbeddingResponse{Model: "bigram", Usage: &easyai.EmbeddingUsage{}}
+	for _, text := range texts {
+		vector := make([]float64, 256)
+		runes := []rune(text)
+		for i := range runes {
+			for _, gram := range []string{string(runes[i]), string(runes[i:min(i+2, len(runes))])} {
+				hash := fnv.New32a()
+				_, _ = hash.Write([]byte(gram))
+				vector[hash.Sum32()%256]++
+			}
+		}
+		resp.Embeddings = append(resp.Embeddings, vector)
+		resp.Usage.TotalTokens += int64(len(runes))
+	}
+
+	return resp, nil
+}
+
+func TestSemanticCache(t *testing.T) {
+	fake := &fakeChat{name: "qwen"}
+	cache := easyllm.NewSemanticCache(&bigramEmbedder{})
+	cache.Threshold = 0.75
+	handler := easyllm.Chain(fake, easyllm.SemanticCacheMiddleware(cache))
+
+	first, _, err := handler.NormalChat(context.Background(), &easyai.ChatRequest{Model: easyai.ChatModelQWenTurbo, Message: "介绍一下你自己"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 相近的问题命中缓存
+	resp, _, err := handler.NormalChat(context.Background(), &easyai.ChatRequest{Model: easyai.ChatModelQWenTurbo, Message: "请介绍一下自己"})
+	if err != nil || resp.Content != first.Content || fake.calls != 1 {
+		t.Fatalf("similar question should hit the cache: %v %v %d", resp, err, fake.calls)
+	}
+
+	// 无关的问题、其他模型、带历史记录的请求均不命中
+	requests := []*easyai.ChatRequest{
+		{Model: easyai.ChatModelQWenTurbo, Message: "今天天气怎么样"},
+		{Model: "qwen-max", Message: "介绍一下你自己"},
+		{Model: easyai.ChatModelQWenTurbo, Message: "介绍一下你自己", History: []*easyai.ChatHistory{{ChatMessage: easyai.ChatMessage{Role: easyai.IdUser, Content: "你好"}}}},
+	}
+	for i, request := range requests {
+		if _, _, err = handler.NormalChat(context.Background(), request); err != nil || fake.calls != i+2 {
+			t.Fatalf("request %d should miss the cache: %d", i, fake.calls)
+		}
+	}
+
+	// 流式回放
+	chunks, err := collectStream(handler.StreamChat(context.Background(), &easyai.ChatRequest{Model: easyai.ChatModelQWenTurbo, Message: "请介绍一下你自己"}))
+	if err != nil || len(chunks) == 0 || fake.calls != 4 {
+		t.Fatalf("stream should replay the cached answer: %q %d", chunks, fake.calls)
+	}
+}
+
+func TestSemanticCacheEviction(t *testing.T) {
+	cache := easyllm.NewSemanticCache(&bigramEmbedder{})
+	cache.Capacity = 2
+	ctx := context.Background()
+	for _, message := range []string{"第一个问题", "第二个问题", "第三个问题"} {
+		request := &easyai.ChatRequest{Model: easyai.ChatModelQWenTurbo, Message: message}
+		if err := cache.Store(ctx, request, nil, &easyllm.CacheEntry{Response: &easyai.ChatResponse{Content: message}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := &easyai.ChatRequest{Model: easyai.ChatModelQWenTurbo, Message: "第一个问题"}
+	if entry, _, _ := cache.Lookup(ctx, request); entry != nil || cache.Len(ctx, request) != 2 {
+		t.Fatal("oldest entry should be evicted")
+	}
+}
+
+func TestSemanticCacheScope(t *testing.T) {
+	calls := 0
+	cache := easyllm.NewSemanticCache(&bigramEmbedder{})
+	newClient := func(params interface{}) *easyllm.ChatClient {
+		config := easyllm.DefaultConfig("sk-test", easyai.ChatTypeQWen)
+		config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			qwenStubHandler()(w, r)
+		})
+		client := easyllm.NewChatClient(config).Use(easyllm.SemanticCacheMiddleware(cache))
+		if params != nil {
+			client.SetGlobalParams(params)
+		}
+
+		return client
+	}
+
+	// 全局参数不同的客户端共用语义缓存时互不命中, JSON模式的请求也不命中普通的回答
+	first, second := newClient(nil), newClient(map[string]interface{}{"parameters": map[string]interface{}{"temperature": 0.1}})
+	for _, call := range []func() error{
+		func() error {
+			_, _, err := first.NormalChat(context.Background(), &easyai.ChatRequest{Message: "介绍一下你自己"})
+			return err
+		},
+		func() error {
+			_, _, err := second.NormalChat(context.Background(), &easyai.ChatRequest{Message: "介绍一下你自己"})
+			return err
+		},
+		func() error {
+			_, _, err := first.NormalChat(context.Background(), &easyai.ChatRequest{Message: "介绍一下你自己", JSONMode: true})
+			return err
+		},
+	} {
+		if err := call(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("semantic cache leaked across scopes, got %d calls", calls)
+	}
+
+	if _, _, err := first.NormalChat(context.Background(), &easyai.ChatRequest{Message: "介绍一下你自己"}); err != nil || calls != 3 {
+		t.Fatalf("same scope should hit the cache: %v %d", err, calls)
+	}
+}
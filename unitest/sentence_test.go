@@ -0,0 +1,79 @@
+package unitest
+
+import (
+	"github.com/soryetong/go-easy-llm/utils"
+	"strings"
+	"testing"
+)
+
+const sentenceSample = "今天天气很好。我们去公园吧！价格是3.14元；还有……他说：“好的。”然后走了。\n" +
+	"Mr. Smith paid $3.50 at example.com/a.html today! Really? Yes, e.g. apples.\n1. First item\n" +
+	"代码如下:\n```go\nfmt.Println(\"a. b\")\n```\n运行即可"
+
+func TestSentenceSegmenter(t *testing.T) {
+	want := []string{
+		"今天天气很好。", "我们去公园吧！", "价格是3.14元；", "还有……", "他说：“好的。”", "然后走了。",
+		"Mr. Smith paid $3.50 at example.com/a.html today!", "Really?", "Yes, e.g. apples.", "1. First item",
+		"代码如下:", "运行即可",
+	}
+	segmenter := &utils.SentenceSegmenter{SkipCode: true}
+	got := append(segmenter.Do(sentenceSample), segmenter.Flush()...)
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected sentences:\n%q", got)
+	}
+
+	// 不跳过代码块时代码同样按行切分
+	if got := utils.SplitSentences("示例:\n```\nx := 1\n```"); strings.Join(got, "|") != "示例:|```|x := 1|```" {
+		t.Fatalf("unexpected sentences: %q", got)
+	}
+}
+
+func TestSentenceSegmenterNumero(t *testing.T) {
+	for value, want := range map[string]string{
+		"The answer is no. We leave now.": "The answer is no.|We leave now.",
+		"Say No. We leave now.":           "Say No.|We leave now.",
+		"See No. 5 for details. Thanks.":  "See No. 5 for details.|Thanks.",
+	} {
+		if got := utils.SplitSentences(value); strings.Join(got, "|") != want {
+			t.Errorf("SplitSentences(%q) = %q", value, got)
+		}
+
+		// 逐字输入时同样需要等到其后的内容才能判断
+		segmenter := new(utils.SentenceSegmenter)
+		var got []string
+		for _, r := range value {
+			got = append(got, segmenter.Do(string(r))...)
+		}
+		if got = append(got, segmenter.Flush()...); strings.Join(got, "|") != want {
+			t.Errorf("chunked %q = %q", value, got)
+		}
+	}
+}
+
+func TestSentenceSegmenterMaxLength(t *testing.T) {
+	segmenter := &utils.SentenceSegmenter{MaxLength: 10}
+	got := append(segmenter.Do("这是一段，非常非常长的没有句号的句子"), segmenter.Flush()...)
+	if strings.Join(got, "|") != "这是一段，|非常非常长的没有句号|的句子" {
+		t.Fatalf("unexpected sentences: %q", got)
+	}
+}
+
+func TestSentenceSegmenterStream(t *testing.T) {
+	whole := &utils.SentenceSegmenter{SkipCode: true, MaxLength: 20}
+	want := append(whole.Do(sentenceSample), whole.Flush()...)
+
+	// 逐字输入的结果与整体输入一致, 句子收到结束标点后的内容即输出
+	segmenter := &utils.SentenceSegmenter{SkipCode: true, MaxLength: 20}
+	var got []string
+	for _, r := range sentenceSample {
+		got = append(got, segmenter.Do(string(r))...)
+		if len(got) == 1 && got[0] != want[0] {
+			t.Fatalf("unexpected first sentence: %q", got[0])
+		}
+	}
+	got = append(got, segmenter.Flush()...)
+
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("chunked sentences differ:\n%q\n%q", got, want)
+	}
+}
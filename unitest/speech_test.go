@@ -0,0 +1,212 @@
+package unitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newSpeechClient(t *testing.T, config *easyai.ClientConfig) easyai.SpeechClient {
+	client, err := easyllm.NewSpeechClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestSpeechClientInvalidConfig(t *testing.T) {
+	config := easyllm.DefaultConfigWithSecret("secret-id", "secret-key", easyai.ChatTypeHunYuan)
+	if _, err := easyllm.NewSpeechClient(config); !errors.Is(err, easyai.ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+// dashScopeSpeechStub 模拟DashScope语音接口: 合成时把每句文本作为音频帧返回, 识别时返回收到的音频字节数
+func dashScopeSpeechStub(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer sk-revoked-key-0000" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":"InvalidApiKey","message":"Invalid API-key provided.","request_id":"r-401"}`))
+			return
+		}
+
+		conn, err := acceptWebSocket(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.conn.Close()
+
+		event := func(taskId, name string, output interface{}) {
+			message, _ := json.Marshal(map[string]interface{}{
+				"header":  map[string]string{"task_id": taskId, "event": name},
+				"payload": map[string]interface{}{"output": output},
+			})
+			_ = conn.write(0x1, message)
+		}
+
+		var taskId, task string
+		var received int
+		for {
+			opcode, payload, err := conn.read()
+			if err != nil || opcode == 0x8 {
+				return
+			}
+			if opcode == 0x2 {
+				received += len(payload)
+				continue
+			}
+
+			var message easyai.QWenTaskMessage
+			_ = json.Unmarshal(payload, &message)
+			switch message.Header.Action {
+			case "run-task":
+				taskId, task = message.Header.TaskId, message.Payload.Task
+				if text, ok := message.Payload.Input["text"].(string); ok {
+					// sambert: 文本随run-task一起发送
+					_ = conn.write(0x2, []byte("audio:"+text))
+					event(taskId, "task-finished", nil)
+					continue
+				}
+				event(taskId, "task-started", nil)
+			case "continue-task":
+				_ = conn.write(0x2, []byte("audio:"+message.Payload.Input["text"].(string)))
+			case "finish-task":
+				if task == "asr" {
+					event(taskId, "result-generated", map[string]interface{}{
+						"sentence": map[string]interface{}{"begin_time": 0, "end_time": 1000,
+							"text": fmt.Sprintf("收到%d字节", received), "sentence_end": true},
+					})
+				}
+				event(taskId, "task-finished", nil)
+			}
+		}
+	}
+}
+
+func TestQWenSynthesizeStream(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-speech-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, dashScopeSpeechStub(t))
+
+	stream := make(chan *easyai.ChatResponse)
+	go func() {
+		defer close(stream)
+		for _, content := range []string{"你好，", "世界。今天", "天气不错"} {
+			stream <- &easyai.ChatResponse{Role: easyai.IdBot, Content: content}
+		}
+	}()
+
+	audio, err := newSpeechClient(t, config).SynthesizeStream(context.Background(), &easyai.SpeechRequest{}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audio.Close()
+
+	data, err := io.ReadAll(audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "audio:你好，世界。audio:今天天气不错" {
+		t.Fatalf("unexpected audio: %s", data)
+	}
+}
+
+func TestQWenSynthesizeSambert(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-speech-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, dashScopeSpeechStub(t))
+
+	audio, err := newSpeechClient(t, config).Synthesize(context.Background(), &easyai.SpeechRequest{
+		Model: easyai.SpeechModelSambertZhiChuV1,
+		Text:  "欢迎使用",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(audio)
+	if err != nil || string(data) != "audio:欢迎使用" {
+		t.Fatalf("unexpected audio: %s, %v", data, err)
+	}
+}
+
+func TestQWenRecognize(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-speech-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, dashScopeSpeechStub(t))
+
+	result, err := newSpeechClient(t, config).Recognize(context.Background(), nil, bytes.NewReader(make([]byte, 10000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != "收到10000字节" || len(result.Sentences) != 1 || result.Sentences[0].EndTime != 1000 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+// endlessAudio 模拟不会结束的实时音频源, 暂时没有新的音频时返回0字节
+type endlessAudio struct {
+	reads atomic.Int64
+}
+
+func (self *endlessAudio) Read(p []byte) (int, error) {
+	self.reads.Add(1)
+	time.Sleep(time.Millisecond)
+
+	return 0, nil
+}
+
+func TestQWenRecognizeCancel(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-speech-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, dashScopeSpeechStub(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	audio := new(endlessAudio)
+	if _, err := newSpeechClient(t, config).Recognize(ctx, nil, audio); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// 取消后不再读取音频
+	time.Sleep(20 * time.Millisecond)
+	reads := audio.reads.Load()
+	time.Sleep(50 * time.Millisecond)
+	if audio.reads.Load() != reads {
+		t.Fatal("audio is still being read after cancel")
+	}
+}
+
+func TestQWenSpeechAuthError(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-revoked-key-0000", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, dashScopeSpeechStub(t))
+
+	_, err := newSpeechClient(t, config).Synthesize(context.Background(), &easyai.SpeechRequest{Text: "你好"})
+	if !errors.Is(err, easyai.ErrAuth) {
+		t.Fatalf("expected ErrAuth, got %v", err)
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	stream := make(chan *easyai.ChatResponse, 3)
+	stream <- &easyai.ChatResponse{Content: "第一句。第二"}
+	stream <- &easyai.ChatResponse{Content: "句！"}
+	stream <- &easyai.ChatResponse{Content: "未完"}
+	close(stream)
+
+	var sentences []string
+	for sentence := range easyai.SplitSentences(context.Background(), stream) {
+		sentences = append(sentences, sentence)
+	}
+	if strings.Join(sentences, "|") != "第一句。|第二句！|未完" {
+		t.Fatalf("unexpected sentences: %v", sentences)
+	}
+}
@@ -0,0 +1,98 @@
+package unitest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	easyllm "github.com/soryetong/go-easy-llm"
+	"github.com/soryetong/go-easy-llm/easyai"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type movieReview struct {
+	Title     string   `json:"title" desc:"电影名称"`
+	Score     int      `json:"score" desc:"1到10分"`
+	Sentiment string   `json:"sentiment" enum:"positive|negative|neutral"`
+	Tags      []string `json:"tags,omitempty"`
+	Director  *string  `json:"director"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema := easyllm.SchemaOf[movieReview]()
+	if schema.Type != "object" || strings.Join(schema.Required, ",") != "score,sentiment,title" {
+		t.Fatalf("unexpected schema: %s", schema)
+	}
+	if schema.Properties["tags"].Items.Type != "string" || schema.Properties["score"].Type != "integer" ||
+		len(schema.Properties["sentiment"].Enum) != 3 || !schema.Properties["director"].Nullable {
+		t.Fatalf("unexpected properties: %s", schema)
+	}
+
+	var value interface{}
+	_ = json.Unmarshal([]byte(`{"title":"霸王别姬","score":9.5,"sentiment":"great"}`), &value)
+	err := schema.Validate(value)
+	if err == nil || !strings.Contains(err.Error(), "$.score") || !strings.Contains(err.Error(), "$.sentiment") {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+}
+
+func TestChatJSONRepair(t *testing.T) {
+	var requests []*easyai.ChatRequest
+	replies := []string{
+		"好的, 结果如下:\n```json\n{\"title\":\"霸王别姬\",\"score\":\"九分\",\"sentiment\":\"positive\"}\n```",
+		"```json\n{\"title\":\"霸王别姬\",\"score\":9,\"sentiment\":\"positive\",\"tags\":[\"经典\"]}\n```",
+	}
+	client := easyllm.HandlerFuncs(func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+		requests = append(requests, request)
+		return &easyai.ChatResponse{Role: easyai.IdBot, Content: replies[len(requests)-1]}, nil, nil
+	}, nil)
+
+	review, err := easyllm.ChatJSON[movieReview](context.Background(), client, &easyai.ChatRequest{Message: "评价一下霸王别姬"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if review.Score != 9 || review.Tags[0] != "经典" || review.Director != nil {
+		t.Fatalf("unexpected review: %+v", review)
+	}
+	if len(requests) != 2 || !requests[0].JSONMode || !strings.Contains(requests[0].Tips.Content, `"sentiment"`) {
+		t.Fatalf("unexpected first request: %+v", requests[0])
+	}
+	if !strings.Contains(requests[1].Message, "$.score: 应为integer") {
+		t.Fatalf("repair prompt should carry the validation error: %s", requests[1].Message)
+	}
+}
+
+func TestChatJSONExhausted(t *testing.T) {
+	client := easyllm.HandlerFuncs(func(ctx context.Context, request *easyai.ChatRequest) (*easyai.ChatResponse, interface{}, error) {
+		return &easyai.ChatResponse{Content: "抱歉, 我无法回答"}, nil, nil
+	}, nil)
+
+	_, err := easyllm.ChatJSONWithRepair[movieReview](context.Background(), client, &easyai.ChatRequest{Message: "hi"}, 1)
+	if !errors.Is(err, easyllm.ErrInvalidJSON) {
+		t.Fatalf("expected ErrInvalidJSON, got %v", err)
+	}
+}
+
+func TestQWenJSONMode(t *testing.T) {
+	config := easyllm.DefaultConfig("sk-json-key", easyai.ChatTypeQWen)
+	config.HttpClient = newStubClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var params easyai.QWenParameters
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		format, _ := params.Parameters["response_format"].(map[string]interface{})
+		content, _ := json.Marshal(map[string]interface{}{"json_mode": format["type"] == "json_object"})
+		reply, _ := json.Marshal(map[string]interface{}{
+			"output":     map[string]interface{}{"choices": []interface{}{map[string]interface{}{"message": map[string]string{"role": "assistant", "content": string(content)}}}},
+			"request_id": "r-200",
+		})
+		_, _ = w.Write(reply)
+	})
+
+	result, err := easyllm.ChatJSON[struct {
+		JSONMode bool `json:"json_mode"`
+	}](context.Background(), easyllm.NewChatClient(config), &easyai.ChatRequest{Message: "hi"})
+	if err != nil || !result.JSONMode {
+		t.Fatalf("response_format should be sent to QWen: %+v %v", result, err)
+	}
+}
@@ -0,0 +1,108 @@
+package unitest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// stubTransport 将所有请求转发到本地的测试服务, 保留原始的路径与请求头
+type stubTransport struct {
+	target *url.URL
+}
+
+func (self *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	clone.URL.Scheme = self.target.Scheme
+	clone.URL.Host = self.target.Host
+
+	return http.DefaultTransport.RoundTrip(clone)
+}
+
+func newStubClient(t *testing.T, handler http.HandlerFunc) *http.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	target, _ := url.Parse(server.URL)
+
+	return &http.Client{Transport: &stubTransport{target: target}}
+}
+
+// stubWsConn 测试服务端使用的WebSocket连接, 客户端发来的帧带掩码, 服务端发出的不带
+type stubWsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*stubWsConn, error) {
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if err = rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return &stubWsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+func (self *stubWsConn) read() (opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(self.reader, header); err != nil {
+		return
+	}
+	opcode = header[0] & 0x0F
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(self.reader, extended)
+		length = int(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		_, err = io.ReadFull(self.reader, extended)
+		length = int(binary.BigEndian.Uint64(extended))
+	}
+	mask := make([]byte, 4)
+	if _, err = io.ReadFull(self.reader, mask); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(self.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return
+}
+
+func (self *stubWsConn) write(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	_, err := self.conn.Write(append(frame, payload...))
+
+	return err
+}
@@ -0,0 +1,103 @@
+package unitest
+
+import (
+	"github.com/soryetong/go-easy-llm/service"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m|\x1b\\]8;;[^\x1b]*\x1b\\\\")
+
+const terminalSample = "# 标题\n这是**重点**与`code`, 见[文档](https://example.com)。\n" +
+	"| 名称 | 说明 |\n|---|---|\n| 苹果 | 一种很常见的水果, 味道酸甜可口 |\n\n" +
+	"```go\nfunc main() { // 入口\n\treturn \"ok\"\n}\n```\n- [x] 完成\n"
+
+func TestTerminalRenderer(t *testing.T) {
+	renderer := &service.TerminalRenderer{Width: 30, Color: true}
+	output := renderer.Do(terminalSample) + renderer.Flush()
+
+	for _, expected := range []string{
+		"\x1b[1;4;35m标题",                    // 标题
+		"\x1b[1m重点",                         // 粗体
+		"\x1b]8;;https://example.com\x1b\\", // OSC 8链接
+		"\x1b[35mfunc\x1b[39m",              // 关键字
+		"\x1b[90m// 入口\x1b[39m",             // 注释
+		"\x1b[32m\"ok\"\x1b[39m",            // 字符串
+		"┌", "☑ 完成",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("missing %q in output:\n%s", expected, output)
+		}
+	}
+
+	// 表格按终端宽度换行
+	for _, line := range strings.Split(ansiPattern.ReplaceAllString(output, ""), "\n") {
+		if strings.HasPrefix(line, "│") && len([]rune(line)) > 30 {
+			t.Fatalf("table line exceeds terminal width: %q", line)
+		}
+	}
+}
+
+func TestTerminalRendererStream(t *testing.T) {
+	whole := &service.TerminalRenderer{Width: 40, Color: true}
+	want := whole.Do(terminalSample) + whole.Flush()
+
+	// 逐字输出的结果与整体渲染一致, 且不使用光标移动等重绘手段
+	renderer := &service.TerminalRenderer{Width: 40, Color: true}
+	var builder strings.Builder
+	for _, r := range terminalSample {
+		builder.WriteString(renderer.Do(string(r)))
+	}
+	builder.WriteString(renderer.Flush())
+
+	if builder.String() != want {
+		t.Fatalf("chunked output differs:\n%q\n%q", builder.String(), want)
+	}
+	if strings.ContainsAny(want, "\r\b") || regexp.MustCompile("\x1b\\[[0-9;]*[ABCDHJK]").MatchString(want) {
+		t.Fatal("output should not redraw")
+	}
+}
+
+func TestTerminalRendererSpacing(t *testing.T) {
+	renderer := &service.TerminalRenderer{Width: 40, Color: true}
+	output := renderer.Do("**bold** *it* [link](http://a.com)\n") + renderer.Flush()
+
+	// 样式在空白前结束, 链接在文字前才开始
+	want := "\x1b[1mbold\x1b[0m \x1b[3mit\x1b[0m \x1b[4;34m\x1b]8;;http://a.com\x1b\\link\x1b]8;;\x1b\\\x1b[0m\n"
+	if output != want {
+		t.Fatalf("unexpected output:\n%q\n%q", output, want)
+	}
+}
+
+func TestTerminalRendererPlain(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	renderer := service.NewTerminalRenderer(file)
+	if renderer.Color {
+		t.Fatal("a regular file is not a terminal")
+	}
+	output := renderer.Do("## 标题\n**粗体**\n```go\nx := 1\n```\n") + renderer.Flush()
+	if output != "标题\n粗体\nx := 1\n" {
+		t.Fatalf("unexpected plain output: %q", output)
+	}
+}
+
+func TestTerminalRendererWidth(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// 不是终端时无法获取大小, 取COLUMNS环境变量
+	t.Setenv("COLUMNS", "120")
+	if renderer := service.NewTerminalRenderer(file); renderer.Width != 120 {
+		t.Fatalf("expected width from COLUMNS, got %d", renderer.Width)
+	}
+}
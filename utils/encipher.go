@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 )
 
 func Sha256hex(s string) string {
@@ -18,3 +22,43 @@ func HmacSha256(s, key string) string {
 
 	return string(hashed.Sum(nil))
 }
+
+// AesGcmEncrypt 使用AES-GCM加密, key的长度为16、24或32字节, 随机生成的nonce放在密文之前
+// additional为附加的认证数据, 解密时需要相同
+func AesGcmEncrypt(plaintext, key, additional []byte) ([]byte, error) {
+	aead, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// AesGcmDecrypt 解密AesGcmEncrypt的结果, 密钥、附加数据不一致或密文被修改时返回错误
+func AesGcmDecrypt(ciphertext, key, additional []byte) ([]byte, error) {
+	aead, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("密文长度不足")
+	}
+
+	size := aead.NonceSize()
+
+	return aead.Open(nil, ciphertext[:size], ciphertext[size:], additional)
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	sentenceTerminators = "。！？；…!?;."
+	sentenceClosers     = "\"'”’」』）)]》】"
+	sentenceSoftBreaks  = "，,、：:— \t"
+)
+
+// sentenceAbbreviations 其后的.不是句子的结束, 如Mr. Smith与e.g. apples
+var sentenceAbbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"vs": true, "e.g": true, "i.e": true, "fig": true, "approx": true, "dept": true,
+}
+
+// SentenceSegmenter 缓冲流式回复, 切分出完整的句子, 用于语音合成与字幕
+// 数字中的小数点、缩写与网址中的.不作为句子的结束
+type SentenceSegmenter struct {
+	MaxLength int  // 句子的最大字符数, 超过时优先在逗号或空白处强制切分, 为0时不限制
+	SkipCode  bool // 跳过```包围的代码块
+
+	pending   string // 尚无法确定如何切分的内容
+	sentence  strings.Builder
+	length    int    // sentence的字符数
+	lineStart bool   // pending位于行首
+	fence     string // 所在代码块的开始标记
+	started   bool
+}
+
+// SplitSentences 将完整的文本切分为句子
+func SplitSentences(value string) []string {
+	segmenter := new(SentenceSegmenter)
+
+	return append(segmenter.Do(value), segmenter.Flush()...)
+}
+
+// Do 输入一段内容, 返回其中已完整的句子
+func (self *SentenceSegmenter) Do(value string) []string {
+	if !self.started {
+		self.started, self.lineStart = true, true
+	}
+	self.pending += value
+
+	return self.process(false)
+}
+
+// Flush 输出剩余的内容并重置状态, 未结束的代码块直接丢弃
+func (self *SentenceSegmenter) Flush() []string {
+	sentences := append(self.Do(""), self.process(true)...)
+	sentences = self.emit(sentences)
+	*self = SentenceSegmenter{MaxLength: self.MaxLength, SkipCode: self.SkipCode}
+
+	return sentences
+}
+
+// process final为true时视为输入已结束, 不再等待后续内容
+func (self *SentenceSegmenter) process(final bool) []string {
+	var sentences []string
+	for self.pending != "" {
+		if self.SkipCode && (self.lineStart || self.fence != "") {
+			skipped, ok := self.skipCode(final)
+			if !ok {
+				break
+			}
+			if skipped {
+				// 代码块前后各自成句
+				sentences = self.emit(sentences)
+				continue
+			}
+		}
+		self.lineStart = false
+
+		r, size := utf8.DecodeRuneInString(self.pending)
+		if r == utf8.RuneError && !utf8.FullRuneInString(self.pending) && !final {
+			break
+		}
+		if strings.ContainsRune(sentenceTerminators, r) {
+			size, ok := self.terminator(final)
+			if !ok {
+				break
+			}
+			if size > 0 {
+				self.add(self.pending[:size])
+				self.pending = self.pending[size:]
+				sentences = self.emit(sentences)
+				continue
+			}
+		}
+
+		self.add(self.pending[:size])
+		self.pending = self.pending[size:]
+		if r == '\n' {
+			self.lineStart = true
+			sentences = self.emit(sentences)
+		}
+		if self.MaxLength > 0 && self.length >= self.MaxLength {
+			sentences = self.split(sentences)
+		}
+	}
+
+	return sentences
+}
+
+// terminator pending以结束标点开头, 返回句子结束时包括的长度, 如"?!"与其后的引号, 不是句子的结束时返回0
+func (self *SentenceSegmenter) terminator(final bool) (int, bool) {
+	end := len(self.pending) - len(strings.TrimLeft(self.pending, sentenceTerminators))
+	end = len(self.pending) - len(strings.TrimLeft(self.pending[end:], sentenceClosers))
+	if end == len(self.pending) && !final || !utf8.FullRuneInString(self.pending[end:]) && !final {
+		return 0, false
+	}
+
+	// 中文标点总是句子的结束
+	marks := strings.TrimRight(self.pending[:end], sentenceClosers)
+	if strings.ContainsFunc(marks, func(r rune) bool { return r >= utf8.RuneSelf }) {
+		return end, true
+	}
+
+	// 英文标点后需要是空白或中文, 如3.14、a.com/b.html与?a=1中的不是
+	if next, _ := utf8.DecodeRuneInString(self.pending[end:]); end < len(self.pending) && !unicode.IsSpace(next) && next < utf8.RuneSelf {
+		return 0, true
+	}
+	if marks == "." {
+		// no是普通单词, 只有No. 5这样首字母大写且其后是数字时才是编号的缩写
+		if self.lastWord() == "No" {
+			rest := strings.TrimLeft(self.pending[end:], " \t")
+			if rest == "" && !final {
+				return 0, false
+			}
+			if rest != "" && rest[0] >= '0' && rest[0] <= '9' {
+				return 0, true
+			}
+		}
+		if self.abbreviation() {
+			return 0, true
+		}
+	}
+
+	return end, true
+}
+
+// abbreviation .前的单词是缩写、人名的首字母或行首的序号, 如Dr.、J.与1.
+func (self *SentenceSegmenter) abbreviation() bool {
+	sentence, word := self.sentence.String(), self.lastWord()
+	if word == "" {
+		return false
+	}
+	if r, size := utf8.DecodeRuneInString(word); size == len(word) && unicode.IsUpper(r) {
+		return true
+	}
+	if strings.Trim(word, "0123456789") == "" && strings.TrimSpace(sentence) == word {
+		return true
+	}
+
+	return sentenceAbbreviations[strings.ToLower(word)]
+}
+
+// lastWord 当前句子的最后一个单词, 去掉了前面的括号与引号
+func (self *SentenceSegmenter) lastWord() string {
+	sentence := self.sentence.String()
+	word := sentence[strings.LastIndexFunc(sentence, unicode.IsSpace)+1:]
+
+	return strings.TrimLeft(word, "(（\"'“‘")
+}
+
+// skipCode 在行首判断是否为代码块的开始或结束, 代码块中的内容整行丢弃, 返回是否跳过了内容
+func (self *SentenceSegmenter) skipCode(final bool) (skipped, ok bool) {
+	line, _, found := strings.Cut(self.pending, "\n")
+	complete := found || final
+	rest := strings.TrimLeft(line, " \t")
+
+	if self.fence == "" {
+		// 代码块标记需要整行才能判断
+		if !complete && (strings.HasPrefix(rest, "```") || strings.HasPrefix(rest, "~~~") ||
+			strings.HasPrefix("```", rest) || strings.HasPrefix("~~~", rest)) {
+			return false, false
+		}
+		if !isCodeFence(rest) {
+			return false, true
+		}
+		self.fence = rest[:len(rest)-len(strings.TrimLeft(rest, rest[:1]))]
+	} else if !complete {
+		return false, false
+	} else if trimmed := strings.TrimSpace(rest); len(trimmed) >= len(self.fence) && strings.Trim(trimmed, self.fence[:1]) == "" {
+		self.fence = ""
+	}
+
+	self.pending = self.pending[min(len(line)+1, len(self.pending)):]
+	self.lineStart = true
+
+	return true, true
+}
+
+func (self *SentenceSegmenter) add(value string) {
+	self.sentence.WriteString(value)
+	self.length += utf8.RuneCountInString(value)
+}
+
+// emit 结束当前的句子, 只有空白时丢弃
+func (self *SentenceSegmenter) emit(sentences []string) []string {
+	sentence := self.sentence.String()
+	self.sentence.Reset()
+	self.length = 0
+
+	return appendSentence(sentences, sentence)
+}
+
+// split 句子过长时在后半段最后一个逗号或空白处切分, 没有时直接按最大长度切分
+func (self *SentenceSegmenter) split(sentences []string) []string {
+	sentence := self.sentence.String()
+	cut := len(sentence)
+	for i, count := len(sentence), self.length; i > 0 && count >= self.MaxLength/2; count-- {
+		r, size := utf8.DecodeLastRuneInString(sentence[:i])
+		if strings.ContainsRune(sentenceSoftBreaks, r) {
+			cut = i
+			break
+		}
+		i -= size
+	}
+
+	self.sentence.Reset()
+	self.length = 0
+	self.add(sentence[cut:])
+
+	return appendSentence(sentences, sentence[:cut])
+}
+
+func appendSentence(sentences []string, value string) []string {
+	if value = strings.TrimSpace(value); value != "" {
+		sentences = append(sentences, value)
+	}
+
+	return sentences
+}
+
+// isCodeFence 行首是否为```或~~~代码块标记
+func isCodeFence(rest string) bool {
+	if !strings.HasPrefix(rest, "```") && !strings.HasPrefix(rest, "~~~") {
+		return false
+	}
+
+	// ```后的语言标识中不能再有`, 否则是行内代码
+	return rest[0] == '~' || !strings.Contains(strings.TrimLeft(rest, "`"), "`")
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// EstimateTokens 粗略估算token数: 中日韩文字每字1个, 其余字母数字每4个字符约1个
+func EstimateTokens(text string) int {
+	tokens, letters := 0, 0
+	flush := func() {
+		tokens += (letters + 3) / 4
+		letters = 0
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r), unicode.Is(unicode.Hiragana, r),
+			unicode.Is(unicode.Katakana, r), unicode.Is(unicode.Hangul, r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			letters++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// TextSimilarity 以相邻两个字符组成的片段计算两段文本的Dice相似度, 取值0到1, 忽略大小写、空白与标点
+// 不需要分词, 中英文均可使用, 适合短文本的粗略比较
+func TextSimilarity(a, b string) float64 {
+	left, right := bigrams(a), bigrams(b)
+	if len(left) == 0 || len(right) == 0 {
+		return 0
+	}
+
+	var common, total int
+	for gram, count := range left {
+		common += min(count, right[gram])
+		total += count
+	}
+	for _, count := range right {
+		total += count
+	}
+
+	return 2 * float64(common) / float64(total)
+}
+
+func bigrams(text string) map[string]int {
+	var runes []rune
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+
+	grams := make(map[string]int)
+	if len(runes) == 1 {
+		grams[string(runes)]++
+	}
+	for i := 1; i < len(runes); i++ {
+		grams[string(runes[i-1:i+1])]++
+	}
+
+	return grams
+}
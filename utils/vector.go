@@ -0,0 +1,41 @@
+package utils
+
+import "math"
+
+// CosineSimilarity 计算两个向量的余弦相似度, 长度不一致或存在零向量时返回0
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Normalize 将向量归一化为单位长度, 零向量原样返回
+func Normalize(vector []float64) []float64 {
+	var norm float64
+	for _, value := range vector {
+		norm += value * value
+	}
+	if norm == 0 {
+		return vector
+	}
+
+	norm = math.Sqrt(norm)
+	normalized := make([]float64, len(vector))
+	for i, value := range vector {
+		normalized[i] = value / norm
+	}
+
+	return normalized
+}